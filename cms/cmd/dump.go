@@ -1,36 +1,83 @@
 package cmd
 
 import (
+	"bytes"
 	"cms/core"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
-func Dump(ctx *core.Context, everything bool) {
-	ctxcopy := *ctx
-	outDir := ctxcopy.Config.OutDirectory
-	err := os.Mkdir(outDir, 0755)
+func Dump(ctx *core.Context, cache *core.BuildCache, everything bool) {
+	// Conflicting routes are logged; a strict build stops before anything
+	// is written
+	conflicts := core.FindRouteConflicts(ctx)
+	if ctx.Config.Strict && len(conflicts) > 0 {
+		log.Fatalf("Found %d route conflicts", len(conflicts))
+	}
+
+	// The output directory is updated in place
+	outDir := ctx.Config.OutDirectory
+	err := os.MkdirAll(outDir, 0755)
 	if err != nil {
 		log.Fatalf("Failed to create directory %s: %v", outDir, err)
 	}
+	out := &outputDirectory{dir: filepath.Clean(outDir), written: make(map[string]bool)}
 
 	// For each route: create the file
-	for url, file := range ctxcopy.FileManager.GetAllFiles() {
+	for url, file := range ctx.FileManager.GetAllFiles() {
+		// The configuration (e.g. users.yaml) is only tracked because other
+		// files depend on it, and is never published
+		if strings.HasPrefix(file.Path, "config/") {
+			continue
+		}
+
+		// Files which were not processed by any plugin (e.g. the configuration)
+		// are not part of a static site
+		if file.Content == nil && !file.Streamed && !everything {
+			continue
+		}
+
 		// split url in path and file name
 		path := filepath.Join(outDir, filepath.Dir(url))
 		base := filepath.Base(file.Path)
 
-		if everything {
-			// Create the metadata for the file
-			err = os.MkdirAll(path, 0755)
-			if err != nil {
-				log.Fatalf("Failed to mkdir %s: %v", path, err)
+		// The content directory is served from "/", the routes of all other
+		// files include their directory (e.g. "/assets")
+		outRoot := outDir
+		if strings.HasPrefix(file.Path, "content/") {
+			outRoot = filepath.Join(outDir, "content")
+		}
+
+		// Files are stored under their route, which can differ from the
+		// file name: pages are stored as the URL policy requires (e.g.
+		// "about.md" as "about.html" or "about/index.html"), and
+		// "site.css.tmpl" is served as "/assets/site.css"
+		if len(file.Routes) > 0 {
+			route := file.Routes[0]
+			if strings.HasPrefix(file.Path, "content/") {
+				route = ctx.Config.Urls.OutputPath(route)
 			}
+			routePath := filepath.Join(outRoot, filepath.FromSlash(route))
+			path, base = filepath.Dir(routePath), filepath.Base(routePath)
+		}
+
+		err = os.MkdirAll(path, 0755)
+		if err != nil {
+			log.Fatalf("Failed to mkdir %s: %v", path, err)
+		}
 
+		if everything {
 			// write the metadata
 			metadata := fmt.Sprintf("Path: %s\n", file.Path)
 			metadata += fmt.Sprintf("Title: %s\n", file.Metadata.Title)
@@ -45,41 +92,262 @@ func Dump(ctx *core.Context, everything bool) {
 				metadata += fmt.Sprintf("Directory.Title: %s\n", file.Parent.Metadata.Title)
 			}
 
-			outPath := filepath.Join(path, base) + ".yaml"
-			err = os.WriteFile(outPath, []byte(metadata), 0644)
-			if err != nil {
-				log.Fatalf("Failed to create %s: %v", outPath, err)
-			}
+			out.write(filepath.Join(path, base)+".yaml", []byte(metadata))
 		}
 
-		// Write the cached file content
-		outPath := filepath.Join(path, base)
-		err = os.WriteFile(outPath, file.Content, 0644)
-		if err != nil {
-			log.Fatalf("Failed to create %s: %v", outPath, err)
+		// Write the cached file content; large files are copied from disk
+		if file.Streamed {
+			out.copy(file.DiskPath(ctx.Config.SiteDirectory), filepath.Join(path, base))
+		} else {
+			writeFile(ctx, out, filepath.Join(path, base), file.Content, file.Compressed)
+		}
+
+		// Write the files generated by plugins (e.g. resized images) where
+		// their route points to
+		for route, content := range file.OutputFiles {
+			outPath := filepath.Join(outRoot, filepath.FromSlash(route))
+			err = os.MkdirAll(filepath.Dir(outPath), 0755)
+			if err != nil {
+				log.Fatalf("Failed to mkdir %s: %v", filepath.Dir(outPath), err)
+			}
+			writeFile(ctx, out, outPath, content, file.CompressedOutputFiles[route])
 		}
 	}
 
+	writeRedirects(ctx, out, filepath.Join(outDir, "content"))
+
 	if everything {
 		// Filesystem has circular references which break the JSON serializer. Remove them,
-		// and remove other unsupported types
-		ctxcopy.FileWatcher = nil
-		for _, file := range ctxcopy.FileManager.GetAllFiles() {
+		// and remove other unsupported types. The context is not used afterwards.
+		ctx.FileWatcher = nil
+		for _, file := range ctx.FileManager.GetAllFiles() {
 			file.Parent = nil
 			file.Dependencies = nil
 			file.Dependents = nil
 			file.Content = nil
+			file.OutputFiles = nil
+			file.Compressed = nil
+			file.CompressedOutputFiles = nil
+
+			// ... and the cache validators, which depend on the time of the
+			// build, so that the output can be compared with earlier builds
+			file.ContentHash = ""
+			file.OutputHashes = nil
+			file.ModTime = time.Time{}
+			file.SourceModTime = time.Time{}
 		}
 
-		contextJson, err := json.MarshalIndent(&ctxcopy, "", "  ")
+		// The build cache is in the cache directory of the user
+		ctx.Config.CacheDirectory = ""
+
+		contextJson, err := json.MarshalIndent(ctx, "", "  ")
 		if err != nil {
 			log.Fatalf("Failed to marshal context: %v", err)
 		}
 
-		outPath := filepath.Join(outDir, "context.json")
-		err = os.WriteFile(outPath, contextJson, 0644)
+		out.write(filepath.Join(outDir, "context.json"), contextJson)
+	}
+
+	// Files whose sources disappeared since the last build are removed
+	out.removeStale(out.readManifest())
+	out.writeManifest()
+
+	// ... and the processed files are kept for the next build
+	if cache != nil {
+		if err := cache.Save(ctx.FileManager); err != nil {
+			log.Printf("Failed to save the build cache: %v", err)
+		}
+	}
+}
+
+// Lists the files which the last build wrote, relative to the output
+// directory, so that the next build removes those which it does not write
+// again (with or without the build cache)
+const outputManifestFile = ".minicms-outputs"
+
+// The output directory of a build. Files are only written if their content
+// changed, so that their modification time stays the same otherwise.
+type outputDirectory struct {
+	dir     string
+	written map[string]bool // Paths of the files which the build wrote, relative to dir
+}
+
+// Records that the build wrote a file
+func (o *outputDirectory) record(path string) {
+	if rel, err := filepath.Rel(o.dir, path); err == nil {
+		o.written[filepath.ToSlash(rel)] = true
+	}
+}
+
+// Returns true if the build wrote a file
+func (o *outputDirectory) contains(path string) bool {
+	rel, err := filepath.Rel(o.dir, path)
+	return err == nil && o.written[filepath.ToSlash(rel)]
+}
+
+// Returns the files which the last build wrote, from the manifest
+func (o *outputDirectory) readManifest() []string {
+	data, err := os.ReadFile(filepath.Join(o.dir, outputManifestFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to read %s: %v", outputManifestFile, err)
+		}
+		return nil
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// Stores the files which the build wrote in the manifest
+func (o *outputDirectory) writeManifest() {
+	var manifest strings.Builder
+	for _, rel := range slices.Sorted(maps.Keys(o.written)) {
+		manifest.WriteString(rel + "\n")
+	}
+
+	path := filepath.Join(o.dir, outputManifestFile)
+	if err := os.WriteFile(path, []byte(manifest.String()), 0644); err != nil {
+		log.Fatalf("Failed to create %s: %v", path, err)
+	}
+}
+
+// Writes a file, unless it has this content already
+func (o *outputDirectory) write(path string, content []byte) {
+	o.record(path)
+	if info, err := os.Stat(path); err == nil && info.Size() == int64(len(content)) {
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+			return
+		}
+	}
+
+	err := os.WriteFile(path, content, 0644)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", path, err)
+	}
+}
+
+// Copies a file, unless the copy has the size and modification time of the
+// source already
+func (o *outputDirectory) copy(srcPath, path string) {
+	o.record(path)
+	src, err := os.Stat(srcPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", srcPath, err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() == src.Size() && info.ModTime().Equal(src.ModTime()) {
+		return
+	}
+
+	copyFile(srcPath, path)
+	if err := os.Chtimes(path, src.ModTime(), src.ModTime()); err != nil {
+		log.Printf("Failed to set the modification time of %s: %v", path, err)
+	}
+}
+
+// Removes the files which the last build wrote and this one did not, and
+// the directories which are empty afterwards
+func (o *outputDirectory) removeStale(previous []string) {
+	for _, rel := range previous {
+		if o.written[rel] || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			continue
+		}
+
+		path := filepath.Join(o.dir, filepath.FromSlash(rel))
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to remove %s: %v", path, err)
+			continue
+		}
+		log.Printf("Removed %s", path)
+
+		// Fails for directories which are not empty
+		for dir := filepath.Dir(path); dir != o.dir; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// Writes a file, and (if requested) its precompressed versions next to it,
+// e.g. "index.html.gz" and "index.html.br"
+func writeFile(ctx *core.Context, out *outputDirectory, outPath string, content []byte, encodings core.Encodings) {
+	out.write(outPath, content)
+
+	if !ctx.Config.Precompress {
+		return
+	}
+	for encoding, compressed := range encodings {
+		out.write(outPath+core.EncodingExtensions[encoding], compressed)
+	}
+}
+
+// Copies a file without reading it into memory
+func copyFile(srcPath, outPath string) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", srcPath, err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", outPath, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, src); err != nil {
+		log.Fatalf("Failed to copy %s to %s: %v", srcPath, outPath, err)
+	}
+}
+
+// Writes the redirects for static hosting: a page which redirects in the
+// browser for every redirected route (unless a file already exists there),
+// a "_redirects" file (as used by Netlify and Cloudflare Pages), and
+// "redirects.map" for nginx
+func writeRedirects(ctx *core.Context, out *outputDirectory, outDir string) {
+	redirects := core.CollectRedirects(ctx)
+	if len(redirects) == 0 {
+		return
+	}
+
+	var rules, nginxMap strings.Builder
+	nginxMap.WriteString("# Usage: map $uri $redirect_uri { include redirects.map; }\n")
+	nginxMap.WriteString("# The status codes are listed in _redirects\n")
+
+	for _, redirect := range redirects {
+		rules.WriteString(fmt.Sprintf("%s %s %d\n", redirect.From, redirect.To, redirect.StatusCode()))
+
+		if redirect.IsWildcard() {
+			prefix := strings.TrimSuffix(redirect.From, "*")
+			target := strings.ReplaceAll(redirect.To, ":splat", "$1")
+			nginxMap.WriteString(fmt.Sprintf("~^%s(.*)$ %s;\n", regexp.QuoteMeta(prefix), target))
+			continue
+		}
+		nginxMap.WriteString(fmt.Sprintf("%s %s;\n", redirect.From, redirect.To))
+
+		// Routes without extension are stored like pages
+		outPath := filepath.Join(outDir, filepath.FromSlash(ctx.Config.Urls.OutputPath(redirect.From)))
+		if out.contains(outPath) {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(outPath), 0755)
 		if err != nil {
-			log.Fatalf("Failed to write %s: %v", outPath, err)
+			log.Fatalf("Failed to mkdir %s: %v", filepath.Dir(outPath), err)
 		}
+		out.write(outPath, core.RedirectStub(redirect.To))
+	}
+
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		log.Fatalf("Failed to mkdir %s: %v", outDir, err)
+	}
+	for name, content := range map[string]string{"_redirects": rules.String(), "redirects.map": nginxMap.String()} {
+		out.write(filepath.Join(outDir, name), []byte(content))
 	}
 }
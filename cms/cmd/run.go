@@ -14,13 +14,20 @@ import (
 )
 
 func initializeFsWatcher(ctx *core.Context) error {
-	// Initialize the file watcher
-	watcher, err := core.NewFileWatcher(ctx.FileManager)
+	// Initialize the file watcher with the backend selected by "--watch"
+	backend, err := core.NewWatchBackend(ctx.Config.Watch, ctx.Config.Watcher.PollInterval)
 	if err != nil {
+		return fmt.Errorf("failed to create file watcher backend: %w", err)
+	}
+	watcher, err := core.NewFileWatcherWithBackend(ctx.FileManager, backend)
+	if err != nil {
+		backend.Close()
 		return fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
 	ctx.FileWatcher = watcher
+	watcher.SetDebounce(ctx.Config.Watcher.Debounce)
+	watcher.SetRedirectMoves(ctx.Config.Watcher.RedirectMoves)
 
 	// Start watching the content directory
 	err = watcher.Start(ctx.Config.SiteDirectory)
@@ -34,27 +41,42 @@ func initializeFsWatcher(ctx *core.Context) error {
 func Run(ctx *core.Context) {
 	// The FsWatcher will invalidate cached file contents if the underlying file
 	// is changed
-	err := initializeFsWatcher(ctx)
-	if err != nil {
-		log.Fatalf("failed to initialize file watcher: %v", err)
+	watching := ctx.Config.Watch != core.WatchOff
+	if watching {
+		err := initializeFsWatcher(ctx)
+		if err != nil {
+			log.Fatalf("failed to initialize file watcher: %v", err)
+		}
+		defer ctx.FileWatcher.Stop()
+	} else {
+		log.Printf("File watcher is off, changes are applied after a restart")
 	}
-	defer ctx.FileWatcher.Stop()
 
 	// Set up the routes
 	rm := core.NewRouterManager()
-	err = rm.InitializeRouter(ctx)
+	err := rm.InitializeRouter(ctx)
 	if err != nil {
 		log.Fatalf("Failed to set up routes: %v", err)
 	}
+	defer rm.Stop()
 
-	ctx.FileWatcher.SetRouter(rm)
+	// Route conflicts are reported by the health checks
+	core.GlobalHealthChecker.RegisterCheck("router", core.RouterHealthCheck(rm))
 
-	// Install the file watcher listener
-	listener, err := core.RegisterFileWatcherListener(ctx.FileWatcher)
-	if err != nil {
-		log.Fatalf("Failed to register file watcher listener: %v", err)
+	if watching {
+		ctx.FileWatcher.SetRouter(rm)
+		ctx.FileWatcher.SetConfigReloader(ctx)
+
+		// ... and so are lost file watcher events
+		core.GlobalHealthChecker.RegisterCheck("file_watcher", core.FileWatcherHealthCheck(ctx.FileWatcher))
+
+		// Install the file watcher listener
+		listener, err := core.RegisterFileWatcherListener(ctx.FileWatcher)
+		if err != nil {
+			log.Fatalf("Failed to register file watcher listener: %v", err)
+		}
+		defer listener.Stop()
 	}
-	defer listener.Stop()
 
 	// Start monitoring services
 	monitoringCtx, cancelMonitoring := context.WithCancel(context.Background())
@@ -69,7 +91,7 @@ func Run(ctx *core.Context) {
 	// Create HTTP server with security settings
 	server := &http.Server{
 		Addr:         ":" + strconv.Itoa(ctx.Config.Server.Port),
-		Handler:      rm.GetRouter(),
+		Handler:      rm,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
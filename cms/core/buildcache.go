@@ -0,0 +1,378 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Static builds keep the processed files in a cache directory, so that the
+// next build only processes the files which changed since, and the files
+// which depend on them. The index (cache.json) has the hashes, dependencies
+// and routes of the files. The processed content is stored once per hash (objects/). The
+// cache of another build of the program, or of another site.yaml, is
+// discarded.
+
+// Name of the index in the cache directory
+const buildCacheIndexFile = "cache.json"
+
+// Sources which were modified less than this before a build started (or
+// later) are read again by the next build, even if their modification time
+// and size did not change: a filesystem may store the modification time in
+// steps of up to 2s (e.g. FAT)
+const modTimeGranularity = 2 * time.Second
+
+// BuildCache keeps the processed files of static builds
+type BuildCache struct {
+	Directory string
+	key       string    // Version and configuration of the build
+	started   time.Time // When the build opened the cache
+	index     buildCacheIndex
+}
+
+type buildCacheIndex struct {
+	Key     string
+	Started time.Time                  // When the build started
+	Files   map[string]buildCacheEntry // Keyed by the path of the file
+}
+
+// A processed file. The content is stored as the key of an object.
+type buildCacheEntry struct {
+	SourceHash            string
+	SourceModTime         time.Time
+	SourceSize            int64
+	InputHash             string
+	Dependencies          []string
+	Routes                []string
+	Metadata              FileMetadata
+	ContentHash           string
+	ModTime               time.Time
+	Content               string // "" if the file has no content
+	Compressed            map[string]string
+	OutputFiles           map[string]string
+	CompressedOutputFiles map[string]map[string]string
+	OutputHashes          map[string]string
+}
+
+// Returns the default cache directory for the builds of a site into an
+// output directory, in the cache directory of the user. Returns "" if the
+// user has no cache directory.
+func DefaultBuildCacheDirectory(siteDirectory, outDirectory string) string {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	site, err := filepath.Abs(siteDirectory)
+	if err != nil {
+		return ""
+	}
+	out, err := filepath.Abs(outDirectory)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userCache, "minicms", ContentHash([]byte(site+"\x00"+out)))
+}
+
+// Opens the build cache of the configuration, or returns nil if the build
+// is not cached. A cache which cannot be read is logged, and starts empty.
+func OpenBuildCache(ctx *Context) *BuildCache {
+	if ctx.Config.CacheDirectory == "" {
+		return nil
+	}
+
+	cache := &BuildCache{
+		Directory: ctx.Config.CacheDirectory,
+		key:       buildCacheKey(ctx.Config.FilePath),
+		started:   time.Now(),
+	}
+	data, err := os.ReadFile(filepath.Join(cache.Directory, buildCacheIndexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache
+	}
+	if err != nil {
+		log.Printf("Failed to read the build cache: %v", err)
+		return cache
+	}
+
+	var index buildCacheIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		log.Printf("Failed to read the build cache: %v", err)
+		return cache
+	}
+
+	if index.Key != cache.key {
+		log.Printf("Discarding the build cache of another build of the program or configuration")
+		return cache
+	}
+	cache.index.Started = index.Started
+	cache.index.Files = index.Files
+	return cache
+}
+
+// Returns the version of the program and the hash of the site configuration.
+// Builds of the same version differ in their modification time (e.g. while
+// the plugins are developed).
+func buildCacheKey(configFile string) string {
+	config, _ := os.ReadFile(configFile) // Without a site.yaml, the hash of no content
+	key := Version + " " + ContentHash(config)
+	if executable, err := os.Executable(); err == nil {
+		if info, err := os.Stat(executable); err == nil {
+			key += fmt.Sprintf(" %x-%x", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return key
+}
+
+// Takes over the processed files of the last build which are still part of
+// the site, and their dependencies. Must be called before the files are
+// processed. The sources of files whose modification time and size did not
+// change are not read again, unless they were modified shortly before the
+// last build started.
+func (c *BuildCache) Restore(fm *FileManager) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	restored := 0
+	for path, entry := range c.index.Files {
+		file := fm.Files[path]
+		if file == nil {
+			continue
+		}
+
+		processed, err := c.readFile(file, entry)
+		if err != nil {
+			log.Printf("Failed to read %s from the build cache: %v", path, err)
+			continue
+		}
+
+		for _, path := range entry.Dependencies {
+			if dependency := fm.Files[path]; dependency != nil {
+				file.AddDependency(dependency)
+			}
+		}
+		if file.SourceModTime.Equal(entry.SourceModTime) && file.SourceSize == entry.SourceSize &&
+			file.SourceModTime.Before(c.index.Started.Add(-modTimeGranularity)) {
+			file.SourceHash = entry.SourceHash
+		}
+		fm.processed[path] = processed
+		restored++
+	}
+	log.Printf("Restored %d files from the build cache %s", restored, c.Directory)
+}
+
+// Returns the processed version of a file from its entry
+func (c *BuildCache) readFile(file *File, entry buildCacheEntry) (*File, error) {
+	processed := *file
+	processed.SourceHash = entry.SourceHash
+	processed.SourceModTime = entry.SourceModTime
+	processed.SourceSize = entry.SourceSize
+	processed.InputHash = entry.InputHash
+	processed.Routes = entry.Routes
+	processed.Metadata = entry.Metadata
+	processed.ContentHash = entry.ContentHash
+	processed.ModTime = entry.ModTime
+	processed.OutputHashes = entry.OutputHashes
+
+	var err error
+	if processed.Content, err = c.readObject(entry.Content); err != nil {
+		return nil, err
+	}
+	if processed.Compressed, err = c.readObjects(entry.Compressed); err != nil {
+		return nil, err
+	}
+	if processed.OutputFiles, err = c.readObjects(entry.OutputFiles); err != nil {
+		return nil, err
+	}
+	for route, keys := range entry.CompressedOutputFiles {
+		encodings, err := c.readObjects(keys)
+		if err != nil {
+			return nil, err
+		}
+		if processed.CompressedOutputFiles == nil {
+			processed.CompressedOutputFiles = make(map[string]Encodings)
+		}
+		processed.CompressedOutputFiles[route] = encodings
+	}
+	return &processed, nil
+}
+
+// Stores the processed files of the site. Content which is not used anymore
+// is removed from the cache.
+func (c *BuildCache) Save(fm *FileManager) error {
+	index := buildCacheIndex{
+		Key:     c.key,
+		Started: c.started,
+		Files:   make(map[string]buildCacheEntry),
+	}
+
+	// The processed files share the dependencies with the current version of
+	// the file
+	type processedFile struct {
+		file         *File
+		dependencies []string
+	}
+	fm.mu.RLock()
+	var files []processedFile
+	for path, processed := range fm.processed {
+		if fm.Files[path] != nil {
+			files = append(files, processedFile{processed, slices.Sorted(maps.Keys(processed.Dependencies))})
+		}
+	}
+	fm.mu.RUnlock()
+
+	used := make(map[string]bool)
+	for _, processed := range files {
+		file := processed.file
+		entry := buildCacheEntry{
+			SourceHash:    file.SourceHash,
+			SourceModTime: file.SourceModTime,
+			SourceSize:    file.SourceSize,
+			InputHash:     file.InputHash,
+			Dependencies:  processed.dependencies,
+			Routes:        file.Routes,
+			Metadata:      file.Metadata,
+			ContentHash:   file.ContentHash,
+			ModTime:       file.ModTime,
+			OutputHashes:  file.OutputHashes,
+		}
+
+		var err error
+		if entry.Content, err = c.writeObject(file.Content, used); err != nil {
+			return err
+		}
+		if entry.Compressed, err = c.writeObjects(file.Compressed, used); err != nil {
+			return err
+		}
+		if entry.OutputFiles, err = c.writeObjects(file.OutputFiles, used); err != nil {
+			return err
+		}
+		for route, encodings := range file.CompressedOutputFiles {
+			keys, err := c.writeObjects(encodings, used)
+			if err != nil {
+				return err
+			}
+			if entry.CompressedOutputFiles == nil {
+				entry.CompressedOutputFiles = make(map[string]map[string]string)
+			}
+			entry.CompressedOutputFiles[route] = keys
+		}
+		index.Files[file.Path] = entry
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to encode the build cache: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(c.Directory, buildCacheIndexFile), data); err != nil {
+		return err
+	}
+	c.index = index
+	return c.removeUnusedObjects(used)
+}
+
+// Returns the path of an object in the cache
+func (c *BuildCache) objectPath(key string) string {
+	return filepath.Join(c.Directory, "objects", key[:2], key)
+}
+
+// Reads an object, or returns nil for the key ""
+func (c *BuildCache) readObject(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+	return os.ReadFile(c.objectPath(key))
+}
+
+// Reads the objects of a map of keys, e.g. of the output files
+func (c *BuildCache) readObjects(keys map[string]string) (map[string][]byte, error) {
+	if keys == nil {
+		return nil, nil
+	}
+	contents := make(map[string][]byte, len(keys))
+	for name, key := range keys {
+		content, err := c.readObject(key)
+		if err != nil {
+			return nil, err
+		}
+		contents[name] = content
+	}
+	return contents, nil
+}
+
+// Stores content unless it is stored already, and returns its key; "" for
+// nil. The keys of the objects which are used are collected in used.
+func (c *BuildCache) writeObject(content []byte, used map[string]bool) (string, error) {
+	if content == nil {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+	used[key] = true
+
+	path := c.objectPath(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+	return key, writeFileAtomic(path, content)
+}
+
+// Stores the contents of a map, e.g. the output files, and returns their keys
+func (c *BuildCache) writeObjects(contents map[string][]byte, used map[string]bool) (map[string]string, error) {
+	if contents == nil {
+		return nil, nil
+	}
+	keys := make(map[string]string, len(contents))
+	for name, content := range contents {
+		key, err := c.writeObject(content, used)
+		if err != nil {
+			return nil, err
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// Removes the objects which are not used by any file
+func (c *BuildCache) removeUnusedObjects(used map[string]bool) error {
+	return filepath.WalkDir(filepath.Join(c.Directory, "objects"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || used[entry.Name()] {
+			return err
+		}
+		return os.Remove(path)
+	})
+}
+
+// Writes a file, so that readers see either the old or the new content
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to write the build cache: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write the build cache: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write the build cache: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write the build cache: %w", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write the build cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCache(t *testing.T) {
+	siteDir := t.TempDir()
+	cacheDir := t.TempDir()
+	NewTestDirectoryStructure(siteDir).
+		WithFile(NewTestFileBuilder("config/site.yaml").WithContent("title: Test")).
+		WithFile(NewTestFileBuilder("layout/header.html").WithContent("<header>")).
+		WithFile(NewTestFileBuilder("content/page.md").WithContent("page")).
+		WithFile(NewTestFileBuilder("content/other.md").WithContent("other")).
+		WithFile(NewTestFileBuilder("assets/site.css").WithContent("body {}")).
+		Create(t)
+	ctx := &Context{Config: Config{
+		FilePath:       filepath.Join(siteDir, "config/site.yaml"),
+		SiteDirectory:  siteDir,
+		CacheDirectory: cacheDir,
+	}}
+
+	// Builds the site with the cache, and returns the files which were
+	// processed by the plugin
+	build := func() (*FileManager, []string) {
+		t.Helper()
+		fm := NewFileManager(siteDir)
+		plugin := newLayoutPlugin(nil)
+		fm.GetPluginManager().RegisterPlugin(plugin)
+		for _, dir := range []string{"config", "layout", "content", "assets"} {
+			require.NoError(t, fm.WalkDirectory(dir))
+		}
+
+		cache := OpenBuildCache(ctx)
+		require.NotNil(t, cache)
+		cache.Restore(fm)
+		fm.ProcessAllFiles()
+		require.NoError(t, cache.Save(fm))
+		return fm, plugin.GetProcessedFiles()
+	}
+
+	_, processed := build()
+	assert.Len(t, processed, 4)
+
+	// Nothing changed
+	fm, processed := build()
+	assert.Empty(t, processed)
+	page := fm.GetFile("content/page.md")
+	assert.Equal(t, "<header>page", string(page.Content))
+	assert.Contains(t, page.Dependencies, "layout/header.html")
+	assert.Equal(t, "<header>", string(fm.GetFile("layout/header.html").Content))
+
+	// A source which changed within the granularity of the modification time
+	// is read again, although its modification time and size did not change
+	other := filepath.Join(siteDir, "content/other.md")
+	info, err := os.Stat(other)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(other, []byte("OTHER"), 0644))
+	require.NoError(t, os.Chtimes(other, info.ModTime(), info.ModTime()))
+	fm, processed = build()
+	assert.Equal(t, []string{"content/other.md"}, processed)
+	assert.Equal(t, "<header>OTHER", string(fm.GetFile("content/other.md").Content))
+
+	// A changed layout processes its dependents, a changed page only the page
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "layout/header.html"), []byte("<nav>"), 0644))
+	fm, processed = build()
+	assert.ElementsMatch(t, []string{"content/page.md", "content/other.md"}, processed)
+	assert.Equal(t, "<nav>page", string(fm.GetFile("content/page.md").Content))
+
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "content/page.md"), []byte("new page"), 0644))
+	_, processed = build()
+	assert.Equal(t, []string{"content/page.md"}, processed)
+
+	// Content which is missing from the cache is processed again
+	require.NoError(t, os.RemoveAll(filepath.Join(cacheDir, "objects")))
+	_, processed = build()
+	assert.Len(t, processed, 4)
+
+	// The cache of another configuration is discarded
+	require.NoError(t, os.WriteFile(ctx.Config.FilePath, []byte("title: Other"), 0644))
+	_, processed = build()
+	assert.Len(t, processed, 4)
+
+	// Builds are not cached without a cache directory
+	assert.Nil(t, OpenBuildCache(&Context{}))
+}
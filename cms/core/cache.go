@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fingerprinted assets have the hash of their content in the name,
+// e.g. "/assets/site.3b5d5c3712955042.css"
+var fingerprintedRoutePattern = regexp.MustCompile(`^/assets/.+\.[0-9a-f]{16}\.[^./]+$`)
+
+// Returns the hash of the content of a file, which is used for the ETag
+// and for the fingerprints of assets
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Returns true if the route contains a fingerprint, i.e. the content behind
+// the route never changes
+func IsFingerprinted(route string) bool {
+	return fingerprintedRoutePattern.MatchString(route)
+}
+
+// Updates the hashes and the modification time of a processed file, and
+// returns true if the content changed. The output files are hashed as well,
+// instead of on every request. The modification time only changes with the
+// content or the output files, and is the newest modification time of the
+// file and its dependencies (e.g. the layout), but always later than the
+// previous one: the sources can get older, e.g. after a dependency was
+// removed or an older version of a file was restored, and clients which only
+// send If-Modified-Since would keep the old content.
+func (fm *FileManager) updateCacheValidators(file *File) bool {
+	var outputHashes map[string]string
+	for route, content := range file.OutputFiles {
+		if outputHashes == nil {
+			outputHashes = make(map[string]string, len(file.OutputFiles))
+		}
+		outputHashes[route] = ContentHash(content)
+	}
+	outputsChanged := !maps.Equal(outputHashes, file.OutputHashes)
+	file.OutputHashes = outputHashes
+
+	if file.Content == nil {
+		file.ContentHash = ""
+		return true
+	}
+
+	hash := ContentHash(file.Content)
+	changed := hash != file.ContentHash || file.ModTime.IsZero()
+	if !changed && !outputsChanged {
+		return false
+	}
+	file.ContentHash = hash
+
+	var newest time.Time
+	for _, source := range append([]*File{file}, slices.Collect(maps.Values(file.Dependencies))...) {
+		info, err := os.Stat(source.DiskPath(fm.SiteDirectory))
+		if err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	if newest.IsZero() {
+		newest = time.Now()
+	}
+
+	// Last-Modified has a resolution of one second
+	if previous := file.ModTime; !previous.IsZero() && newest.Before(previous.Add(time.Second)) {
+		newest = previous.Add(time.Second)
+	}
+	file.ModTime = newest
+	return changed
+}
+
+// Writes the content with the caching headers, precompressed if the client
+// accepts one of the encodings. Conditional requests (If-None-Match,
+// If-Modified-Since) are answered with 304 Not Modified.
+func serveContent(c *gin.Context, mimeType string, content []byte, encodings Encodings, hash string, modTime time.Time, cacheControl string) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", mimeType)
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+
+	// Every encoding is a different representation, with its own ETag
+	if len(encodings) > 0 {
+		header.Add("Vary", "Accept-Encoding")
+		if encoding := NegotiateEncoding(c.GetHeader("Accept-Encoding"), encodings); encoding != "" {
+			header.Set("Content-Encoding", encoding)
+			content = encodings[encoding]
+			if hash != "" {
+				hash += "-" + encoding
+			}
+		}
+	}
+	if hash != "" {
+		header.Set("ETag", `"`+hash+`"`)
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", modTime, bytes.NewReader(content))
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateCacheValidators(t *testing.T) {
+	siteDir := t.TempDir()
+	NewTestDirectoryStructure(siteDir).
+		WithFile(NewTestFileBuilder("content/page.md").WithContent("page")).
+		WithFile(NewTestFileBuilder("layout/header.html").WithContent("<header>")).
+		WithFile(NewTestFileBuilder("layout/footer.html").WithContent("<footer>")).
+		Create(t)
+	fm := NewFileManager(siteDir)
+	for _, dir := range []string{"content", "layout"} {
+		require.NoError(t, fm.WalkDirectory(dir))
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	touch := func(path string, modTime time.Time) {
+		t.Helper()
+		require.NoError(t, os.Chtimes(filepath.Join(siteDir, path), modTime, modTime))
+	}
+	touch("content/page.md", base)
+	touch("layout/header.html", base.Add(10*time.Second))
+	touch("layout/footer.html", base.Add(20*time.Second))
+
+	page := fm.GetFile("content/page.md")
+	page.AddDependency(fm.GetFile("layout/header.html"))
+	page.AddDependency(fm.GetFile("layout/footer.html"))
+
+	// The newest source
+	page.Content = []byte("<header>page<footer>")
+	assert.True(t, fm.updateCacheValidators(page))
+	assert.Equal(t, ContentHash(page.Content), page.ContentHash)
+	assert.True(t, base.Add(20*time.Second).Equal(page.ModTime))
+
+	// Unchanged content keeps the validators
+	assert.False(t, fm.updateCacheValidators(page))
+	assert.True(t, base.Add(20*time.Second).Equal(page.ModTime))
+
+	// Output files are hashed once; a changed output file is newer as well
+	page.OutputFiles = map[string][]byte{"/photo-480w.jpg": []byte("small")}
+	assert.False(t, fm.updateCacheValidators(page))
+	assert.Equal(t, map[string]string{"/photo-480w.jpg": ContentHash([]byte("small"))}, page.OutputHashes)
+	assert.True(t, base.Add(21*time.Second).Equal(page.ModTime))
+	page.OutputFiles = nil
+	assert.False(t, fm.updateCacheValidators(page))
+	assert.Nil(t, page.OutputHashes)
+	assert.True(t, base.Add(22*time.Second).Equal(page.ModTime))
+
+	// Without the newest dependency, the time still moves forward
+	delete(page.Dependencies, "layout/footer.html")
+	page.Content = []byte("<header>page")
+	assert.True(t, fm.updateCacheValidators(page))
+	assert.True(t, base.Add(23*time.Second).Equal(page.ModTime))
+
+	// ... also after an older version of the page was restored
+	touch("content/page.md", base.Add(-time.Hour))
+	page.Content = []byte("<header>old page")
+	assert.True(t, fm.updateCacheValidators(page))
+	assert.True(t, base.Add(24*time.Second).Equal(page.ModTime))
+
+	// A newer source is used as it is
+	touch("content/page.md", base.Add(time.Hour))
+	page.Content = []byte("<header>new page")
+	assert.True(t, fm.updateCacheValidators(page))
+	assert.True(t, base.Add(time.Hour).Equal(page.ModTime))
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// A file is marked for update whenever it or one of its dependencies is
+// written, even if an editor saved the same bytes again. Before the plugins
+// process a file, the hash of its inputs is compared with the one of its
+// last processed version, which is reused if nothing changed. The inputs are
+// the source on disk, the path, language and directory of the file, the
+// inputs, content and routes of its dependencies, and the paths and URLs
+// (from the frontmatter) of its translations, which it links to.
+// Dependencies are processed before their dependents, so a touched layout
+// keeps the pages unchanged. The source is only read again after the file
+// changed on disk.
+
+// Returns the hash of the file on disk, or "" if it cannot be read
+func (fm *FileManager) sourceHash(file *File) string {
+	source, err := os.Open(file.DiskPath(fm.SiteDirectory))
+	if err != nil {
+		return ""
+	}
+	defer source.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, source); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// Returns the hash of the inputs of a file, or "" if its source is unknown
+// (thread-safe)
+func (fm *FileManager) inputHash(file *File) string {
+	if file.SourceHash == "" {
+		return ""
+	}
+
+	inputs := []string{file.Path, file.SourceHash, file.Language, file.TranslationKey}
+	if file.Parent != nil {
+		inputs = append(inputs, file.Parent.Metadata.Title, file.Parent.Metadata.CssFile)
+	}
+
+	fm.mu.RLock()
+	translations := fm.getTranslationsUnsafe(file)
+	slices.SortFunc(translations, func(a, b *File) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	for _, translation := range translations {
+		frontmatter := translation.Frontmatter
+		inputs = append(inputs, translation.Path, frontmatter.Url, frontmatter.Slug, frontmatter.Date.String())
+	}
+	for _, path := range slices.Sorted(maps.Keys(file.Dependencies)) {
+		if path == file.Path {
+			continue
+		}
+		inputs = append(inputs, path)
+		if dependency := fm.Files[path]; dependency != nil {
+			inputs = append(inputs, dependency.InputHash, dependency.ContentHash, strings.Join(dependency.Routes, "\n"))
+		}
+	}
+	fm.mu.RUnlock()
+
+	hash := sha256.New()
+	for _, input := range inputs {
+		hash.Write([]byte(input))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// Takes over the processed content of the last version of a file if its
+// inputs did not change. Returns false if the file has to be processed.
+func (fm *FileManager) reuseProcessed(file *File) bool {
+	if file.InputHash == "" {
+		return false
+	}
+
+	fm.mu.RLock()
+	previous := fm.processed[file.Path]
+	fm.mu.RUnlock()
+	if previous == nil || previous.InputHash != file.InputHash {
+		return false
+	}
+
+	file.Content = previous.Content
+	file.Metadata = previous.Metadata
+	file.Routes = previous.Routes
+	file.OutputFiles = previous.OutputFiles
+	file.ContentHash, file.ModTime = previous.ContentHash, previous.ModTime
+	file.Compressed, file.CompressedOutputFiles = previous.Compressed, previous.CompressedOutputFiles
+	file.OutputHashes = previous.OutputHashes
+
+	// Changed dependencies mark the new version of the file for update
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for path := range file.Dependencies {
+		if dependency := fm.Files[path]; dependency != nil && path != file.Path {
+			file.AddDependency(dependency)
+		}
+	}
+	return true
+}
+
+// Keeps a processed file, to be reused while its inputs do not change
+// (thread-safe)
+func (fm *FileManager) storeProcessed(file *File) {
+	if file.InputHash == "" {
+		return
+	}
+
+	// The file itself is changed when it is marked for update
+	processed := *file
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.processed[file.Path] = &processed
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessSkipsUnchangedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	NewTestDirectoryStructure(tempDir).
+		WithFile(NewTestFileBuilder("layout/header.html").WithContent("<header>")).
+		WithFile(NewTestFileBuilder("content/page.md").WithContent("page")).
+		WithFile(NewTestFileBuilder("content/other.md").WithContent("other")).
+		Create(t)
+
+	fm := NewFileManager(tempDir)
+	plugin := newLayoutPlugin(nil)
+	fm.GetPluginManager().RegisterPlugin(plugin)
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+
+	// The metrics are shared with other tests, which may process files at the
+	// same time, so only the increase is checked
+	misses := GlobalMetrics.FileCacheMisses.Get()
+	fm.ProcessAllFiles()
+	assert.Len(t, plugin.GetProcessedFiles(), 2)
+	assert.Greater(t, GlobalMetrics.FileCacheMisses.Get(), misses)
+
+	// Saves the file and returns the files which were rendered again
+	write := func(name, content string) []string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(path, later, later))
+		fm.AddFile(name)
+		plugin.Reset()
+		fm.ProcessUpdatedFiles()
+		return plugin.GetProcessedFiles()
+	}
+
+	// Saving the same bytes renders nothing, not even the dependents
+	hits := GlobalMetrics.FileCacheHits.Get()
+	assert.Empty(t, write("layout/header.html", "<header>"))
+	assert.Greater(t, GlobalMetrics.FileCacheHits.Get(), hits)
+	page := fm.GetFile("content/page.md")
+	assert.Equal(t, "<header>page", string(page.Content))
+	assert.NotEmpty(t, page.SourceHash)
+	assert.NotEmpty(t, page.InputHash)
+
+	// A changed layout renders its dependents
+	assert.ElementsMatch(t, []string{"content/page.md", "content/other.md"}, write("layout/header.html", "<nav>"))
+	assert.Equal(t, "<nav>page", string(fm.GetFile("content/page.md").Content))
+
+	// A changed page renders only the page
+	assert.Empty(t, write("content/page.md", "page"))
+	assert.Equal(t, []string{"content/page.md"}, write("content/page.md", "new page"))
+	assert.Equal(t, "<nav>new page", string(fm.GetFile("content/page.md").Content))
+
+	// A page which moved is rendered at its new path
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "content/other.md"), filepath.Join(tempDir, "content/moved.md")))
+	fm.MoveFile("content/other.md", "content/moved.md")
+	plugin.Reset()
+	fm.ProcessUpdatedFiles()
+	assert.Equal(t, []string{"content/moved.md"}, plugin.GetProcessedFiles())
+}
+
+func TestProcessRendersTranslations(t *testing.T) {
+	tempDir := t.TempDir()
+	page := func(path, url string) *TestFileBuilder {
+		return NewTestFileBuilder(path).WithContent("---\nurl: " + url + "\n---\n")
+	}
+	NewTestDirectoryStructure(tempDir).WithFile(page("content/cv.html", "/en-cv/")).Create(t)
+
+	// Renders the URLs of the translations of a page
+	fm := NewFileManager(tempDir)
+	fm.SetLanguages(newTestLanguages())
+	plugin := NewMockPlugin("translations", 0).WithProcessFunc(func(ctx *PluginContext) *PluginResult {
+		var urls []string
+		for _, translation := range ctx.FileManager.GetTranslations(ctx.File) {
+			urls = append(urls, translation.Frontmatter.Url)
+		}
+		slices.Sort(urls)
+		return &PluginResult{Success: true, Modified: true, NewContent: []byte(strings.Join(urls, " "))}
+	})
+	fm.GetPluginManager().RegisterPlugin(plugin)
+	require.NoError(t, fm.WalkDirectory("content"))
+	fm.ProcessAllFiles()
+	assert.Equal(t, "/en-cv/", string(fm.GetFile("content/cv.html").Content))
+
+	// Returns the files which were rendered again
+	process := func() []string {
+		t.Helper()
+		plugin.Reset()
+		fm.ProcessUpdatedFiles()
+		return plugin.GetProcessedFiles()
+	}
+
+	// A new translation renders the other translations again
+	page("content/de/cv.html", "/de/lebenslauf/").CreatePhysically(t, tempDir)
+	fm.AddFile("content/de/cv.html")
+	assert.ElementsMatch(t, []string{"content/cv.html", "content/de/cv.html"}, process())
+	assert.Equal(t, "/de/lebenslauf/ /en-cv/", string(fm.GetFile("content/cv.html").Content))
+
+	// ... and so does a translation with another URL, but not the same one
+	// saved again
+	page("content/de/cv.html", "/de/cv/").CreatePhysically(t, tempDir)
+	fm.AddFile("content/de/cv.html")
+	assert.ElementsMatch(t, []string{"content/cv.html", "content/de/cv.html"}, process())
+	assert.Equal(t, "/de/cv/ /en-cv/", string(fm.GetFile("content/cv.html").Content))
+	fm.AddFile("content/de/cv.html")
+	assert.Empty(t, process())
+
+	// ... and a removed translation
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "content/de/cv.html")))
+	fm.RemoveFile("content/de/cv.html")
+	assert.Equal(t, []string{"content/cv.html"}, process())
+	assert.Equal(t, "/en-cv/", string(fm.GetFile("content/cv.html").Content))
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings of precompressed responses
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// File extensions of precompressed files, as expected by e.g. nginx's
+// gzip_static and brotli_static
+var EncodingExtensions = map[string]string{
+	EncodingBrotli: ".br",
+	EncodingGzip:   ".gz",
+}
+
+// Content smaller than this is not worth compressing
+const minCompressSize = 256
+
+// Precompressed versions of a response, keyed by the content encoding
+type Encodings map[string][]byte
+
+// Returns true for text-based MIME types, which compress well
+func IsCompressible(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml",
+		"application/manifest+json", "application/rss+xml", "application/atom+xml",
+		"image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// Compresses content with gzip and brotli. Returns nil if the content is
+// not compressible or too small; encodings which do not reduce the size
+// are omitted.
+func Compress(content []byte, mimeType string) Encodings {
+	if len(content) < minCompressSize || !IsCompressible(mimeType) {
+		return nil
+	}
+
+	encodings := make(Encodings)
+
+	var gz bytes.Buffer
+	gzWriter, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if _, err := gzWriter.Write(content); err == nil && gzWriter.Close() == nil && gz.Len() < len(content) {
+		encodings[EncodingGzip] = gz.Bytes()
+	}
+
+	var br bytes.Buffer
+	brWriter := brotli.NewWriterLevel(&br, brotli.BestCompression)
+	if _, err := brWriter.Write(content); err == nil && brWriter.Close() == nil && br.Len() < len(content) {
+		encodings[EncodingBrotli] = br.Bytes()
+	}
+
+	if len(encodings) == 0 {
+		return nil
+	}
+	return encodings
+}
+
+// Returns the best available encoding for an Accept-Encoding header, or an
+// empty string if the content should be sent uncompressed. Brotli is
+// preferred if the client accepts both with the same quality.
+func NegotiateEncoding(acceptEncoding string, available Encodings) string {
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{EncodingBrotli, EncodingGzip} {
+		if _, exists := available[encoding]; !exists {
+			continue
+		}
+		if quality := acceptQuality(acceptEncoding, encoding); quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// Returns the quality value of an encoding in an Accept-Encoding header
+// (0 if it is not accepted)
+func acceptQuality(acceptEncoding, encoding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case encoding:
+			return q
+		case "*":
+			wildcard = q
+		}
+	}
+	if wildcard >= 0 {
+		return wildcard
+	}
+	return 0
+}
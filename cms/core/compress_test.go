@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress(t *testing.T) {
+	page := []byte(strings.Repeat("<p>Lorem ipsum dolor sit amet</p>\n", 50))
+
+	encodings := Compress(page, "text/html; charset=utf-8")
+	if len(encodings) != 2 {
+		t.Fatalf("Expected gzip and brotli encodings, got %d", len(encodings))
+	}
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(encodings[EncodingGzip]))
+	if err != nil {
+		t.Fatalf("Failed to read gzip content: %v", err)
+	}
+	if decompressed, _ := io.ReadAll(gzReader); !bytes.Equal(decompressed, page) {
+		t.Error("Decompressed gzip content differs from the original")
+	}
+
+	decompressed, err := io.ReadAll(brotli.NewReader(bytes.NewReader(encodings[EncodingBrotli])))
+	if err != nil || !bytes.Equal(decompressed, page) {
+		t.Errorf("Decompressed brotli content differs from the original (%v)", err)
+	}
+
+	if encodings := Compress([]byte("<p>Hi</p>"), "text/html"); encodings != nil {
+		t.Error("Expected small content not to be compressed")
+	}
+	if encodings := Compress(page, "image/png"); encodings != nil {
+		t.Error("Expected images not to be compressed")
+	}
+	if encodings := Compress(page, ""); encodings != nil {
+		t.Error("Expected content without MIME type not to be compressed")
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	both := Encodings{EncodingGzip: []byte("gz"), EncodingBrotli: []byte("br")}
+	gzipOnly := Encodings{EncodingGzip: []byte("gz")}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		available      Encodings
+		expected       string
+	}{
+		{"no header", "", both, ""},
+		{"gzip", "gzip", both, EncodingGzip},
+		{"brotli preferred", "gzip, deflate, br", both, EncodingBrotli},
+		{"quality", "br;q=0.5, gzip", both, EncodingGzip},
+		{"rejected", "br;q=0, gzip;q=0", both, ""},
+		{"wildcard", "*", both, EncodingBrotli},
+		{"wildcard with exclusion", "br;q=0, *", both, EncodingGzip},
+		{"not available", "br", gzipOnly, ""},
+		{"nothing available", "gzip, br", nil, ""},
+		{"case insensitive", "GZIP", gzipOnly, EncodingGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateEncoding(tt.acceptEncoding, tt.available); got != tt.expected {
+				t.Errorf("NegotiateEncoding(%q) = %q, expected %q", tt.acceptEncoding, got, tt.expected)
+			}
+		})
+	}
+}
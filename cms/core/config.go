@@ -1,11 +1,13 @@
 package core
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
@@ -23,6 +25,10 @@ const (
 	MaxHostnameLength = 253
 	MaxTitleLength    = 200
 	MaxDescLength     = 500
+
+	DefaultContentCacheControl   = "no-cache"
+	DefaultAssetsCacheControl    = "public, max-age=3600"
+	DefaultImmutableCacheControl = "public, max-age=31536000, immutable"
 )
 
 // Validation errors
@@ -38,10 +44,12 @@ var (
 )
 
 type Server struct {
-	Port        int    `yaml:"port"`
-	Hostname    string `yaml:"hostname"`
-	Title       string `yaml:"title"`
-	Description string `yaml:"description"`
+	Port        int       `yaml:"port"`
+	Hostname    string    `yaml:"hostname"`
+	Title       string    `yaml:"title"`
+	Description string    `yaml:"description"`
+	Security    Security  `yaml:"security"`
+	RateLimit   RateLimit `yaml:"rate-limit"`
 }
 
 func (s *Server) Validate() error {
@@ -77,6 +85,14 @@ func (s *Server) Validate() error {
 		return fmt.Errorf("description too long: %d > %d", len(s.Description), MaxDescLength)
 	}
 
+	if err := s.Security.Validate(); err != nil {
+		return fmt.Errorf("security: %w", err)
+	}
+
+	if err := s.RateLimit.Validate(); err != nil {
+		return fmt.Errorf("rate-limit: %w", err)
+	}
+
 	return nil
 }
 
@@ -118,10 +134,14 @@ func isValidHostname(hostname string) bool {
 }
 
 type Branding struct {
-	Favicon string `yaml:"favicon"`
-	CssFile string `yaml:"cssfile"`
+	Favicon string            `yaml:"favicon"`
+	CssFile string            `yaml:"cssfile"`
+	Theme   map[string]string `yaml:"theme"` // Variables for the CSS templates
 }
 
+// Names of theme variables, e.g. "primary-color"
+var themeVariablePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
 func (b *Branding) Validate() error {
 	// TODO: Re-enable strict path validation after fixing tests
 	// For now, only check for null bytes
@@ -129,9 +149,91 @@ func (b *Branding) Validate() error {
 		return fmt.Errorf("path contains null bytes")
 	}
 
+	// Theme variables are inserted into CSS and must not end the declaration
+	for name, value := range b.Theme {
+		if !themeVariablePattern.MatchString(name) {
+			return fmt.Errorf("invalid theme variable name %q", name)
+		}
+		if strings.ContainsAny(value, "{};<>\x00") {
+			return fmt.Errorf("theme variable %s contains invalid characters", name)
+		}
+	}
+
+	return nil
+}
+
+// AssetBundle concatenates several files of the assets directory into a
+// single file
+type AssetBundle struct {
+	Name  string   `yaml:"name"`  // e.g. "site.css", relative to the assets directory
+	Files []string `yaml:"files"` // relative to the assets directory
+}
+
+type Assets struct {
+	Bundles []AssetBundle `yaml:"bundles"`
+}
+
+func (a *Assets) Validate() error {
+	names := make(map[string]bool)
+	for _, bundle := range a.Bundles {
+		if bundle.Name == "" || !isValidPath(bundle.Name) || filepath.IsAbs(bundle.Name) {
+			return fmt.Errorf("%w: bundle name %q", ErrInvalidPath, bundle.Name)
+		}
+		if names[bundle.Name] {
+			return fmt.Errorf("duplicate bundle %s", bundle.Name)
+		}
+		names[bundle.Name] = true
+
+		if len(bundle.Files) == 0 {
+			return fmt.Errorf("bundle %s has no files", bundle.Name)
+		}
+
+		ext := filepath.Ext(bundle.Name)
+		for _, file := range bundle.Files {
+			if !isValidPath(file) || filepath.IsAbs(file) {
+				return fmt.Errorf("%w: %s in bundle %s", ErrInvalidPath, file, bundle.Name)
+			}
+			// CSS templates (e.g. "site.css.tmpl") are rendered first
+			if filepath.Ext(strings.TrimSuffix(file, ".tmpl")) != ext {
+				return fmt.Errorf("file %s does not match the type of bundle %s", file, bundle.Name)
+			}
+			if file == bundle.Name {
+				return fmt.Errorf("bundle %s cannot contain a file with the same name", bundle.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Cache-Control headers of the responses. Empty values use the defaults.
+type Caching struct {
+	Content   string `yaml:"content"`   // Pages and other files in content/
+	Assets    string `yaml:"assets"`    // Files in assets/
+	Immutable string `yaml:"immutable"` // Fingerprinted assets, which never change
+}
+
+func (c *Caching) Validate() error {
+	for _, value := range []string{c.Content, c.Assets, c.Immutable} {
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid Cache-Control header %q", value)
+		}
+	}
 	return nil
 }
 
+// Returns the Cache-Control header for files in content/ or assets/, or for
+// fingerprinted files
+func (c *Caching) CacheControl(filePath string, fingerprinted bool) string {
+	switch {
+	case fingerprinted:
+		return cmp.Or(c.Immutable, DefaultImmutableCacheControl)
+	case strings.HasPrefix(filePath, "assets/"):
+		return cmp.Or(c.Assets, DefaultAssetsCacheControl)
+	}
+	return cmp.Or(c.Content, DefaultContentCacheControl)
+}
+
 type Plugins map[string]map[string]string
 
 func (p Plugins) Validate() error {
@@ -152,13 +254,28 @@ func (p Plugins) Validate() error {
 }
 
 type Config struct {
-	FilePath      string
-	SiteDirectory string
-	Mode          string
-	OutDirectory  string
-	Server        Server   `yaml:"server"`
-	Branding      Branding `yaml:"branding"`
-	Plugins       Plugins  `yaml:"plugins"`
+	FilePath       string
+	SiteDirectory  string
+	Mode           string
+	OutDirectory   string
+	Precompress    bool      // Write precompressed files in static mode
+	Strict         bool      // Fail on route conflicts in static mode
+	Watch          string    // File watcher backend in run mode (WatchNotify, WatchPoll or WatchOff)
+	Workers        int       // Files processed in parallel, GOMAXPROCS if 0
+	CacheDirectory string    // Build cache of static builds, "" if they are not cached
+	Server         Server    `yaml:"server"`
+	Branding       Branding  `yaml:"branding"`
+	Plugins        Plugins   `yaml:"plugins"`
+	Languages      Languages `yaml:"languages"`
+	Assets         Assets    `yaml:"assets"`
+	Caching        Caching   `yaml:"caching"`
+	Urls           UrlPolicy `yaml:"urls"`
+	Streaming      Streaming `yaml:"streaming"`
+	Watcher        Watcher   `yaml:"watcher"`
+	Ignore         []string  `yaml:"ignore"` // Patterns of files which are not part of the site, like .gitignore
+
+	FollowSymlinks bool     `yaml:"follow-symlinks"` // Symlinks in the site are followed instead of skipped
+	SymlinkRoots   []string `yaml:"symlink-roots"`   // Directories outside of the site which followed symlinks may point into
 }
 
 func (c *Config) Validate() error {
@@ -177,6 +294,48 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("plugins configuration error: %w", err)
 	}
 
+	// Validate languages configuration
+	if err := c.Languages.Validate(); err != nil {
+		return fmt.Errorf("languages configuration error: %w", err)
+	}
+
+	// Validate assets configuration
+	if err := c.Assets.Validate(); err != nil {
+		return fmt.Errorf("assets configuration error: %w", err)
+	}
+
+	// Validate caching configuration
+	if err := c.Caching.Validate(); err != nil {
+		return fmt.Errorf("caching configuration error: %w", err)
+	}
+
+	// Validate URL configuration
+	if err := c.Urls.Validate(); err != nil {
+		return fmt.Errorf("urls configuration error: %w", err)
+	}
+
+	// Validate streaming configuration
+	if err := c.Streaming.Validate(); err != nil {
+		return fmt.Errorf("streaming configuration error: %w", err)
+	}
+
+	// Validate watcher configuration
+	if err := c.Watcher.Validate(); err != nil {
+		return fmt.Errorf("watcher configuration error: %w", err)
+	}
+
+	// Validate the ignore rules
+	if _, err := NewIgnoreRules(c.Ignore); err != nil {
+		return fmt.Errorf("ignore configuration error: %w", err)
+	}
+
+	// Validate the symlink roots
+	for _, root := range c.SymlinkRoots {
+		if root == "" || !isValidBasePath(root) {
+			return fmt.Errorf("symlink configuration error: %w: root %q", ErrInvalidPath, root)
+		}
+	}
+
 	return nil
 }
 
@@ -251,6 +410,7 @@ type Options struct {
 	Port     int    `short:"p" long:"port" description:"Port to run the HTTP server on" default:"8080"`
 	Hostname string `short:"h" long:"hostname" description:"Hostname of the HTTP server" default:"localhost"`
 	Out      string `short:"o" long:"out" description:"Output directory"`
+	Workers  int    `short:"j" long:"workers" description:"Number of files processed in parallel (default: GOMAXPROCS)"`
 	Help     bool   `long:"help" description:"Display help information"`
 }
 
@@ -267,6 +427,10 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("%w: output directory", ErrInvalidPath)
 	}
 
+	if o.Workers < 0 {
+		return fmt.Errorf("invalid number of workers: %d", o.Workers)
+	}
+
 	return nil
 }
 
@@ -279,23 +443,46 @@ type Commands struct {
 }
 
 type RunCommand struct {
-	Args struct {
+	Watch string `long:"watch" default:"notify" choice:"notify" choice:"poll" choice:"off" description:"How changed files are detected; use poll on network filesystems and bind mounts"`
+	Args  struct {
 		Directory string `positional-arg-name:"directory" description:"Directory to run the server from"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 type StaticCommand struct {
+	Precompress bool `long:"precompress" description:"Also write gzip (.gz) and brotli (.br) compressed files"`
+	Strict      bool `long:"strict" description:"Fail if two files (or redirects) use the same route"`
+	BuildCacheOptions
 	Args struct {
 		Directory string `positional-arg-name:"directory" description:"Directory with source files"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 type DumpCommand struct {
+	BuildCacheOptions
 	Args struct {
 		Directory string `positional-arg-name:"directory" description:"Directory with source files"`
 	} `positional-args:"yes" required:"yes"`
 }
 
+// BuildCacheOptions select the build cache of static builds
+type BuildCacheOptions struct {
+	Cache   string `long:"cache" description:"Directory of the build cache (default: in the user's cache directory)"`
+	NoCache bool   `long:"no-cache" description:"Process all files, and do not keep them for the next build"`
+}
+
+// Returns the cache directory of a build into the output directory, or ""
+// if the build is not cached
+func (o BuildCacheOptions) directory(config *Config) string {
+	if o.NoCache {
+		return ""
+	}
+	if o.Cache != "" {
+		return o.Cache
+	}
+	return DefaultBuildCacheDirectory(config.SiteDirectory, config.OutDirectory)
+}
+
 type VersionCommand struct {
 	Args struct {
 	} `positional-args:"no" required:"no"`
@@ -393,6 +580,7 @@ func ParseCommandLineArguments() (Config, error) {
 	if opts.Out != "" {
 		config.OutDirectory = opts.Out
 	}
+	config.Workers = opts.Workers
 
 	// Handle (and validate) commands
 	if parser.Active != nil {
@@ -400,18 +588,22 @@ func ParseCommandLineArguments() (Config, error) {
 		case "run":
 			config.Mode = "run"
 			config.SiteDirectory = commands.Run.Args.Directory
+			config.Watch = commands.Run.Watch
 			if err := config.validateSiteDirectory(); err != nil {
 				return config, err
 			}
 		case "static":
 			config.Mode = "static"
 			config.SiteDirectory = commands.Static.Args.Directory
+			config.Precompress = commands.Static.Precompress
+			config.Strict = commands.Static.Strict
 			if err := config.validateSiteDirectory(); err != nil {
 				return config, err
 			}
 			if err := config.validateOutDirectory(); err != nil {
 				return config, err
 			}
+			config.CacheDirectory = commands.Static.directory(&config)
 		case "dump":
 			config.Mode = "dump"
 			config.SiteDirectory = commands.Dump.Args.Directory
@@ -421,6 +613,7 @@ func ParseCommandLineArguments() (Config, error) {
 			if err := config.validateOutDirectory(); err != nil {
 				return config, err
 			}
+			config.CacheDirectory = commands.Dump.directory(&config)
 		case "version":
 			config.Mode = "version"
 		default:
@@ -302,6 +302,36 @@ func TestParseCommandLineArguments_StaticCommand(t *testing.T) {
 	}
 }
 
+func TestParseCommandLineArguments_BuildCache(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"explicit cache directory", []string{"program", "-o", "/output", "static", "--cache", "/cache", "/tmp"}, "/cache"},
+		{"disabled cache", []string{"program", "-o", "/output", "static", "--no-cache", "--cache", "/cache", "/tmp"}, ""},
+		{"disabled cache of dump", []string{"program", "-o", "/dump", "dump", "--no-cache", "/tmp"}, ""},
+		{"default cache directory", []string{"program", "-o", "/output", "static", "/tmp"}, DefaultBuildCacheDirectory("/tmp", "/output")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = tt.args
+
+			config, err := ParseCommandLineArguments()
+			if err != nil {
+				t.Fatalf("ParseCommandLineArguments() error = %v", err)
+			}
+			if config.CacheDirectory != tt.expected {
+				t.Errorf("Expected CacheDirectory %q, got %q", tt.expected, config.CacheDirectory)
+			}
+		})
+	}
+}
+
 func TestParseCommandLineArguments_DumpCommand(t *testing.T) {
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -699,3 +729,88 @@ branding:
 		t.Errorf("Expected site directory from command line, got %s", config.SiteDirectory)
 	}
 }
+
+func TestAssets_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		assets  Assets
+		wantErr bool
+	}{
+		{"no bundles", Assets{}, false},
+		{"valid bundle", Assets{Bundles: []AssetBundle{{Name: "all.css", Files: []string{"reset.css", "site.css"}}}}, false},
+		{"nested files", Assets{Bundles: []AssetBundle{{Name: "js/app.js", Files: []string{"js/a.js", "vendor/b.js"}}}}, false},
+		{"empty name", Assets{Bundles: []AssetBundle{{Name: "", Files: []string{"site.css"}}}}, true},
+		{"no files", Assets{Bundles: []AssetBundle{{Name: "all.css"}}}, true},
+		{"mixed types", Assets{Bundles: []AssetBundle{{Name: "all.css", Files: []string{"site.css", "app.js"}}}}, true},
+		{"directory traversal", Assets{Bundles: []AssetBundle{{Name: "all.css", Files: []string{"../secret.css"}}}}, true},
+		{"absolute path", Assets{Bundles: []AssetBundle{{Name: "all.css", Files: []string{"/tmp/site.css"}}}}, true},
+		{"bundle contains itself", Assets{Bundles: []AssetBundle{{Name: "site.css", Files: []string{"site.css"}}}}, true},
+		{"duplicate bundle", Assets{Bundles: []AssetBundle{
+			{Name: "all.css", Files: []string{"a.css"}},
+			{Name: "all.css", Files: []string{"b.css"}},
+		}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.assets.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBranding_ValidateTheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		theme   map[string]string
+		wantErr bool
+	}{
+		{"no theme", nil, false},
+		{"valid variables", map[string]string{"primary-color": "#336699", "font_body": "\"Source Serif Pro\", serif"}, false},
+		{"invalid name", map[string]string{"primary color": "#336699"}, true},
+		{"name starts with digit", map[string]string{"1color": "#336699"}, true},
+		{"closes declaration", map[string]string{"primary-color": "red; } body { display: none"}, true},
+		{"html in value", map[string]string{"primary-color": "</style><script>"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branding := Branding{Theme: tt.theme}
+			err := branding.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCaching_CacheControl(t *testing.T) {
+	tests := []struct {
+		name          string
+		caching       Caching
+		filePath      string
+		fingerprinted bool
+		expected      string
+	}{
+		{"default content", Caching{}, "content/index.html", false, DefaultContentCacheControl},
+		{"default assets", Caching{}, "assets/site.css", false, DefaultAssetsCacheControl},
+		{"default fingerprinted", Caching{}, "assets/site.css", true, DefaultImmutableCacheControl},
+		{"custom content", Caching{Content: "public, max-age=60"}, "content/index.html", false, "public, max-age=60"},
+		{"custom content, default assets", Caching{Content: "public, max-age=60"}, "assets/site.css", false, DefaultAssetsCacheControl},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caching.CacheControl(tt.filePath, tt.fingerprinted); got != tt.expected {
+				t.Errorf("CacheControl() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	invalid := Caching{Assets: "public\r\nSet-Cookie: x=y"}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected error for Cache-Control header with line breaks")
+	}
+}
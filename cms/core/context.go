@@ -2,16 +2,25 @@ package core
 
 import (
 	"path/filepath"
+	"sync"
 )
 
 type Context struct {
 	Users         Users
 	Config        Config
 	Navigation    Navigation
+	Navigations   map[string]Navigation // Per language, empty for monolingual sites
+	Redirects     []Redirect            // From config/redirects.yaml
 	FileManager   *FileManager
 	PluginManager PluginManager
 	FileWatcher   *FileWatcher
 	Logger        *Logger
+
+	// Guards the configuration, the users, the navigation and the redirects
+	// while they are replaced by ReloadConfig. Plugins run on the goroutine
+	// which reloads, only the router has to lock.
+	mu          sync.RWMutex
+	commandLine Config // The configuration before site.yaml was applied
 }
 
 func InitializeContext(ctx *Context) error {
@@ -20,9 +29,26 @@ func InitializeContext(ctx *Context) error {
 	// Initialize logger
 	ctx.Logger = NewLogger(LogLevelInfo)
 
+	// The configuration is reloaded from the same command line options
+	ctx.commandLine = ctx.Config
+	ctx.commandLine.Plugins = make(Plugins)
+
+	err = readConfigFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Register default health checks
+	RegisterDefaultHealthChecks(ctx)
+
+	return nil
+}
+
+// Reads site.yaml, users.yaml, the navigation and the redirects into a context
+func readConfigFiles(ctx *Context) error {
 	// read config.yaml
 	configFilePath := filepath.Join(ctx.Config.SiteDirectory, "config", "site.yaml")
-	err = ReadConfigYaml(&ctx.Config, configFilePath)
+	err := ReadConfigYaml(&ctx.Config, configFilePath)
 	if err != nil {
 		return err
 	}
@@ -40,8 +66,27 @@ func InitializeContext(ctx *Context) error {
 		return err
 	}
 
-	// Register default health checks
-	RegisterDefaultHealthChecks(ctx)
+	// ... and one for each language
+	ctx.Navigations, err = InitializeLocalizedNavigation(ctx)
+	if err != nil {
+		return err
+	}
+
+	// read redirects.yaml (if it exists)
+	redirectsFilePath := filepath.Join(ctx.Config.SiteDirectory, "config", "redirects.yaml")
+	ctx.Redirects, err = ReadRedirectsYaml(redirectsFilePath)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// Returns the navigation for a language, or the default navigation if the
+// language has none
+func (ctx *Context) NavigationFor(lang string) Navigation {
+	if navigation, exists := ctx.Navigations[lang]; exists {
+		return navigation
+	}
+	return ctx.Navigation
+}
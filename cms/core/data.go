@@ -0,0 +1,188 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+)
+
+// Files in the data directory (e.g. "data/products.csv") are parsed into
+// nested maps and made available to templates as .Site.Data.<name>. Files
+// in subdirectories are nested accordingly, i.e. "data/shop/products.yaml"
+// becomes .Site.Data.shop.products.
+
+// Returns true if the file is a data file with a supported format
+func IsDataFile(filePath string) bool {
+	if !strings.HasPrefix(filePath, "data/") {
+		return false
+	}
+
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".yaml", ".yml", ".json", ".toml", ".csv":
+		return true
+	}
+	return false
+}
+
+// Returns the name of a data file, relative to the data directory and
+// without extension, e.g. "data/shop/products.csv" becomes "shop/products"
+func DataName(filePath string) string {
+	name := strings.TrimPrefix(filePath, "data/")
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// Parses the content of a data file. Maps are returned as map[string]any,
+// CSV files as a list of rows; each row maps the column names (from the
+// first line) to the values.
+func ParseData(filePath string, content []byte) (any, error) {
+	var data any
+
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	case ".toml":
+		table := make(map[string]any)
+		if _, err := toml.Decode(string(content), &table); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML: %w", err)
+		}
+		data = table
+	case ".csv":
+		rows, err := parseCsv(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		data = rows
+	default:
+		return nil, fmt.Errorf("unsupported data file %s", filePath)
+	}
+
+	return data, nil
+}
+
+func parseCsv(content []byte) ([]map[string]any, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []map[string]any{}, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]any, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, column := range header {
+			row[strings.TrimSpace(column)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Returns the data below a name (relative to the data directory), and the
+// files it was read from. The name either refers to a single file (e.g.
+// "products" for "data/products.csv") or to a directory (e.g. "shop"), whose
+// files are returned as a nested map. An empty name returns all data.
+// Files which cannot be parsed are logged and skipped, but still returned,
+// so that pages are re-rendered once they are fixed.
+func (fm *FileManager) LoadData(name string) (any, []*File) {
+	var files []*File
+	for filePath, file := range fm.GetAllFiles() {
+		if !IsDataFile(filePath) {
+			continue
+		}
+		dataName := DataName(filePath)
+		if name == "" || dataName == name || strings.HasPrefix(dataName, name+"/") {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	// A single file is returned as is, a directory as a map
+	if len(files) == 1 && DataName(files[0].Path) == name {
+		data, err := fm.parseDataFile(files[0])
+		if err != nil {
+			log.Printf("Failed to load data file %s: %v", files[0].Path, err)
+		}
+		return data, files
+	}
+
+	root := make(map[string]any)
+	for _, file := range files {
+		data, err := fm.parseDataFile(file)
+		if err != nil {
+			log.Printf("Failed to load data file %s: %v", file.Path, err)
+			continue
+		}
+
+		relative := strings.TrimPrefix(DataName(file.Path), name)
+		parts := strings.Split(strings.TrimPrefix(relative, "/"), "/")
+		node := root
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				node[part] = child
+			}
+			node = child
+		}
+
+		key := parts[len(parts)-1]
+		if _, exists := node[key]; exists {
+			log.Printf("Warning: data file %s is shadowed by another file with the same name", file.Path)
+			continue
+		}
+		node[key] = data
+	}
+	return root, files
+}
+
+// Returns the parsed content of a data file. The result is cached until the
+// file is modified.
+func (fm *FileManager) parseDataFile(file *File) (any, error) {
+	fm.mu.RLock()
+	data, cached := fm.data[file.Path]
+	fm.mu.RUnlock()
+	if cached {
+		return data, nil
+	}
+
+	content, err := os.ReadFile(file.DiskPath(fm.SiteDirectory))
+	if err != nil {
+		return nil, err
+	}
+	data, err = ParseData(file.Path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	fm.mu.Lock()
+	if fm.data == nil {
+		fm.data = make(map[string]any)
+	}
+	fm.data[file.Path] = data
+	fm.mu.Unlock()
+	return data, nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeDataFile(t *testing.T, siteDir, name, content string) {
+	t.Helper()
+	fullPath := filepath.Join(siteDir, "data", name)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func TestIsDataFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"data/products.csv", true},
+		{"data/shop/products.yaml", true},
+		{"data/settings.YML", true},
+		{"data/prices.json", true},
+		{"data/specs.toml", true},
+		{"data/readme.txt", false},
+		{"content/products.csv", false},
+		{"config/site.yaml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := IsDataFile(tt.path); got != tt.expected {
+				t.Errorf("IsDataFile(%s) = %v, expected %v", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseData(t *testing.T) {
+	tests := []struct {
+		path    string
+		content string
+	}{
+		{"data/product.yaml", "name: Kettlebell\nprice: 49.90\n"},
+		{"data/product.json", `{"name": "Kettlebell", "price": 49.90}`},
+		{"data/product.toml", "name = \"Kettlebell\"\nprice = 49.90\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := ParseData(tt.path, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("ParseData failed: %v", err)
+			}
+			product, ok := data.(map[string]any)
+			if !ok {
+				t.Fatalf("Expected map[string]any, got %T", data)
+			}
+			if product["name"] != "Kettlebell" {
+				t.Errorf("Expected name Kettlebell, got %v", product["name"])
+			}
+		})
+	}
+
+	data, err := ParseData("data/products.csv", []byte("name, price\nKettlebell,49.90\nE-Book,9.99\n"))
+	if err != nil {
+		t.Fatalf("ParseData failed for CSV: %v", err)
+	}
+	rows, ok := data.([]map[string]any)
+	if !ok || len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", data)
+	}
+	if rows[1]["name"] != "E-Book" || rows[1]["price"] != "9.99" {
+		t.Errorf("Unexpected second row %v", rows[1])
+	}
+
+	if _, err := ParseData("data/broken.json", []byte("{")); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+	if _, err := ParseData("data/broken.csv", []byte("a,b\n1\n")); err == nil {
+		t.Error("Expected error for CSV with missing columns")
+	}
+}
+
+func TestLoadData(t *testing.T) {
+	siteDir := t.TempDir()
+	writeDataFile(t, siteDir, "products.csv", "name,price\nKettlebell,49.90\n")
+	writeDataFile(t, siteDir, "shop/shipping.yaml", "countries: [de, at]\n")
+	writeDataFile(t, siteDir, "shop/vat.json", `{"rate": 19}`)
+
+	fm := NewFileManager(siteDir)
+	if err := fm.WalkDirectory("data"); err != nil {
+		t.Fatalf("WalkDirectory failed: %v", err)
+	}
+
+	// A single file
+	data, files := fm.LoadData("products")
+	if len(files) != 1 || files[0].Path != "data/products.csv" {
+		t.Fatalf("Expected data/products.csv, got %v", files)
+	}
+	if rows, ok := data.([]map[string]any); !ok || rows[0]["price"] != "49.90" {
+		t.Errorf("Unexpected products %v", data)
+	}
+
+	// A directory
+	data, files = fm.LoadData("shop")
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files for shop, got %d", len(files))
+	}
+	shop, ok := data.(map[string]any)
+	if !ok || shop["shipping"] == nil || shop["vat"] == nil {
+		t.Errorf("Expected shipping and vat in shop, got %v", data)
+	}
+
+	// Everything
+	data, files = fm.LoadData("")
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 data files, got %d", len(files))
+	}
+	if all, ok := data.(map[string]any); !ok || all["products"] == nil || all["shop"] == nil {
+		t.Errorf("Expected products and shop, got %v", data)
+	}
+
+	// Unknown names
+	if data, files := fm.LoadData("unknown"); data != nil || files != nil {
+		t.Errorf("Expected no data for unknown name, got %v", data)
+	}
+
+	// Modified files are parsed again
+	writeDataFile(t, siteDir, "products.csv", "name,price\nKettlebell,59.90\n")
+	fm.AddFile("data/products.csv")
+	data, _ = fm.LoadData("products")
+	if rows := data.([]map[string]any); rows[0]["price"] != "59.90" {
+		t.Errorf("Expected updated price, got %v", rows[0]["price"])
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Editors write a file with several operations, and a "git checkout" touches
+// hundreds of files at once. The events of the file watcher are therefore
+// collected until no new event arrives for the debounce window, coalesced
+// per path, and applied as one batch.
+
+// Debounce window, unless configured otherwise
+const DefaultDebounce = 50 * time.Millisecond
+
+// A batch is applied at the latest after this many windows, even if events
+// keep arriving
+const maxDebounceWindows = 20
+
+type Watcher struct {
+	Debounce      time.Duration `yaml:"debounce"`       // e.g. "200ms", DefaultDebounce if not specified
+	RedirectMoves bool          `yaml:"redirect-moves"` // Pages which are moved redirect from their old URL
+	PollInterval  time.Duration `yaml:"poll-interval"`  // With "--watch=poll", DefaultPollInterval if not specified
+}
+
+func (w *Watcher) Validate() error {
+	if w.Debounce < 0 {
+		return fmt.Errorf("invalid debounce %s", w.Debounce)
+	}
+	if w.PollInterval < 0 {
+		return fmt.Errorf("invalid poll interval %s", w.PollInterval)
+	}
+	return nil
+}
+
+// The first and the last event of a path in the current window
+type pendingEvent struct {
+	first FileWatchEvent
+	last  FileWatchEvent
+}
+
+// eventBatch coalesces the events of a debounce window per path
+type eventBatch struct {
+	pending map[string]*pendingEvent
+	started time.Time // time of the first event
+}
+
+func newEventBatch() *eventBatch {
+	return &eventBatch{pending: make(map[string]*pendingEvent)}
+}
+
+func (b *eventBatch) add(event FileWatchEvent) {
+	if len(b.pending) == 0 {
+		b.started = time.Now()
+	}
+	if event.Type == FileRenamed && event.OldPath != "" {
+		b.addMove(event)
+		return
+	}
+	if p, exists := b.pending[event.Path]; exists {
+		p.last = event
+		return
+	}
+	b.pending[event.Path] = &pendingEvent{first: event, last: event}
+}
+
+// Adds a move. It replaces the events of the old path: a path which was
+// created in this window is created at the new path instead, and a path which
+// was moved here already is moved from its original path.
+func (b *eventBatch) addMove(event FileWatchEvent) {
+	if p, exists := b.pending[event.OldPath]; exists {
+		delete(b.pending, event.OldPath)
+		switch p.first.Type {
+		case FileCreated, DirCreated:
+			event.Type, event.OldPath = p.first.Type, ""
+		case FileRenamed:
+			event.OldPath = p.first.OldPath
+		}
+	}
+
+	// The events of the files in a moved directory follow the directory
+	if event.IsDir {
+		prefix := event.OldPath + string(filepath.Separator)
+		for path, p := range b.pending {
+			if rest, found := strings.CutPrefix(path, prefix); found {
+				delete(b.pending, path)
+				p.first.Path = filepath.Join(event.Path, rest)
+				p.last.Path = p.first.Path
+				b.pending[p.first.Path] = p
+			}
+		}
+	}
+
+	b.pending[event.Path] = &pendingEvent{first: event, last: event}
+}
+
+func (b *eventBatch) empty() bool {
+	return len(b.pending) == 0
+}
+
+// Returns one event per path, which leads from the state before the first
+// event to the state after the last one, and resets the batch. Deletions come
+// first, so that a path which is replaced (e.g. a file by a directory) is
+// free again, then moves, so that a new file at the old path of a moved file
+// is not taken for it. The events are sorted by path otherwise.
+func (b *eventBatch) flush() []FileWatchEvent {
+	events := make([]FileWatchEvent, 0, len(b.pending))
+	for _, p := range b.pending {
+		event, ok := p.coalesce()
+		if !ok {
+			continue
+		}
+
+		// A move whose old path is the target of another move (e.g. two
+		// files which swapped their names) cannot be applied one after the
+		// other, both paths are created instead
+		if event.Type == FileRenamed && event.OldPath != "" {
+			if other, exists := b.pending[event.OldPath]; exists && other.first.Type == FileRenamed && !other.last.isDeletion() {
+				event.Type, event.OldPath = FileCreated, ""
+				if event.IsDir {
+					event.Type = DirCreated
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	b.pending = make(map[string]*pendingEvent)
+
+	order := func(event FileWatchEvent) int {
+		switch {
+		case event.isDeletion():
+			return 0
+		case event.Type == FileRenamed:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		oi, oj := order(events[i]), order(events[j])
+		if oi != oj {
+			return oi < oj
+		}
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
+
+// Coalesces the events of a path. Returns false if nothing changed, i.e. the
+// path was created and deleted again within the window.
+func (p *pendingEvent) coalesce() (FileWatchEvent, bool) {
+	existedBefore := p.first.Type != FileCreated && p.first.Type != DirCreated
+	existsAfter := !p.last.isDeletion()
+
+	event := p.last
+	switch {
+	case !existedBefore && !existsAfter:
+		return FileWatchEvent{}, false
+	case !existedBefore:
+		event.Type = FileCreated
+		if event.IsDir {
+			event.Type = DirCreated
+		}
+	case !existsAfter:
+		// The type is taken from the last event, which knows whether the
+		// path was a directory. A moved path is deleted at its old path.
+		if p.first.Type == FileRenamed && p.first.OldPath != "" {
+			event.Path, event.OldPath = p.first.OldPath, ""
+		}
+	case p.first.Type == FileRenamed && p.first.OldPath == event.Path:
+		// Moved back to where it was
+		event.Type, event.OldPath = FileModified, ""
+		if event.IsDir {
+			event.Type = DirCreated
+		}
+	case p.first.Type == FileRenamed:
+		event.Type, event.OldPath, event.IsDir = FileRenamed, p.first.OldPath, p.first.IsDir
+	case event.IsDir:
+		// A replaced directory is walked again
+		event.Type = DirCreated
+	case p.last.Type == FileRenamed:
+		event.Type = FileRenamed
+	default:
+		// e.g. an editor which deletes and recreates a file when saving
+		event.Type = FileModified
+	}
+	return event, true
+}
+
+func (e FileWatchEvent) isDeletion() bool {
+	return e.Type == FileDeleted || e.Type == DirDeleted
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBatchCoalesce(t *testing.T) {
+	event := func(eventType FileWatchEventType, path string) FileWatchEvent {
+		return FileWatchEvent{Type: eventType, Path: path, IsDir: eventType == DirCreated || eventType == DirDeleted}
+	}
+
+	tests := []struct {
+		name     string
+		events   []FileWatchEventType
+		expected FileWatchEventType
+		dropped  bool
+	}{
+		{"repeated writes", []FileWatchEventType{FileModified, FileModified, FileModified}, FileModified, false},
+		{"created and written", []FileWatchEventType{FileCreated, FileModified}, FileCreated, false},
+		{"created and deleted", []FileWatchEventType{FileCreated, FileModified, FileDeleted}, 0, true},
+		{"deleted and recreated", []FileWatchEventType{FileDeleted, FileCreated}, FileModified, false},
+		{"written and deleted", []FileWatchEventType{FileModified, FileDeleted}, FileDeleted, false},
+		{"directory replaced", []FileWatchEventType{DirDeleted, DirCreated}, DirCreated, false},
+		{"directory created and deleted", []FileWatchEventType{DirCreated, DirDeleted}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := newEventBatch()
+			for _, eventType := range tt.events {
+				batch.add(event(eventType, "content/a.md"))
+			}
+
+			events := batch.flush()
+			if tt.dropped {
+				assert.Empty(t, events)
+			} else {
+				require.Len(t, events, 1)
+				assert.Equal(t, tt.expected, events[0].Type)
+			}
+			assert.True(t, batch.empty())
+		})
+	}
+
+	// Deletions come first, then the events are sorted by path
+	batch := newEventBatch()
+	batch.add(event(FileModified, "content/b.md"))
+	batch.add(event(FileCreated, "content/a.md"))
+	batch.add(event(FileDeleted, "content/c.md"))
+	events := batch.flush()
+	require.Len(t, events, 3)
+	assert.Equal(t, []string{"content/c.md", "content/a.md", "content/b.md"},
+		[]string{events[0].Path, events[1].Path, events[2].Path})
+}
+
+func TestEventBatchMoves(t *testing.T) {
+	move := func(oldPath, path string) FileWatchEvent {
+		return FileWatchEvent{Type: FileRenamed, Path: path, OldPath: oldPath}
+	}
+	describe := func(events []FileWatchEvent) []string {
+		described := make([]string, len(events))
+		for i, event := range events {
+			described[i] = fmt.Sprintf("%s %s", event.Type, event.Path)
+			if event.OldPath != "" {
+				described[i] += " from " + event.OldPath
+			}
+		}
+		return described
+	}
+
+	tests := []struct {
+		name     string
+		events   []FileWatchEvent
+		expected []string
+	}{
+		{"moved and written",
+			[]FileWatchEvent{move("content/a.md", "content/b.md"), {Type: FileModified, Path: "content/b.md"}},
+			[]string{"FileRenamed content/b.md from content/a.md"}},
+		{"written and moved",
+			[]FileWatchEvent{{Type: FileModified, Path: "content/a.md"}, move("content/a.md", "content/b.md")},
+			[]string{"FileRenamed content/b.md from content/a.md"}},
+		{"created and moved",
+			[]FileWatchEvent{{Type: FileCreated, Path: "content/a.md"}, move("content/a.md", "content/b.md")},
+			[]string{"FileCreated content/b.md"}},
+		{"moved twice",
+			[]FileWatchEvent{move("content/a.md", "content/b.md"), move("content/b.md", "content/c.md")},
+			[]string{"FileRenamed content/c.md from content/a.md"}},
+		{"moved back",
+			[]FileWatchEvent{move("content/a.md", "content/b.md"), move("content/b.md", "content/a.md")},
+			[]string{"FileModified content/a.md"}},
+		{"moved and deleted",
+			[]FileWatchEvent{move("content/a.md", "content/b.md"), {Type: FileDeleted, Path: "content/b.md"}},
+			[]string{"FileDeleted content/a.md"}},
+		{"moved and replaced",
+			[]FileWatchEvent{move("content/a.md", "content/b.md"), {Type: FileCreated, Path: "content/a.md"}},
+			[]string{"FileRenamed content/b.md from content/a.md", "FileCreated content/a.md"}},
+		{"swapped",
+			[]FileWatchEvent{move("content/a.md", "content/t.md"), move("content/b.md", "content/a.md"), move("content/t.md", "content/b.md")},
+			[]string{"FileCreated content/a.md", "FileCreated content/b.md"}},
+		{"directory moved after a write",
+			[]FileWatchEvent{{Type: FileModified, Path: "content/blog/a.md"}, {Type: FileRenamed, Path: "content/notes", OldPath: "content/blog", IsDir: true}},
+			[]string{"FileRenamed content/notes from content/blog", "FileModified content/notes/a.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := newEventBatch()
+			for _, event := range tt.events {
+				batch.add(event)
+			}
+			assert.Equal(t, tt.expected, describe(batch.flush()))
+		})
+	}
+}
+
+func TestWatcherValidate(t *testing.T) {
+	assert.NoError(t, (&Watcher{}).Validate())
+	assert.NoError(t, (&Watcher{Debounce: 200 * time.Millisecond}).Validate())
+	assert.Error(t, (&Watcher{Debounce: -time.Second}).Validate())
+}
+
+func TestDebouncedBatch(t *testing.T) {
+	fm, fw, mockRM, tempDir := createListenerTestEnv(t)
+	fw.SetDebounce(200 * time.Millisecond)
+
+	require.NoError(t, fw.Start(tempDir))
+	defer fw.Stop()
+
+	fwl, err := RegisterFileWatcherListener(fw)
+	require.NoError(t, err)
+	defer fwl.Stop()
+
+	time.Sleep(100 * time.Millisecond) // Give the watcher time to set up
+
+	// Several writes of the same file and several new files within the window
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(tempDir, "content", fmt.Sprintf("page-%d.md", i%2))
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("# Version %d", i)), 0644))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Nothing is applied before the window has passed
+	assert.Empty(t, mockRM.GetAddedFiles())
+
+	time.Sleep(500 * time.Millisecond)
+
+	added := mockRM.GetAddedFiles()
+	paths := make([]string, len(added))
+	for i, file := range added {
+		paths[i] = file.Path
+	}
+	assert.ElementsMatch(t, []string{"content/page-0.md", "content/page-1.md"}, paths)
+	assert.Equal(t, 0, mockRM.GetRebuildCount())
+	assert.NotNil(t, fm.GetFile("content/page-0.md"))
+	assert.NotNil(t, fm.GetFile("content/page-1.md"))
+}
@@ -22,6 +22,7 @@ var (
 	ErrRouteNotFound     = errors.New("route not found")
 	ErrRouteExists       = errors.New("route already exists")
 	ErrInvalidRoute      = errors.New("invalid route")
+	ErrRouteConflict     = errors.New("route conflict")
 
 	// File watcher errors
 	ErrWatcherNotRunning = errors.New("file watcher not running")
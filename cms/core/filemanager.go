@@ -5,8 +5,13 @@ import (
 	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adrg/frontmatter"
 )
 
 // File represents a file with dependency tracking
@@ -25,6 +30,52 @@ type File struct {
 
 	// Additional metadata about the File
 	Metadata FileMetadata
+
+	// Files generated by plugins (e.g. resized images), keyed by their route
+	OutputFiles map[string][]byte
+
+	// Hash of the processed content (used as ETag), and the time when the
+	// content last changed
+	ContentHash string
+	ModTime     time.Time
+
+	// Precompressed content and output files (keyed by their route)
+	Compressed            Encodings
+	CompressedOutputFiles map[string]Encodings
+
+	// Hashes of the output files (used as their ETags), keyed by their route
+	OutputHashes map[string]string
+
+	// Large files are streamed from disk instead of being kept in Content
+	Streamed bool
+
+	// Modification time and size of the file on disk when it was added, to
+	// find changes which the file watcher missed
+	SourceModTime time.Time
+	SourceSize    int64
+
+	// Hash of the file on disk ("" until it is processed again after it
+	// changed), and of everything the processed file is built from (see
+	// changes.go)
+	SourceHash string
+	InputHash  string
+
+	// Path on disk of a file behind a symlink, which it is read from; empty
+	// for other files
+	ResolvedPath string
+
+	// Routes of the file before it was moved, which redirect to it
+	MovedFrom []string
+
+	// Language code of the file (empty for monolingual sites), and the
+	// path which is shared by all translations of this file
+	Language       string
+	TranslationKey string
+
+	// Frontmatter of a page in a multilingual site, read when the file is
+	// added. Metadata is only set when the page is processed, but pages link
+	// to their translations before these are processed.
+	Frontmatter FileMetadata
 }
 
 // Directory represents a directory that can contain files and subdirectories
@@ -46,6 +97,13 @@ type FileManager struct {
 	Files         map[string]*File // Global file lookup by full path
 	SiteDirectory string
 	pluginManager *PluginManager // Plugin system for file processing
+	languages     Languages      // Languages used to split content files
+	streaming     Streaming      // Which files are streamed from disk
+	data          map[string]any // Parsed data files, keyed by their path
+	ignore        atomic.Pointer[IgnoreRules]
+	symlinks      atomic.Pointer[symlinkRoots] // nil if symlinks are skipped
+	workers       int                          // Files processed in parallel, see process.go
+	processed     map[string]*File             // Last processed version of each file, see changes.go
 }
 
 // NewFileManager creates a new file manager with root directory
@@ -63,17 +121,27 @@ func NewFileManager(siteDirectory string) *FileManager {
 		Files:         make(map[string]*File),
 		pluginManager: NewPluginManager(),
 		SiteDirectory: siteDirectory,
+		data:          make(map[string]any),
+		processed:     make(map[string]*File),
 	}
 }
 
 // Do we need to invoke Plugins on this File?
 func (f *File) NeedsUpdate() bool {
-	return f.Content == nil
+	return f.Content == nil && !f.Streamed
+}
+
+// Returns the path on disk which the file is read from
+func (f *File) DiskPath(siteDirectory string) string {
+	if f.ResolvedPath != "" {
+		return f.ResolvedPath
+	}
+	return filepath.Join(siteDirectory, f.Path)
 }
 
 // Read the file data from disk, or nil in case of error
 func (f *File) ReadFile(siteDirectory string) []byte {
-	path := filepath.Join(siteDirectory, f.Path)
+	path := f.DiskPath(siteDirectory)
 	body, err := os.ReadFile(path)
 	if err != nil {
 		log.Printf("failed to read file %s: %v", path, err)
@@ -102,6 +170,7 @@ func (f *File) markForUpdateRecursive(visited map[string]bool) {
 
 	visited[f.Path] = true
 	f.Content = nil // Trigger update
+	f.Streamed = false
 
 	// Mark all dependents
 	for _, dep := range f.Dependents {
@@ -114,55 +183,121 @@ func (fm *FileManager) GetPluginManager() *PluginManager {
 	return fm.pluginManager
 }
 
+// Sets the site languages and assigns a language to all known files (thread-safe)
+func (fm *FileManager) SetLanguages(languages Languages) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.languages = languages
+	for _, file := range fm.Files {
+		fm.assignLanguage(file)
+		fm.readFrontmatter(file)
+	}
+}
+
+// Sets which files are streamed from disk (thread-safe)
+func (fm *FileManager) SetStreaming(streaming Streaming) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.streaming = streaming
+}
+
+// Assigns language and translation key to a file (assumes lock is held)
+func (fm *FileManager) assignLanguage(file *File) {
+	file.Language, file.TranslationKey = fm.languages.Split(file.Path)
+}
+
+// Reads the frontmatter of a page which has a language (assumes lock is held)
+func (fm *FileManager) readFrontmatter(file *File) {
+	file.Frontmatter = FileMetadata{}
+	if file.Language == "" || !isPage(file.Path) {
+		return
+	}
+
+	source, err := os.Open(file.DiskPath(fm.SiteDirectory))
+	if err != nil {
+		return
+	}
+	defer source.Close()
+
+	// Pages without frontmatter are fine
+	frontmatter.Parse(source, &file.Frontmatter)
+}
+
+// Returns true for the HTML and Markdown files in the content directory
+func isPage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".md":
+		return strings.HasPrefix(path, "content/")
+	}
+	return false
+}
+
+// Returns all translations of a file, including the file itself (thread-safe)
+func (fm *FileManager) GetTranslations(file *File) []*File {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.getTranslationsUnsafe(file)
+}
+
+// Returns all translations of a file (assumes lock is held)
+func (fm *FileManager) getTranslationsUnsafe(file *File) []*File {
+	var translations []*File
+	if file.Language == "" {
+		return translations
+	}
+
+	for _, other := range fm.Files {
+		if other.TranslationKey == file.TranslationKey && other.Language != "" {
+			translations = append(translations, other)
+		}
+	}
+	return translations
+}
+
+// Marks the other translations of a file for update, because they link to
+// it (assumes lock is held)
+func (fm *FileManager) markTranslationsForUpdate(file *File) {
+	for _, other := range fm.getTranslationsUnsafe(file) {
+		if other != file {
+			other.MarkForUpdate()
+		}
+	}
+}
+
 // Processes all files with their applicable plugins (thread-safe)
 func (fm *FileManager) ProcessAllFiles() {
 	timer := NewFileProcessingTimer()
 	defer timer.ObserveDuration()
 
 	fm.mu.RLock()
-	files := make(map[string]*File, len(fm.Files))
-	maps.Copy(files, fm.Files)
+	files := slices.Collect(maps.Values(fm.Files))
 	fm.mu.RUnlock()
 
 	// process outside locks (plugin code may be slow)
-	for path, file := range files {
-		newFile := fm.pluginManager.Process(*file, fm)
-		// write back under write lock
-		fm.mu.Lock()
-		fm.Files[path] = newFile
-		fm.mu.Unlock()
-	}
+	fm.processFiles(files)
 
 	// Update file count metric
 	SetFilesCount(int64(len(files)))
 }
 
-// Processes all files which need to be updated (e.g. because they were modified)
-func (fm *FileManager) ProcessUpdatedFiles() {
+// Processes all files which need to be updated (e.g. because they were modified),
+// and returns the processed files
+func (fm *FileManager) ProcessUpdatedFiles() []*File {
 	// collect targets under read lock
-	type upd struct {
-		path string
-		file *File
-	}
-	var toUpdate []upd
+	var toUpdate []*File
 
 	fm.mu.RLock()
-	for path, file := range fm.Files {
+	for _, file := range fm.Files {
 		if file.NeedsUpdate() {
-			// capture path and pointer
-			toUpdate = append(toUpdate, upd{path: path, file: file})
+			toUpdate = append(toUpdate, file)
 		}
 	}
 	fm.mu.RUnlock()
 
 	// process outside locks (plugin code may be slow)
-	for _, u := range toUpdate {
-		newFile := fm.pluginManager.Process(*u.file, fm)
-		// write back under write lock
-		fm.mu.Lock()
-		fm.Files[u.path] = newFile
-		fm.mu.Unlock()
-	}
+	return fm.processFiles(toUpdate)
 }
 
 // GetRoot returns the root directory (thread-safe)
@@ -173,6 +308,10 @@ func (fm *FileManager) GetRoot() *Directory {
 }
 
 func (fm *FileManager) findDirectoryRecursive(dir *Directory, path []string) *Directory {
+	// The directory does not exist, e.g. its parent was removed already
+	if dir == nil {
+		return nil
+	}
 	if len(path) == 0 || (len(path) == 1 && path[0] == "" || path[0] == ".") {
 		return dir
 	}
@@ -243,26 +382,27 @@ func (fm *FileManager) WalkDirectory(rootPath string) error {
 	defer fm.mu.Unlock()
 
 	absRootPath := filepath.Join(fm.SiteDirectory, rootPath)
-	return filepath.Walk(absRootPath, func(path string, info os.FileInfo, err error) error {
+	return fm.walkSite(absRootPath, func(entry siteEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
-		// Skip hidden files and directories (starting with .)
-		if IgnoreFile(info.Name(), info) {
-			if info.IsDir() {
-				return filepath.SkipDir // Skip entire hidden directory
-			}
-			return nil // Skip hidden file
-		}
+		info := entry.info
 
 		// Convert absolute path to relative path from siteDirectory,
 		// e.g. "/content/posts/my-post.md")
-		relPath, err := filepath.Rel(fm.SiteDirectory, path)
+		relPath, err := filepath.Rel(fm.SiteDirectory, entry.path)
 		if err != nil {
 			return err
 		}
 
+		// Skip ignored files and directories (e.g. starting with .)
+		if fm.Ignored(relPath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir // Skip entire ignored directory
+			}
+			return nil // Skip ignored file
+		}
+
 		if info.IsDir() {
 			// Create directory structure
 			fm.createDirectory(relPath)
@@ -277,16 +417,26 @@ func (fm *FileManager) WalkDirectory(rootPath string) error {
 				parentDir = fm.root
 			}
 
+			// Keep files which are already known, other files depend on them
+			if _, exists := fm.Files[relPath]; exists {
+				return nil
+			}
+
 			// Add file to manager
 			fileName := filepath.Base(relPath)
 			file := &File{
-				Name:         fileName,
-				Path:         relPath,
-				Parent:       parentDir,
-				Content:      nil,
-				Dependencies: make(map[string]*File),
-				Dependents:   make(map[string]*File),
+				Name:          fileName,
+				Path:          relPath,
+				Parent:        parentDir,
+				Content:       nil,
+				Dependencies:  make(map[string]*File),
+				Dependents:    make(map[string]*File),
+				SourceModTime: info.ModTime(),
+				SourceSize:    info.Size(),
+				ResolvedPath:  entry.resolved,
 			}
+			fm.assignLanguage(file)
+			fm.readFrontmatter(file)
 
 			fm.Files[relPath] = file
 			parentDir.Files[fileName] = file
@@ -320,6 +470,7 @@ func (fm *FileManager) RemoveDirectory(rootPath string) {
 
 			// Remove from global files map
 			delete(fm.Files, path)
+			fm.pluginManager.RemoveFile(path)
 		}
 	}
 
@@ -366,14 +517,32 @@ func (fm *FileManager) AddFile(path string) *File {
 			Dependencies: make(map[string]*File),
 			Dependents:   make(map[string]*File),
 		}
+		fm.assignLanguage(file)
 		fm.Files[cleanPath] = file
 		parentDir.Files[fileName] = file
 	}
 
+	fm.statSource(file)
+	fm.readFrontmatter(file)
+
+	delete(fm.data, cleanPath)
 	file.MarkForUpdate()
+	fm.markTranslationsForUpdate(file)
 	return file
 }
 
+// Updates the modification time, size and resolved path of a file from disk,
+// and forgets the hash of its source (assumes lock is held)
+func (fm *FileManager) statSource(file *File) {
+	entry, err := fm.statSite(filepath.Join(fm.SiteDirectory, file.Path))
+	if err != nil {
+		return
+	}
+	file.SourceModTime, file.SourceSize = entry.info.ModTime(), entry.info.Size()
+	file.ResolvedPath = entry.resolved
+	file.SourceHash = ""
+}
+
 // Removes a file from the manager (thread-safe)
 func (fm *FileManager) RemoveFile(path string) {
 	file := fm.GetFile(path)
@@ -408,13 +577,18 @@ func (fm *FileManager) RemoveFile(path string) {
 		delete(fm.Files, cleanPath)
 		delete(parentDir.Files, fileName)
 	}
+	delete(fm.data, cleanPath)
+	delete(fm.processed, cleanPath)
 
 	// Remove this file from dependencies of other files, and mark them all for update
 	file.MarkForUpdate()
+	fm.markTranslationsForUpdate(file)
 	for _, f := range fm.Files {
 		delete(f.Dependencies, cleanPath)
 		delete(f.Dependents, cleanPath)
 	}
+
+	fm.pluginManager.RemoveFile(cleanPath)
 }
 
 // GetFile returns a file by its full path (thread-safe)
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -18,6 +19,7 @@ type RouterInterface interface {
 	AddFile(file *File)
 	RemoveFile(filePath string) error
 	RebuildRouter() error
+	UpdateFiles(removed []string, added []*File)
 }
 
 // FileWatcher watches filesystem changes and updates the FileManager accordingly
@@ -25,7 +27,7 @@ type FileWatcher struct {
 	mu          sync.RWMutex
 	rm          RouterInterface
 	fm          *FileManager
-	watcher     *fsnotify.Watcher
+	backend     WatchBackend
 	watchedDirs map[string]bool // Track which directories are being watched
 	rootPath    string          // Root path being watched
 	running     bool
@@ -33,6 +35,26 @@ type FileWatcher struct {
 	cancel      context.CancelFunc
 	eventChan   chan FileWatchEvent
 	wg          sync.WaitGroup
+	debounce    time.Duration // Window in which the listener coalesces events
+
+	// Lost events, and the rescan of the site which replaces them
+	resyncChan    chan struct{}
+	resyncPending bool
+	resyncErr     error // Error of the last rescan
+	lostEvents    int
+	lastLoss      time.Time
+
+	// Renamed paths which wait for the Create event of their new path; only
+	// used by processWatcherEvents
+	renames       []pendingRename
+	redirectMoves bool // Moved pages redirect from their old route
+
+	configReloader ConfigReloader // Replaces the configuration, see reload.go
+
+	// Symlinked files are watched in the directory of their target, see
+	// watchLinkedFile
+	linkedFiles map[string][]string // Paths of the links by resolved path
+	targetDirs  map[string]bool     // Directories watched for linked files
 }
 
 // FileWatchEventType represents the type of file system event
@@ -76,26 +98,43 @@ type FileWatchEvent struct {
 	Time    time.Time
 }
 
-// Creates a new file watcher
+// Creates a new file watcher, which uses the notifications of the operating
+// system
 func NewFileWatcher(fm *FileManager) (*FileWatcher, error) {
 	if fm == nil {
 		return nil, fmt.Errorf("file manager cannot be nil")
 	}
 
-	watcher, err := fsnotify.NewWatcher()
+	backend, err := NewNotifyBackend()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create fsnotify watcher: %w", err)
+		return nil, err
+	}
+	return NewFileWatcherWithBackend(fm, backend)
+}
+
+// Creates a new file watcher with the given backend, which is closed when
+// the watcher is stopped
+func NewFileWatcherWithBackend(fm *FileManager, backend WatchBackend) (*FileWatcher, error) {
+	if fm == nil {
+		return nil, fmt.Errorf("file manager cannot be nil")
+	}
+	if backend == nil {
+		return nil, fmt.Errorf("file watcher backend cannot be nil")
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &FileWatcher{
 		fm:          fm,
-		watcher:     watcher,
+		backend:     backend,
 		watchedDirs: make(map[string]bool),
+		linkedFiles: make(map[string][]string),
+		targetDirs:  make(map[string]bool),
 		ctx:         ctx,
 		cancel:      cancel,
 		eventChan:   make(chan FileWatchEvent, 100),
+		debounce:    DefaultDebounce,
+		resyncChan:  make(chan struct{}, 1),
 	}, nil
 }
 
@@ -103,17 +142,30 @@ func (fw *FileWatcher) SetRouter(rm RouterInterface) {
 	fw.rm = rm
 }
 
-// Returns true if a path should be ignored (hidden files, symlinks, etc.)
-func IgnoreFile(path string, info os.FileInfo) bool {
-	if info == nil {
-		return true
+// Sets the window in which events are coalesced into one batch; takes effect
+// when the listener is started (thread-safe)
+func (fw *FileWatcher) SetDebounce(window time.Duration) {
+	if window <= 0 {
+		window = DefaultDebounce
 	}
 
-	// Get the base name
-	baseName := filepath.Base(path)
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.debounce = window
+}
+
+// Returns the debounce window (thread-safe)
+func (fw *FileWatcher) Debounce() time.Duration {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.debounce
+}
 
-	// Skip hidden files and directories
-	if strings.HasPrefix(baseName, ".") {
+// Returns true if a path should be ignored by default (hidden files,
+// symlinks, etc.). Only the name of the path is matched; the rules of a site
+// are applied by FileManager.Ignored.
+func IgnoreFile(path string, info os.FileInfo) bool {
+	if info == nil {
 		return true
 	}
 
@@ -122,15 +174,25 @@ func IgnoreFile(path string, info os.FileInfo) bool {
 		return true
 	}
 
-	// Avoid .bak, .tmp, and other temporary files
-	tmpSuffixes := []string{".bak", ".tmp", "~", ".swp", ".lock"}
-	for _, suffix := range tmpSuffixes {
-		if strings.HasSuffix(baseName, suffix) {
-			return true
-		}
+	return defaultIgnoreRules.Match(filepath.Base(path), info.IsDir())
+}
+
+// Returns true if an absolute path is ignored by the rules of the site
+func (fw *FileWatcher) ignoreFile(path string, info os.FileInfo) bool {
+	if info == nil || info.Mode()&os.ModeSymlink != 0 {
+		return true
 	}
+	return fw.ignoredPath(path, info.IsDir())
+}
 
-	return false
+// Returns true if an absolute path is ignored by the rules of the site, also
+// if the path no longer exists
+func (fw *FileWatcher) ignoredPath(path string, isDir bool) bool {
+	relPath, err := fw.getRelativePath(path)
+	if err != nil {
+		return false
+	}
+	return fw.fm.IgnoreRules().Match(relPath, isDir)
 }
 
 // Converts absolute path to relative path from root
@@ -141,17 +203,26 @@ func (fw *FileWatcher) getRelativePath(absPath string) (string, error) {
 	return filepath.Rel(fw.rootPath, absPath)
 }
 
-// Adds a directory to the watcher recursively
+// Adds a directory to the watcher recursively. Linked directories are
+// watched at the path of the link, linked files in the directory of their
+// target.
 func (fw *FileWatcher) addDirectoryWatch(dirPath string) error {
-	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	return fw.fm.walkSite(dirPath, func(entry siteEntry, err error) error {
 		if err != nil {
 			// Log the error but continue processing other files
-			log.Printf("Error walking path %s: %v", path, err)
+			log.Printf("Error walking path %s: %v", entry.path, err)
 			return nil
 		}
 
-		if info.IsDir() && !IgnoreFile(path, info) {
-			if err := fw.watcher.Add(path); err != nil {
+		path, info := entry.path, entry.info
+		if info.IsDir() && fw.ignoreFile(path, info) {
+			return filepath.SkipDir
+		}
+		if entry.link && !info.IsDir() && !fw.ignoreFile(path, info) {
+			fw.watchLinkedFile(path, entry.resolved)
+		}
+		if info.IsDir() {
+			if err := fw.backend.Add(path); err != nil {
 				log.Printf("Failed to watch directory %s: %v", path, err)
 				return nil // Continue processing other directories
 			}
@@ -175,8 +246,8 @@ func (fw *FileWatcher) removeDirectoryWatch(dirPath string) {
 
 	// Remove the directory and all subdirectories from watcher
 	for watchedDir := range fw.watchedDirs {
-		if strings.HasPrefix(watchedDir, dirPath) {
-			if err := fw.watcher.Remove(watchedDir); err != nil {
+		if watchedDir == dirPath || strings.HasPrefix(watchedDir, dirPath+string(filepath.Separator)) {
+			if err := fw.backend.Remove(watchedDir); err != nil {
 				log.Printf("Failed to remove watcher for %s: %v", watchedDir, err)
 			}
 			delete(fw.watchedDirs, watchedDir)
@@ -187,14 +258,15 @@ func (fw *FileWatcher) removeDirectoryWatch(dirPath string) {
 
 // Handle file modification events
 func (fw *FileWatcher) handleFileModified(path string) {
-	info, err := os.Stat(path)
+	entry, err := fw.fm.statSite(path)
 	if err != nil {
 		// File might have been deleted between event and stat
 		log.Printf("Failed to stat modified file %s: %v", path, err)
 		return
 	}
+	info := entry.info
 
-	if IgnoreFile(path, info) || info.IsDir() {
+	if fw.ignoreFile(path, info) || info.IsDir() {
 		return
 	}
 
@@ -218,6 +290,7 @@ func (fw *FileWatcher) handleFileModified(path string) {
 		return
 	default:
 		log.Printf("Event channel full, dropping event for %s", relPath)
+		fw.eventLost("event channel full")
 	}
 }
 
@@ -255,7 +328,7 @@ func (fw *FileWatcher) Start(rootPath string) error {
 	fw.wg.Add(1)
 	go fw.processWatcherEvents()
 
-	log.Printf("FileWatcher started, watching: %s", rootPath)
+	log.Printf("FileWatcher started (%s), watching: %s", fw.backend.Name(), rootPath)
 	return nil
 }
 
@@ -272,8 +345,8 @@ func (fw *FileWatcher) Stop() error {
 	// Cancel context to signal shutdown
 	fw.cancel()
 
-	// Close the watcher
-	err := fw.watcher.Close()
+	// Close the backend
+	err := fw.backend.Close()
 
 	// Wait for goroutines to finish
 	fw.wg.Wait()
@@ -288,50 +361,77 @@ func (fw *FileWatcher) Stop() error {
 func (fw *FileWatcher) processWatcherEvents() {
 	defer fw.wg.Done()
 
+	renameTimer := time.NewTimer(renameWindow)
+	renameTimer.Stop()
+	defer renameTimer.Stop()
+
 	for {
 		select {
 		case <-fw.ctx.Done():
 			return
-		case event, ok := <-fw.watcher.Events:
+		case <-renameTimer.C:
+			// Renames without a new path were moves out of the site
+			if wait := fw.expireRenames(); wait > 0 {
+				renameTimer.Reset(wait)
+			}
+		case event, ok := <-fw.backend.Events():
 			if !ok {
 				return
 			}
 
-			// Handle different event types
-			switch {
-			case event.Op&fsnotify.Write == fsnotify.Write:
-				fw.handleFileModified(event.Name)
-			case event.Op&fsnotify.Create == fsnotify.Create:
-				// Handle file/directory creation
-				fw.handleFileCreated(event.Name)
-			case event.Op&fsnotify.Remove == fsnotify.Remove:
-				// Handle file/directory deletion
-				fw.handleFileDeleted(event.Name)
-			case event.Op&fsnotify.Rename == fsnotify.Rename:
-				// Handle rename as deletion for now
-				fw.handleFileDeleted(event.Name)
+			// Changed ignore rules may add and remove many files
+			if event.Name == filepath.Join(fw.rootPath, IgnoreFileName) {
+				fw.reloadIgnoreRules()
+				continue
+			}
+
+			// Handle different event types; the events of the target of a
+			// symlink are handled for the link
+			for _, path := range fw.eventPaths(event.Name) {
+				switch {
+				case event.Op&fsnotify.Write == fsnotify.Write:
+					fw.handleFileModified(path)
+				case event.Op&fsnotify.Create == fsnotify.Create:
+					// Handle file/directory creation
+					fw.handleFileCreated(path)
+				case event.Op&fsnotify.Remove == fsnotify.Remove:
+					// Handle file/directory deletion
+					fw.handleFileDeleted(path)
+				case event.Op&fsnotify.Rename == fsnotify.Rename:
+					// The new path follows with a Create event
+					if fw.renameStarted(path) {
+						renameTimer.Reset(renameWindow)
+					}
+				}
 			}
 
-		case err, ok := <-fw.watcher.Errors:
+		case err, ok := <-fw.backend.Errors():
 			if !ok {
 				return
 			}
 			log.Printf("FileWatcher error: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				fw.eventLost("event queue overflow")
+			}
 		}
 	}
 }
 
 // handles file creation events
 func (fw *FileWatcher) handleFileCreated(path string) {
-	info, err := os.Stat(path)
+	entry, err := fw.fm.statSite(path)
 	if err != nil {
 		log.Printf("Failed to stat created file %s: %v", path, err)
 		return
 	}
+	info := entry.info
 
-	if IgnoreFile(path, info) {
+	if fw.ignoreFile(path, info) {
 		return
 	}
+	if entry.link && !info.IsDir() {
+		fw.watchLinkedFile(path, entry.resolved)
+	}
 
 	relPath, err := fw.getRelativePath(path)
 	if err != nil {
@@ -339,6 +439,19 @@ func (fw *FileWatcher) handleFileCreated(path string) {
 		return
 	}
 
+	if rename, paired := fw.pairRename(path, info.IsDir()); paired {
+		if oldPath, err := fw.getRelativePath(rename.path); err == nil {
+			fw.sendEvent(FileWatchEvent{
+				Type:    FileRenamed,
+				Path:    relPath,
+				OldPath: oldPath,
+				IsDir:   info.IsDir(),
+				Time:    time.Now(),
+			})
+			return
+		}
+	}
+
 	if info.IsDir() {
 		// Send event
 		event := FileWatchEvent{
@@ -373,6 +486,11 @@ func (fw *FileWatcher) handleFileDeleted(path string) {
 	wasDir := fw.watchedDirs[path]
 	fw.mu.RUnlock()
 
+	if fw.ignoredPath(path, wasDir) {
+		return
+	}
+	fw.unwatchLinkedFile(path)
+
 	if wasDir {
 		// Send event
 		event := FileWatchEvent{
@@ -403,6 +521,7 @@ func (fw *FileWatcher) sendEvent(event FileWatchEvent) {
 		return
 	default:
 		log.Printf("Event channel full, dropping event for %s", event.Path)
+		fw.eventLost("event channel full")
 	}
 }
 
@@ -694,3 +694,54 @@ func TestIgnoreHiddenFiles(t *testing.T) {
 		t.Error("Should receive events for regular files")
 	}
 }
+
+func TestRenameTracking(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "content", "blog"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"a.md", "b.md"} {
+		if err := os.WriteFile(filepath.Join(tempDir, "content", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", name, err)
+		}
+	}
+
+	fw, err := newTestFileWatcher(NewFileManager(tempDir))
+	if err != nil {
+		t.Fatalf("Failed to create file watcher: %v", err)
+	}
+	if err := fw.Start(tempDir); err != nil {
+		t.Fatalf("Failed to start file watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	move := func(from, to string) FileWatchEvent {
+		if err := os.Rename(from, to); err != nil {
+			t.Fatalf("Failed to rename %s: %v", from, err)
+		}
+		select {
+		case event := <-fw.GetEventChannel():
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for the rename of %s", from)
+			return FileWatchEvent{}
+		}
+	}
+
+	// A rename within the site is one event with both paths
+	event := move(filepath.Join(tempDir, "content", "a.md"), filepath.Join(tempDir, "content", "blog", "a.md"))
+	if event.Type != FileRenamed || event.Path != filepath.Join("content", "blog", "a.md") || event.OldPath != filepath.Join("content", "a.md") {
+		t.Errorf("Unexpected event for a moved file: %+v", event)
+	}
+
+	event = move(filepath.Join(tempDir, "content", "blog"), filepath.Join(tempDir, "content", "notes"))
+	if event.Type != FileRenamed || !event.IsDir || event.Path != filepath.Join("content", "notes") || event.OldPath != filepath.Join("content", "blog") {
+		t.Errorf("Unexpected event for a moved directory: %+v", event)
+	}
+
+	// A move out of the site is a deletion
+	event = move(filepath.Join(tempDir, "content", "b.md"), filepath.Join(t.TempDir(), "b.md"))
+	if event.Type != FileDeleted || event.Path != filepath.Join("content", "b.md") {
+		t.Errorf("Unexpected event for a file moved out of the site: %+v", event)
+	}
+}
@@ -2,9 +2,11 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +23,10 @@ const (
 	HealthStatusUnknown   HealthStatus = "unknown"
 )
 
+// Checks return an error wrapping ErrDegraded if the component works, but
+// not as intended
+var ErrDegraded = errors.New("degraded")
+
 // HealthCheck represents a single health check
 type HealthCheck struct {
 	Name        string                          `json:"name"`
@@ -88,7 +94,10 @@ func (hc *HealthChecker) RunCheck(ctx context.Context, name string) error {
 	check.Duration = duration
 	check.LastChecked = time.Now()
 
-	if err != nil {
+	if errors.Is(err, ErrDegraded) {
+		check.Status = HealthStatusDegraded
+		check.Message = err.Error()
+	} else if err != nil {
 		check.Status = HealthStatusUnhealthy
 		check.Message = err.Error()
 	} else {
@@ -318,7 +327,8 @@ func FileWatcherHealthCheck(fw *FileWatcher) func(ctx context.Context) error {
 			return fmt.Errorf("no directories being watched")
 		}
 
-		return nil
+		// Lost events are replaced by a rescan of the site
+		return fw.checkLostEvents()
 	}
 }
 
@@ -340,6 +350,15 @@ func RouterHealthCheck(rm *RouterManager) func(ctx context.Context) error {
 			return fmt.Errorf("no routes registered")
 		}
 
+		// Conflicting routes are served, but only by one of the files
+		if conflicts := rm.GetConflicts(); len(conflicts) > 0 {
+			descriptions := make([]string, len(conflicts))
+			for i, conflict := range conflicts {
+				descriptions[i] = fmt.Sprintf("%s (%s is shadowed by %s)", conflict.Route, conflict.Shadowed, conflict.Winner)
+			}
+			return fmt.Errorf("%w: %d route conflicts: %s", ErrDegraded, len(conflicts), strings.Join(descriptions, "; "))
+		}
+
 		return nil
 	}
 }
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files which are not part of the site are ignored, e.g. a README, sources
+// of images and the files of editors. The rules use the syntax of
+// .gitignore: they are read from the "ignore" list in site.yaml and from
+// .minicmsignore in the site directory, after the default rules. The last
+// matching rule decides, "!" includes a path again.
+
+// Name of the ignore file in the site directory
+const IgnoreFileName = ".minicmsignore"
+
+// Hidden files, and the temporary and backup files of editors ("4913" is
+// written by vim to test whether a directory is writable)
+var defaultIgnorePatterns = []string{
+	".*", "*.bak", "*.tmp", "*~", "*.swp", "*.lock", "4913", `\#*#`,
+}
+
+type ignoreRule struct {
+	segments []string // Pattern split at "/", "**" matches any number of directories
+	anchored bool     // Matches the path from the site directory, otherwise the name
+	dirOnly  bool     // The pattern ends with "/"
+	negate   bool     // The pattern starts with "!"
+}
+
+// IgnoreRules decide which files and directories of the site are ignored
+type IgnoreRules struct {
+	patterns []string // The patterns from site.yaml, kept when the file is read again
+	rules    []ignoreRule
+}
+
+// The rules of a site without ignore rules
+var defaultIgnoreRules, _ = NewIgnoreRules(nil)
+
+// Returns the default rules, followed by the given patterns
+func NewIgnoreRules(patterns []string) (*IgnoreRules, error) {
+	r := &IgnoreRules{patterns: patterns}
+	for _, pattern := range slices.Concat(defaultIgnorePatterns, patterns) {
+		if err := r.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Returns the rules from site.yaml, followed by the rules from the ignore
+// file of the site directory (if it exists). Invalid lines in the file are
+// skipped.
+func LoadIgnoreRules(siteDirectory string, patterns []string) (*IgnoreRules, error) {
+	r, err := NewIgnoreRules(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(siteDirectory, IgnoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFileName, err)
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		if err := r.add(line); err != nil {
+			log.Printf("Warning: %s:%d: %v", IgnoreFileName, i+1, err)
+		}
+	}
+	return r, nil
+}
+
+// Returns the patterns from site.yaml
+func (r *IgnoreRules) Patterns() []string {
+	return r.patterns
+}
+
+// Adds a line in .gitignore syntax. Blank lines and comments are skipped.
+func (r *IgnoreRules) add(line string) error {
+	line = strings.TrimRight(line, " \r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, `\`) {
+		// "\#" and "\!" match a leading "#" or "!"
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return fmt.Errorf("empty ignore pattern")
+	}
+
+	rule.segments = strings.Split(line, "/")
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", line, err)
+		}
+	}
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+// Returns true if a path relative to the site directory is ignored. A path
+// in an ignored directory is ignored as well, like in git.
+func (r *IgnoreRules) Match(relPath string, isDir bool) bool {
+	relPath = filepath.Clean(relPath)
+	if relPath == "." {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := 1; i <= len(segments); i++ {
+		if r.matchOne(segments[:i], isDir || i < len(segments)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the last matching rule ignores a path
+func (r *IgnoreRules) matchOne(segments []string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchSegments(rule.segments, segments)
+		} else {
+			matched = matchSegments(rule.segments, segments[len(segments)-1:])
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Matches the segments of a path against the segments of a pattern
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// "dir/**" matches everything in the directory
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// Reads the ignore rules of the site, see LoadIgnoreRules (thread-safe)
+func (fm *FileManager) LoadIgnoreRules(patterns []string) error {
+	rules, err := LoadIgnoreRules(fm.SiteDirectory, patterns)
+	if err != nil {
+		return err
+	}
+	fm.ignore.Store(rules)
+	return nil
+}
+
+// Returns the ignore rules of the site (thread-safe)
+func (fm *FileManager) IgnoreRules() *IgnoreRules {
+	if rules := fm.ignore.Load(); rules != nil {
+		return rules
+	}
+	return defaultIgnoreRules
+}
+
+// Returns true if a file or directory is not part of the site: symlinks, and
+// paths which match the ignore rules. The path is relative to the site
+// directory.
+func (fm *FileManager) Ignored(relPath string, info os.FileInfo) bool {
+	if info == nil || info.Mode()&os.ModeSymlink != 0 {
+		return true
+	}
+	return fm.IgnoreRules().Match(relPath, info.IsDir())
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	rules, err := NewIgnoreRules([]string{
+		"node_modules/",
+		"*.psd",
+		"README.md",
+		"/drafts",
+		"content/**/private",
+		"assets/**",
+		"!assets/logo.svg",
+		"*.log",
+		"!keep.log",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		// Default rules
+		{".git", true, true},
+		{"content/.page.md.swp", false, true},
+		{"content/page.md~", false, true},
+		{"content/#page.md#", false, true},
+		{"content/4913", false, true},
+		{"content/page.md", false, false},
+		{".", true, false},
+
+		// Directories only
+		{"node_modules", true, true},
+		{"layout/node_modules", true, true},
+		{"node_modules/pkg/index.js", false, true},
+		{"content/node_modules", false, false},
+
+		// Names match at any depth
+		{"content/images/banner.psd", false, true},
+		{"README.md", false, true},
+		{"content/README.md", false, true},
+
+		// Anchored patterns match from the site directory
+		{"drafts", true, true},
+		{"drafts/post.md", false, true},
+		{"content/drafts", true, false},
+		{"content/private", true, true},
+		{"content/blog/2024/private/post.md", false, true},
+		{"layout/private", true, false},
+
+		// Negation
+		{"assets/style.css", false, true},
+		{"assets/logo.svg", false, false},
+		{"assets", true, false},
+		{"content/debug.log", false, true},
+		{"content/keep.log", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, rules.Match(tt.path, tt.isDir), tt.path)
+	}
+
+	_, err = NewIgnoreRules([]string{"[invalid"})
+	assert.Error(t, err)
+}
+
+func TestLoadIgnoreRules(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Without an ignore file, only the patterns from site.yaml apply
+	rules, err := LoadIgnoreRules(tempDir, []string{"*.psd"})
+	require.NoError(t, err)
+	assert.True(t, rules.Match("logo.psd", false))
+	assert.False(t, rules.Match("notes.txt", false))
+
+	ignoreFile := "# Sources\n*.txt\n\n[invalid\n!/important.txt\n\\#hash\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte(ignoreFile), 0644))
+
+	rules, err = LoadIgnoreRules(tempDir, []string{"*.psd"})
+	require.NoError(t, err)
+	assert.True(t, rules.Match("logo.psd", false))
+	assert.True(t, rules.Match("notes.txt", false))
+	assert.False(t, rules.Match("important.txt", false))
+	assert.True(t, rules.Match("content/important.txt", false))
+	assert.True(t, rules.Match("#hash", false))
+	assert.Equal(t, []string{"*.psd"}, rules.Patterns())
+}
+
+func TestWalkDirectoryIgnoreRules(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"content/page.md", "content/README.md", "content/sources/logo.psd", "content/drafts/post.md"} {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte("drafts/\n"), 0644))
+
+	fm := NewFileManager(tempDir)
+	require.NoError(t, fm.LoadIgnoreRules([]string{"README.md", "*.psd"}))
+	require.NoError(t, fm.WalkDirectory("content"))
+
+	assert.NotNil(t, fm.GetFile("content/page.md"))
+	assert.Nil(t, fm.GetFile("content/README.md"))
+	assert.Nil(t, fm.GetFile("content/sources/logo.psd"))
+	assert.Nil(t, fm.GetFile("content/drafts/post.md"))
+	assert.Nil(t, fm.GetDirectory("content/drafts"))
+}
+
+func TestIgnoreFileLiveReload(t *testing.T) {
+	fm, fw, _, tempDir := createListenerTestEnv(t)
+	for _, name := range []string{"content/page.md", "content/notes.txt", "content/drafts/post.md"} {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+	ignoreFile := filepath.Join(tempDir, IgnoreFileName)
+	require.NoError(t, os.WriteFile(ignoreFile, []byte("drafts/\n"), 0644))
+	require.NoError(t, fm.LoadIgnoreRules(nil))
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.Nil(t, fm.GetFile("content/drafts/post.md"))
+
+	require.NoError(t, fw.Start(tempDir))
+	defer fw.Stop()
+	fwl := newFileWatcherListener(fw)
+	require.NoError(t, fwl.Start(fw))
+	defer fwl.Stop()
+
+	// The drafts are included, the notes are ignored from now on
+	require.NoError(t, os.WriteFile(ignoreFile, []byte("*.txt\n"), 0644))
+	assert.Eventually(t, func() bool {
+		return fm.GetFile("content/notes.txt") == nil && fm.GetFile("content/drafts/post.md") != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The included directory is watched
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/drafts/next.md"), []byte("next"), 0644))
+	assert.Eventually(t, func() bool {
+		return fm.GetFile("content/drafts/next.md") != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Ignored files are not reported
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/more.txt"), []byte("more"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/more.md"), []byte("more"), 0644))
+	assert.Eventually(t, func() bool {
+		return fm.GetFile("content/more.md") != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Nil(t, fm.GetFile("content/more.txt"))
+}
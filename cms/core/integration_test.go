@@ -54,9 +54,11 @@ func (p *testRoutePlugin) Process(ctx *PluginContext) *PluginResult {
 	}
 
 	return &PluginResult{
-		Success:  true,
-		Routes:   []string{route},
-		MimeType: "text/html",
+		Success:    true,
+		Modified:   true,
+		NewContent: ctx.File.ReadFile(ctx.SiteDirectory),
+		Routes:     []string{route},
+		MimeType:   "text/html",
 	}
 }
 
@@ -105,7 +107,7 @@ func setupIntegrationTest(t *testing.T) *IntegrationTestSuite {
 		t.Fatalf("Failed to walk content directory: %v", err)
 	}
 
-	fw, err := NewFileWatcher(fm)
+	fw, err := newTestFileWatcher(fm)
 	if err != nil {
 		t.Fatalf("Failed to create FileWatcher: %v", err)
 	}
@@ -410,19 +412,13 @@ func TestHTTPRoutingIntegration(t *testing.T) {
 		t.Fatalf("Failed to create file: %v", err)
 	}
 
-	// Wait for file processing
-	time.Sleep(300 * time.Millisecond)
-
-	// Manually add file and process it (since our test setup might not have all plugins)
-	file := suite.fm.AddFile(filePath)
-	if file != nil {
-		// Set up basic file properties for routing
-		file.Content = []byte(content)
-		file.Routes = []string{"/test-page", "/test-page.html"}
-		file.Metadata.MimeType = "text/html"
-
-		// Add route manually for this test
-		suite.rm.AddFile(file)
+	// Wait until the listener processed and routed the file. The File in the
+	// FileManager is shared with the listener, so the test must not modify it
+	for i := 0; i < 40; i++ {
+		if _, exists := suite.rm.GetAllRoutes()["/test-page"]; exists {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
 
 	// Test HTTP request to the route
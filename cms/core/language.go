@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Language errors
+var (
+	ErrInvalidLanguage   = errors.New("invalid language code")
+	ErrDuplicateLanguage = errors.New("duplicate language code")
+	ErrUnknownLanguage   = errors.New("unknown default language")
+)
+
+// Language codes look like "en", "de" or "pt-BR"
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// Language describes one of the languages a site is published in
+type Language struct {
+	Code     string `yaml:"code"`
+	Name     string `yaml:"name"`
+	Analyzer string `yaml:"analyzer"` // bleve analyzer for the search index, defaults to Code
+}
+
+// Languages is the "languages" block in site.yaml. A site without languages
+// is monolingual, and files are neither split nor prefixed.
+type Languages struct {
+	Default   string     `yaml:"default"`
+	Available []Language `yaml:"available"`
+}
+
+func (l *Languages) Validate() error {
+	seen := make(map[string]bool)
+	for _, lang := range l.Available {
+		if !languageCodePattern.MatchString(lang.Code) {
+			return fmt.Errorf("%w: %q", ErrInvalidLanguage, lang.Code)
+		}
+		if seen[lang.Code] {
+			return fmt.Errorf("%w: %s", ErrDuplicateLanguage, lang.Code)
+		}
+		seen[lang.Code] = true
+	}
+
+	if l.Default != "" && !seen[l.Default] {
+		return fmt.Errorf("%w: %s", ErrUnknownLanguage, l.Default)
+	}
+
+	return nil
+}
+
+// Returns true if at least one language is configured
+func (l *Languages) IsMultilingual() bool {
+	return len(l.Available) > 0
+}
+
+// Returns the code of the default language, or "" for monolingual sites
+func (l *Languages) DefaultCode() string {
+	if l.Default != "" {
+		return l.Default
+	}
+	if len(l.Available) > 0 {
+		return l.Available[0].Code
+	}
+	return ""
+}
+
+// Returns the language with the given code, or nil if it is not configured
+func (l *Languages) Get(code string) *Language {
+	for i := range l.Available {
+		if l.Available[i].Code == code {
+			return &l.Available[i]
+		}
+	}
+	return nil
+}
+
+// Returns the route prefix for a language, e.g. "/de". The default language
+// is not prefixed.
+func (l *Languages) RoutePrefix(code string) string {
+	if code == "" || code == l.DefaultCode() {
+		return ""
+	}
+	return "/" + code
+}
+
+// Splits a path (relative to the site directory) into its language and the
+// translation key, which is identical for all translations of a page.
+// Both "content/de/about.md" and "content/about.de.md" return
+// ("de", "content/about.md"). Files outside of content/ are not translated.
+func (l *Languages) Split(filePath string) (string, string) {
+	if !l.IsMultilingual() || !strings.HasPrefix(filePath, "content/") {
+		return "", filePath
+	}
+
+	// content/<lang>/...
+	rest := strings.TrimPrefix(filePath, "content/")
+	if code, tail, found := strings.Cut(rest, "/"); found && l.Get(code) != nil {
+		return code, path.Join("content", tail)
+	}
+
+	// page.<lang>.ext
+	dir, base := path.Split(filePath)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if langExt := path.Ext(stem); langExt != "" {
+		code := strings.TrimPrefix(langExt, ".")
+		if l.Get(code) != nil {
+			return code, dir + strings.TrimSuffix(stem, langExt) + ext
+		}
+	}
+
+	return l.DefaultCode(), filePath
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestLanguages() Languages {
+	return Languages{
+		Default: "en",
+		Available: []Language{
+			{Code: "en", Name: "English"},
+			{Code: "de", Name: "Deutsch"},
+		},
+	}
+}
+
+func TestLanguagesValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		languages Languages
+		wantErr   error
+	}{
+		{"empty", Languages{}, nil},
+		{"valid", newTestLanguages(), nil},
+		{"region code", Languages{Available: []Language{{Code: "pt-BR"}}}, nil},
+		{"invalid code", Languages{Available: []Language{{Code: "German"}}}, ErrInvalidLanguage},
+		{"empty code", Languages{Available: []Language{{Code: ""}}}, ErrInvalidLanguage},
+		{"duplicate code", Languages{Available: []Language{{Code: "de"}, {Code: "de"}}}, ErrDuplicateLanguage},
+		{"unknown default", Languages{Default: "fr", Available: []Language{{Code: "de"}}}, ErrUnknownLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.languages.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLanguagesDefaultCode(t *testing.T) {
+	languages := newTestLanguages()
+	if code := languages.DefaultCode(); code != "en" {
+		t.Errorf("Expected default language en, got %s", code)
+	}
+
+	languages.Default = ""
+	languages.Available[0], languages.Available[1] = languages.Available[1], languages.Available[0]
+	if code := languages.DefaultCode(); code != "de" {
+		t.Errorf("Expected first language to be the default, got %s", code)
+	}
+
+	var empty Languages
+	if code := empty.DefaultCode(); code != "" {
+		t.Errorf("Expected no default language for monolingual site, got %s", code)
+	}
+}
+
+func TestLanguagesSplit(t *testing.T) {
+	languages := newTestLanguages()
+
+	tests := []struct {
+		path         string
+		expectedLang string
+		expectedKey  string
+	}{
+		{"content/about.md", "en", "content/about.md"},
+		{"content/de/about.md", "de", "content/about.md"},
+		{"content/en/about.md", "en", "content/about.md"},
+		{"content/about.de.md", "de", "content/about.md"},
+		{"content/blog/post.de.html", "de", "content/blog/post.html"},
+		{"content/de/blog/index.md", "de", "content/blog/index.md"},
+		{"content/fr/about.md", "en", "content/fr/about.md"},
+		{"content/about.fr.md", "en", "content/about.fr.md"},
+		{"content/jquery.min.js", "en", "content/jquery.min.js"},
+		{"layout/header.de.html", "", "layout/header.de.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			lang, key := languages.Split(tt.path)
+			if lang != tt.expectedLang {
+				t.Errorf("Expected language %q, got %q", tt.expectedLang, lang)
+			}
+			if key != tt.expectedKey {
+				t.Errorf("Expected translation key %q, got %q", tt.expectedKey, key)
+			}
+		})
+	}
+
+	var monolingual Languages
+	if lang, key := monolingual.Split("content/de/about.md"); lang != "" || key != "content/de/about.md" {
+		t.Errorf("Monolingual site should not split paths, got (%q, %q)", lang, key)
+	}
+}
+
+func TestLanguagesRoutePrefix(t *testing.T) {
+	languages := newTestLanguages()
+
+	if prefix := languages.RoutePrefix("en"); prefix != "" {
+		t.Errorf("Default language should not be prefixed, got %s", prefix)
+	}
+	if prefix := languages.RoutePrefix("de"); prefix != "/de" {
+		t.Errorf("Expected prefix /de, got %s", prefix)
+	}
+	if prefix := languages.RoutePrefix(""); prefix != "" {
+		t.Errorf("Empty language should not be prefixed, got %s", prefix)
+	}
+}
+
+func TestFileManagerTranslations(t *testing.T) {
+	fm := NewFileManager(t.TempDir())
+	fm.SetLanguages(newTestLanguages())
+
+	en := fm.AddFile("content/about.md")
+	de := fm.AddFile("content/de/about.md")
+	fm.AddFile("content/contact.md")
+
+	if en.Language != "en" || de.Language != "de" {
+		t.Fatalf("Expected languages en/de, got %s/%s", en.Language, de.Language)
+	}
+
+	translations := fm.GetTranslations(de)
+	if len(translations) != 2 {
+		t.Fatalf("Expected 2 translations, got %d", len(translations))
+	}
+	for _, file := range translations {
+		if file.TranslationKey != "content/about.md" {
+			t.Errorf("Unexpected translation %s", file.Path)
+		}
+	}
+
+	// Setting the languages later re-assigns existing files
+	fm = NewFileManager(t.TempDir())
+	file := fm.AddFile("content/about.de.md")
+	if file.Language != "" {
+		t.Errorf("Expected no language before SetLanguages, got %s", file.Language)
+	}
+	fm.SetLanguages(newTestLanguages())
+	if file.Language != "de" {
+		t.Errorf("Expected language de after SetLanguages, got %s", file.Language)
+	}
+}
+
+func TestFileManagerTranslationFrontmatter(t *testing.T) {
+	siteDir := t.TempDir()
+	write := func(path, url string) {
+		fullPath := filepath.Join(siteDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		content := "---\ntitle: CV\nurl: " + url + "\n---\n<p>CV</p>"
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	write("content/cv.html", "/en-cv/")
+	write("content/de/cv.html", "/de/lebenslauf/")
+
+	// The frontmatter of translations is known before they are processed
+	fm := NewFileManager(siteDir)
+	fm.SetLanguages(newTestLanguages())
+	if err := fm.WalkDirectory("content"); err != nil {
+		t.Fatalf("Failed to walk content directory: %v", err)
+	}
+	de := fm.GetFile("content/de/cv.html")
+	for _, file := range fm.GetTranslations(de) {
+		if file.Frontmatter.Url == "" || file.Metadata.Url != "" {
+			t.Errorf("Expected only the frontmatter of %s, got %+v", file.Path, file)
+		}
+	}
+
+	// ... and read again when a file changes
+	write("content/de/cv.html", "/de/cv/")
+	if file := fm.AddFile("content/de/cv.html"); file.Frontmatter.Url != "/de/cv/" {
+		t.Errorf("Expected url /de/cv/, got %s", file.Frontmatter.Url)
+	}
+
+	// Monolingual sites do not need it
+	fm = NewFileManager(siteDir)
+	if file := fm.AddFile("content/cv.html"); file.Frontmatter.Url != "" {
+		t.Errorf("Expected no frontmatter without languages, got %s", file.Frontmatter.Url)
+	}
+}
+
+func TestInitializeLocalizedNavigation(t *testing.T) {
+	siteDir := t.TempDir()
+	configDir := filepath.Join(siteDir, "config")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("Failed to create config directory: %v", err)
+	}
+
+	english := "main:\n  - url: \"/\"\n    title: Home\n"
+	german := "main:\n  - url: \"/de\"\n    title: Startseite\n"
+	if err := os.WriteFile(filepath.Join(configDir, "navigation.yaml"), []byte(english), 0644); err != nil {
+		t.Fatalf("Failed to write navigation.yaml: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "navigation.de.yaml"), []byte(german), 0644); err != nil {
+		t.Fatalf("Failed to write navigation.de.yaml: %v", err)
+	}
+
+	ctx := &Context{}
+	ctx.Config.SiteDirectory = siteDir
+	ctx.Config.Languages = newTestLanguages()
+
+	var err error
+	ctx.Navigation, err = InitializeNavigation(ctx)
+	if err != nil {
+		t.Fatalf("InitializeNavigation failed: %v", err)
+	}
+	ctx.Navigations, err = InitializeLocalizedNavigation(ctx)
+	if err != nil {
+		t.Fatalf("InitializeLocalizedNavigation failed: %v", err)
+	}
+
+	if title := ctx.NavigationFor("de").Children[0].Title; title != "Startseite" {
+		t.Errorf("Expected German navigation, got %s", title)
+	}
+	if title := ctx.NavigationFor("en").Children[0].Title; title != "Home" {
+		t.Errorf("Expected English navigation as fallback, got %s", title)
+	}
+	if title := ctx.NavigationFor("").Children[0].Title; title != "Home" {
+		t.Errorf("Expected default navigation for monolingual pages, got %s", title)
+	}
+}
@@ -2,12 +2,15 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 // FileEventHandler defines the interface for handling file system events
@@ -37,6 +40,13 @@ func (fwl *FileWatcherListener) affectsRoutes(path string) bool {
 	return strings.HasPrefix(path, "content/")
 }
 
+// Helper function to determine if a processed file has to be added to the router.
+// Files in content always have routes, other files (e.g. assets) only if a plugin
+// created them
+func (fwl *FileWatcherListener) isRoutable(file *File) bool {
+	return fwl.affectsRoutes(file.Path) || len(file.Routes) > 0 || len(file.OutputFiles) > 0
+}
+
 // Helper function to determine if a router rebuild is needed
 func (fwl *FileWatcherListener) needsRouterRebuild(path string, isDirectory bool) bool {
 	if isDirectory {
@@ -123,11 +133,28 @@ func (fwl *FileWatcherListener) IsRunning() bool {
 	return fwl.running
 }
 
-// processEvents is the main event processing loop
+// processEvents is the main event processing loop. Events are collected until
+// none arrives for the debounce window, and then applied as one batch.
 func (fwl *FileWatcherListener) processEvents(eventChan <-chan FileWatchEvent) {
 	defer fwl.wg.Done()
 
-	log.Printf("Event processing started")
+	window := fwl.fw.Debounce()
+	log.Printf("Event processing started (debounce %s)", window)
+
+	batch := newEventBatch()
+	timer := time.NewTimer(window)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() {
+		events := batch.flush()
+		if len(events) == 0 {
+			return
+		}
+		if err := fwl.HandleBatch(events); err != nil {
+			log.Printf("Error handling file watcher events: %v", err)
+		}
+	}
 
 	for {
 		select {
@@ -137,203 +164,313 @@ func (fwl *FileWatcherListener) processEvents(eventChan <-chan FileWatchEvent) {
 
 		case event, ok := <-eventChan:
 			if !ok {
+				flush()
 				log.Printf("Event processing stopped (channel closed)")
 				return
 			}
 
-			switch event.Type {
-			case FileCreated:
-				if err := fwl.HandleFileCreated(event); err != nil {
-					log.Printf("Error handling file creation: %v", err)
-				}
-			case FileModified:
-				if err := fwl.HandleFileModified(event); err != nil {
-					log.Printf("Error handling file modification: %v", err)
-				}
-			case FileDeleted:
-				if err := fwl.HandleFileDeleted(event); err != nil {
-					log.Printf("Error handling file deletion: %v", err)
-				}
-			case FileRenamed:
-				if err := fwl.HandleFileDeleted(event); err != nil {
-					log.Printf("Error handling file rename (deletion): %v", err)
-				}
-				if err := fwl.HandleFileCreated(event); err != nil {
-					log.Printf("Error handling file rename (creation): %v", err)
-				}
-			case DirCreated:
-				if err := fwl.HandleDirectoryCreated(event); err != nil {
-					log.Printf("Error handling directory creation: %v", err)
-				}
-			case DirDeleted:
-				if err := fwl.HandleDirectoryDeleted(event); err != nil {
-					log.Printf("Error handling directory deletion: %v", err)
-				}
+			batch.add(event)
+			if time.Since(batch.started) >= maxDebounceWindows*window {
+				// Events keep arriving, e.g. during a large checkout
+				timer.Stop()
+				flush()
+			} else {
+				timer.Reset(window)
 			}
+
+		case <-timer.C:
+			flush()
+
+		case <-fwl.fw.GetResyncChannel():
+			// The rescan finds all changes, including those of the
+			// pending events
+			timer.Stop()
+			batch.flush()
+			fwl.resync(eventChan)
 		}
 	}
 }
 
-// HandleFileModified implements FileEventHandler
-func (fwl *FileWatcherListener) HandleFileModified(event FileWatchEvent) error {
-	log.Printf("Processing file modification: %s", event.Path)
+// Rescans the site after the file watcher lost events, and applies the
+// differences to the FileManager as one batch
+func (fwl *FileWatcherListener) resync(eventChan <-chan FileWatchEvent) {
+	// Queued events are older than the rescan
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-eventChan:
+			drained = !ok
+		default:
+			drained = true
+		}
+	}
 
-	// Update file in FileManager
-	file := fwl.fw.fm.AddFile(event.Path)
-	if file == nil {
-		err := fmt.Errorf("failed to add modified file to FileManager: %s", event.Path)
+	log.Printf("Rescanning the site after lost file watcher events")
+	events, err := fwl.fw.scanChanges()
+	if err == nil && len(events) > 0 {
+		if batchErr := fwl.HandleBatch(events); batchErr != nil {
+			log.Printf("Error applying the rescan: %v", batchErr)
+		}
+	}
+	if err != nil {
+		log.Printf("Error rescanning the site: %v", err)
+	} else {
+		log.Printf("Rescan found %d changes", len(events))
+	}
+	fwl.fw.resyncDone(err)
+}
+
+// HandleBatch applies the coalesced events of a debounce window as one
+// transaction: the FileManager is updated for all events, the changed files
+// and their dependents are processed in a single plugin pass, and the routes
+// are updated once. Events which fail are reported, the others are applied.
+func (fwl *FileWatcherListener) HandleBatch(events []FileWatchEvent) error {
+	log.Printf("Processing %d file watcher events", len(events))
+
+	var errs []error
+	var removed, changed []string
+	rebuild := false
+
+	for _, event := range events {
+		var err error
+		switch event.Type {
+		case FileCreated:
+			err = fwl.createFile(event.Path)
+			changed = append(changed, event.Path)
+		case FileModified:
+			err = fwl.modifyFile(event.Path)
+			changed = append(changed, event.Path)
+		case FileDeleted:
+			if fwl.deleteFile(event.Path) {
+				removed = append(removed, event.Path)
+			}
+		case FileRenamed:
+			if event.OldPath == "" {
+				// The old path is unknown, the file is added again
+				if fwl.deleteFile(event.Path) {
+					removed = append(removed, event.Path)
+				}
+				err = fwl.createFile(event.Path)
+				changed = append(changed, event.Path)
+				break
+			}
+
+			var oldPaths, newPaths []string
+			if event.IsDir {
+				oldPaths, newPaths, err = fwl.moveDirectory(event.OldPath, event.Path)
+			} else {
+				oldPaths, newPaths, err = fwl.moveFile(event.OldPath, event.Path)
+			}
+			removed = append(removed, oldPaths...)
+			changed = append(changed, newPaths...)
+		case DirCreated:
+			err = fwl.createDirectory(event.Path)
+			rebuild = rebuild || (err == nil && fwl.needsRouterRebuild(event.Path, true))
+		case DirDeleted:
+			fwl.deleteDirectory(event.Path)
+			rebuild = rebuild || fwl.needsRouterRebuild(event.Path, true)
+		}
+		if err != nil {
+			log.Printf("Error: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// Changed configuration files replace the configuration before the
+	// pages are rendered with it. It may change the routes of all pages,
+	// and the redirects.
+	reloaded, err := fwl.reloadConfig(events)
+	if err != nil {
 		log.Printf("Error: %v", err)
-		return err
+		errs = append(errs, err)
 	}
+	rebuild = rebuild || reloaded
 
-	// Update all files that need to be reprocessed
-	fwl.fw.fm.ProcessUpdatedFiles()
+	// Process all files that need to be reprocessed, including the dependents
+	// of the changed files
+	processed := fwl.fw.fm.ProcessUpdatedFiles()
 
-	log.Printf("Successfully processed file modification: %s", event.Path)
-	return nil
-}
+	// A new or deleted content directory changes many routes at once
+	if rebuild {
+		log.Printf("Rebuilding router for changes affecting content routes")
+		if err := fwl.fw.rm.RebuildRouter(); err != nil {
+			err = fmt.Errorf("failed to rebuild router: %v", err)
+			log.Printf("Error: %v", err)
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
 
-// HandleFileCreated implements FileEventHandler
-func (fwl *FileWatcherListener) HandleFileCreated(event FileWatchEvent) error {
-	log.Printf("Processing file creation: %s", event.Path)
+	// The changed files may have new routes (e.g. for generated images or
+	// fingerprinted assets), and so may the generated files of dependents
+	added := make([]*File, 0, len(changed))
+	seen := make(map[string]bool)
+	for _, path := range changed {
+		if file := fwl.fw.fm.GetFile(path); file != nil && fwl.isRoutable(file) && !seen[path] {
+			added = append(added, file)
+			seen[path] = true
+		}
+	}
+	for _, file := range processed {
+		if len(file.OutputFiles) > 0 && !seen[file.Path] {
+			added = append(added, file)
+			seen[file.Path] = true
+		}
+	}
+	if len(removed) > 0 || len(added) > 0 {
+		fwl.fw.rm.UpdateFiles(removed, added)
+	}
+
+	return errors.Join(errs...)
+}
 
+// Adds a created file to the FileManager
+func (fwl *FileWatcherListener) createFile(path string) error {
 	// Check if the file actually exists on disk
-	absolutePath := filepath.Join(fwl.fw.rootPath, event.Path)
+	absolutePath := filepath.Join(fwl.fw.rootPath, path)
 	if _, err := os.Stat(absolutePath); os.IsNotExist(err) {
-		err = fmt.Errorf("file creation event for non-existent file: %s", event.Path)
-		log.Printf("Error: %v", err)
-		return err
+		return fmt.Errorf("file creation event for non-existent file: %s", path)
 	} else if err != nil {
-		err = fmt.Errorf("failed to stat file %s: %v", event.Path, err)
-		log.Printf("Error: %v", err)
-		return err
+		return fmt.Errorf("failed to stat file %s: %v", path, err)
 	}
 
 	// Ensure parent directory exists in FileManager by walking from root
-	dirPath := filepath.Dir(event.Path)
+	dirPath := filepath.Dir(path)
 	if dirPath != "." && dirPath != "" {
 		if err := fwl.fw.fm.WalkDirectory(dirPath); err != nil {
 			log.Printf("Warning: failed to walk directory %s: %v", dirPath, err)
 		}
 	}
 
-	// Add file to FileManager
-	file := fwl.fw.fm.AddFile(event.Path)
-	if file == nil {
-		err := fmt.Errorf("failed to add created file to FileManager: %s", event.Path)
-		log.Printf("Error: %v", err)
-		return err
-	}
-
-	// Process (a copy of the) new file with plugins
-	processedFile := fwl.fw.fm.GetPluginManager().Process(*file, fwl.fw.fm)
-	if processedFile == nil {
-		log.Printf("Warning: plugin processing returned nil for file: %s", event.Path)
-		processedFile = file
+	if fwl.fw.fm.AddFile(path) == nil {
+		return fmt.Errorf("failed to add created file to FileManager: %s", path)
 	}
+	return nil
+}
 
-	// If it's in the content directory, add a route
-	if fwl.affectsRoutes(processedFile.Path) {
-		log.Printf("Adding route for content file: %s", processedFile.Path)
-		fwl.fw.rm.AddFile(processedFile)
+// Marks a modified file, and the files which depend on it, for processing
+func (fwl *FileWatcherListener) modifyFile(path string) error {
+	if fwl.fw.fm.AddFile(path) == nil {
+		return fmt.Errorf("failed to add modified file to FileManager: %s", path)
 	}
-
-	log.Printf("Successfully processed file creation: %s", event.Path)
 	return nil
 }
 
-// HandleFileDeleted implements FileEventHandler
-func (fwl *FileWatcherListener) HandleFileDeleted(event FileWatchEvent) error {
-	path := event.Path
-	log.Printf("Processing file deletion: %s", path)
-
-	// Remove file from FileManager
+// Removes a deleted file from the FileManager. Returns true if its routes
+// have to be removed.
+func (fwl *FileWatcherListener) deleteFile(path string) bool {
+	file := fwl.fw.fm.GetFile(path)
 	fwl.fw.fm.RemoveFile(path)
-	log.Printf("Removed file from FileManager: %s", path)
-
-	// Also remove from RouterManager if it affects routes
-	if fwl.affectsRoutes(path) {
-		log.Printf("Removing routes for content file: %s", path)
-		if err := fwl.fw.rm.RemoveFile(path); err != nil {
-			// Log warning but don't fail - file might not have had routes
-			log.Printf("Warning: failed to remove file from router: %s: %v", path, err)
-		}
+	return fwl.affectsRoutes(path) || (file != nil && fwl.isRoutable(file))
+}
+
+// Moves a file in the FileManager, so that the files which depend on it keep
+// the dependency. Returns the old and the new paths whose routes change.
+func (fwl *FileWatcherListener) moveFile(oldPath, newPath string) ([]string, []string, error) {
+	fm := fwl.fw.fm
+	file := fm.GetFile(oldPath)
+	if file == nil {
+		// Moved into the site, or from an ignored path
+		return nil, []string{newPath}, fwl.createFile(newPath)
 	}
 
-	// Update all files that need to be reprocessed
-	fwl.fw.fm.ProcessUpdatedFiles()
+	movedFrom := fwl.movedFrom(file)
+	moved := fm.MoveFile(oldPath, newPath)
+	if moved == nil {
+		return nil, nil, fmt.Errorf("failed to move %s to %s in FileManager", oldPath, newPath)
+	}
+	moved.MovedFrom = movedFrom
+	log.Printf("Moved %s to %s", oldPath, newPath)
 
-	log.Printf("Successfully processed file deletion: %s", path)
-	return nil
+	return []string{oldPath}, []string{newPath}, nil
 }
 
-// HandleDirectoryCreated implements FileEventHandler
-func (fwl *FileWatcherListener) HandleDirectoryCreated(event FileWatchEvent) error {
-	log.Printf("Processing directory creation: %s", event.Path)
+// Moves all files of a directory in the FileManager, and watches the
+// directory under its new path. Returns the old and the new paths of the files.
+func (fwl *FileWatcherListener) moveDirectory(oldPath, newPath string) ([]string, []string, error) {
+	fm := fwl.fw.fm
+	prefix := oldPath + string(filepath.Separator)
 
-	// Add new directory to watcher (convert to absolute path)
-	absolutePath := filepath.Join(fwl.fw.rootPath, event.Path)
-	log.Printf("Adding directory watch: %s (absolute: %s)", event.Path, absolutePath)
-	if err := fwl.fw.addDirectoryWatch(absolutePath); err != nil {
-		err = fmt.Errorf("failed to watch new directory %s: %v", absolutePath, err)
-		log.Printf("Error: %v", err)
-		return err
+	movedFrom := make(map[string][]string)
+	for path, file := range fm.GetAllFiles() {
+		if strings.HasPrefix(path, prefix) {
+			movedFrom[path] = fwl.movedFrom(file)
+		}
 	}
 
-	// Walk directory to add all files to FileManager
-	log.Printf("Walking directory to discover files: %s", event.Path)
-	if err := fwl.fw.fm.WalkDirectory(event.Path); err != nil {
-		err = fmt.Errorf("failed to walk new directory %s: %v", event.Path, err)
-		log.Printf("Error: %v", err)
-		return err
+	fwl.fw.removeDirectoryWatch(filepath.Join(fwl.fw.rootPath, oldPath))
+	var oldPaths, newPaths []string
+	for _, file := range fm.MoveDirectory(oldPath, newPath) {
+		oldFilePath := filepath.Join(oldPath, strings.TrimPrefix(file.Path, newPath+string(filepath.Separator)))
+		file.MovedFrom = movedFrom[oldFilePath]
+		oldPaths = append(oldPaths, oldFilePath)
+		newPaths = append(newPaths, file.Path)
 	}
+	log.Printf("Moved directory %s to %s (%d files)", oldPath, newPath, len(newPaths))
 
-	// Update all files that need to be reprocessed
-	fwl.fw.fm.ProcessUpdatedFiles()
+	// Also adds files which were created in the directory meanwhile
+	return oldPaths, newPaths, fwl.createDirectory(newPath)
+}
 
-	// Rebuild router only if the directory affects routes
-	if fwl.needsRouterRebuild(event.Path, true) {
-		log.Printf("Rebuilding router for directory affecting content routes: %s", event.Path)
-		if err := fwl.fw.rm.RebuildRouter(); err != nil {
-			err = fmt.Errorf("failed to rebuild router after directory creation %s: %v", event.Path, err)
-			log.Printf("Error: %v", err)
-			return err
-		}
-	} else {
-		log.Printf("Skipping router rebuild for non-content directory: %s", event.Path)
+// Returns the routes which redirect to a file after it is moved: its
+// canonical route, and the routes it had before earlier moves. Only pages
+// redirect, and only if enabled.
+func (fwl *FileWatcherListener) movedFrom(file *File) []string {
+	if !fwl.fw.RedirectMoves() || !fwl.affectsRoutes(file.Path) || len(file.Routes) == 0 {
+		return file.MovedFrom
 	}
 
-	log.Printf("Successfully processed directory creation: %s", event.Path)
+	// The last route is the canonical URL of a page
+	canonical := file.Routes[len(file.Routes)-1]
+	if slices.Contains(file.MovedFrom, canonical) {
+		return file.MovedFrom
+	}
+	return append(slices.Clip(file.MovedFrom), canonical)
+}
+
+// Watches a created directory and adds its files to the FileManager
+func (fwl *FileWatcherListener) createDirectory(path string) error {
+	absolutePath := filepath.Join(fwl.fw.rootPath, path)
+	if err := fwl.fw.addDirectoryWatch(absolutePath); err != nil {
+		return fmt.Errorf("failed to watch new directory %s: %v", absolutePath, err)
+	}
+	if err := fwl.fw.fm.WalkDirectory(path); err != nil {
+		return fmt.Errorf("failed to walk new directory %s: %v", path, err)
+	}
 	return nil
 }
 
-// HandleDirectoryDeleted implements FileEventHandler
-func (fwl *FileWatcherListener) HandleDirectoryDeleted(event FileWatchEvent) error {
-	log.Printf("Processing directory deletion: %s", event.Path)
+// Stops watching a deleted directory and removes its files from the FileManager
+func (fwl *FileWatcherListener) deleteDirectory(path string) {
+	fwl.fw.removeDirectoryWatch(filepath.Join(fwl.fw.rootPath, path))
+	fwl.fw.fm.RemoveDirectory(path)
+}
 
-	// Remove directory from watcher
-	log.Printf("Removing directory watch: %s", event.Path)
-	fwl.fw.removeDirectoryWatch(event.Path)
+// HandleFileModified implements FileEventHandler
+func (fwl *FileWatcherListener) HandleFileModified(event FileWatchEvent) error {
+	log.Printf("Processing file modification: %s", event.Path)
+	return fwl.HandleBatch([]FileWatchEvent{event})
+}
 
-	// Remove directory and all its files from FileManager
-	log.Printf("Removing directory and all files from FileManager: %s", event.Path)
-	fwl.fw.fm.RemoveDirectory(event.Path)
+// HandleFileCreated implements FileEventHandler
+func (fwl *FileWatcherListener) HandleFileCreated(event FileWatchEvent) error {
+	log.Printf("Processing file creation: %s", event.Path)
+	return fwl.HandleBatch([]FileWatchEvent{event})
+}
 
-	// Update all files that need to be reprocessed due to dependency changes
-	fwl.fw.fm.ProcessUpdatedFiles()
+// HandleFileDeleted implements FileEventHandler
+func (fwl *FileWatcherListener) HandleFileDeleted(event FileWatchEvent) error {
+	log.Printf("Processing file deletion: %s", event.Path)
+	return fwl.HandleBatch([]FileWatchEvent{event})
+}
 
-	// Rebuild router only if the directory affects routes
-	if fwl.needsRouterRebuild(event.Path, true) {
-		log.Printf("Rebuilding router for directory affecting content routes: %s", event.Path)
-		if err := fwl.fw.rm.RebuildRouter(); err != nil {
-			err = fmt.Errorf("failed to rebuild router after directory deletion %s: %v", event.Path, err)
-			log.Printf("Error: %v", err)
-			return err
-		}
-	} else {
-		log.Printf("Skipping router rebuild for non-content directory: %s", event.Path)
-	}
+// HandleDirectoryCreated implements FileEventHandler
+func (fwl *FileWatcherListener) HandleDirectoryCreated(event FileWatchEvent) error {
+	log.Printf("Processing directory creation: %s", event.Path)
+	return fwl.HandleBatch([]FileWatchEvent{event})
+}
 
-	log.Printf("Successfully processed directory deletion: %s", event.Path)
-	return nil
+// HandleDirectoryDeleted implements FileEventHandler
+func (fwl *FileWatcherListener) HandleDirectoryDeleted(event FileWatchEvent) error {
+	log.Printf("Processing directory deletion: %s", event.Path)
+	return fwl.HandleBatch([]FileWatchEvent{event})
 }
@@ -58,6 +58,15 @@ func (m *mockRouterManager) RebuildRouter() error {
 	return nil
 }
 
+func (m *mockRouterManager) UpdateFiles(removed []string, added []*File) {
+	for _, filePath := range removed {
+		m.RemoveFile(filePath)
+	}
+	for _, file := range added {
+		m.AddFile(file)
+	}
+}
+
 func (m *mockRouterManager) GetAddedFiles() []*File {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -92,7 +101,7 @@ func createListenerTestEnv(t *testing.T) (*FileManager, *FileWatcher, *mockRoute
 	}
 
 	fm := NewFileManager(tempDir)
-	fw, err := NewFileWatcher(fm)
+	fw, err := newTestFileWatcher(fm)
 	if err != nil {
 		t.Fatalf("Failed to create FileWatcher: %v", err)
 	}
@@ -596,6 +605,10 @@ func TestProcessEventsIntegration(t *testing.T) {
 func TestConcurrentListenerOperations(t *testing.T) {
 	_, fw, mockRM, tempDir := createListenerTestEnv(t)
 
+	// Each step of the goroutines below is applied as its own batch; with a
+	// longer window, files which are created and deleted again are skipped
+	fw.SetDebounce(10 * time.Millisecond)
+
 	if err := fw.Start(tempDir); err != nil {
 		t.Fatalf("Failed to start FileWatcher: %v", err)
 	}
@@ -3,14 +3,31 @@ package core
 import "time"
 
 type FileMetadata struct {
-	Title            string    `yaml:"title"`
-	Author           string    `yaml:"author"`
-	CssFile          string    `yaml:"css-file"`
-	Tags             []string  `yaml:"tags"`
-	MimeType         string    `yaml:"mime-type"`
-	RedirectUrl      string    `yaml:"redirect-url"`
-	IgnoreLayout     bool      `yaml:"ignore-layout"`
-	DateOfLastUpdate time.Time `yaml:"date-of-last-update"`
+	Title            string          `yaml:"title"`
+	Date             time.Time       `yaml:"date"` // Used by permalink patterns
+	Slug             string          `yaml:"slug"` // Used by permalink patterns instead of the file name
+	Url              string          `yaml:"url"`  // Overrides the route of the page
+	Author           string          `yaml:"author"`
+	CssFile          string          `yaml:"css-file"`
+	Tags             []string        `yaml:"tags"`
+	MimeType         string          `yaml:"mime-type"`
+	RedirectUrl      string          `yaml:"redirect-url"`
+	RedirectStatus   int             `yaml:"redirect-status"` // 302 if not specified
+	Aliases          []string        `yaml:"aliases"`         // Old URLs which redirect to this page
+	IgnoreLayout     bool            `yaml:"ignore-layout"`
+	DateOfLastUpdate time.Time       `yaml:"date-of-last-update"`
+	Images           []ImageMetadata `yaml:"images"`
+
+	// Directives which replace those of the site's Content-Security-Policy
+	ContentSecurityPolicy map[string]string `yaml:"content-security-policy"`
+}
+
+// ImageMetadata declares an image for which responsive variants are generated
+type ImageMetadata struct {
+	Src    string `yaml:"src"`
+	Alt    string `yaml:"alt"`
+	Sizes  string `yaml:"sizes"`
+	Widths []int  `yaml:"widths"`
 }
 
 type DirectoryMetadata struct {
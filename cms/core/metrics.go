@@ -214,7 +214,11 @@ type MetricsCollector struct {
 	FilesTotal              *Gauge
 	FileProcessingDuration  *Histogram
 	FileWatcherEvents       *Counter
+	FileWatcherLostEvents   *Counter
+	FileWatcherResyncs      *Counter
 	FileOperationsTotal     *Counter
+	FileCacheHits           *Counter
+	FileCacheMisses         *Counter
 
 	// Plugin metrics
 	PluginExecutionDuration *Histogram
@@ -254,7 +258,11 @@ func NewMetricsCollector() *MetricsCollector {
 		FilesTotal:              NewGauge("files_total", "Total number of files managed"),
 		FileProcessingDuration:  NewHistogram("file_processing_duration_ms", "File processing duration in milliseconds"),
 		FileWatcherEvents:       NewCounter("file_watcher_events_total", "Total number of file watcher events"),
+		FileWatcherLostEvents:   NewCounter("file_watcher_lost_events_total", "Total number of file watcher events which were dropped or overflowed"),
+		FileWatcherResyncs:      NewCounter("file_watcher_resyncs_total", "Total number of rescans of the site after lost file watcher events"),
 		FileOperationsTotal:     NewCounter("file_operations_total", "Total number of file operations"),
+		FileCacheHits:           NewCounter("file_processing_cache_hits_total", "Total number of files which kept their processed content because their inputs did not change"),
+		FileCacheMisses:         NewCounter("file_processing_cache_misses_total", "Total number of files which were processed by their plugins"),
 
 		// Plugin metrics
 		PluginExecutionDuration: NewHistogram("plugin_execution_duration_ms", "Plugin execution duration in milliseconds"),
@@ -324,7 +332,11 @@ func (mc *MetricsCollector) GetAllMetrics() map[string]interface{} {
 		// File system metrics
 		"files_total":                 mc.FilesTotal.Get(),
 		"file_watcher_events_total":   mc.FileWatcherEvents.Get(),
+		"file_watcher_lost_events_total": mc.FileWatcherLostEvents.Get(),
+		"file_watcher_resyncs_total":  mc.FileWatcherResyncs.Get(),
 		"file_operations_total":       mc.FileOperationsTotal.Get(),
+		"file_processing_cache_hits_total": mc.FileCacheHits.Get(),
+		"file_processing_cache_misses_total": mc.FileCacheMisses.Get(),
 		"file_processing_duration":    mc.getHistogramData(mc.FileProcessingDuration),
 
 		// Plugin metrics
@@ -491,6 +503,22 @@ func RecordFileWatcherEvent() {
 	GlobalMetrics.FileWatcherEvents.Inc()
 }
 
+func RecordFileWatcherLostEvent() {
+	GlobalMetrics.FileWatcherLostEvents.Inc()
+}
+
+func RecordFileWatcherResync() {
+	GlobalMetrics.FileWatcherResyncs.Inc()
+}
+
+func RecordFileCacheHit() {
+	GlobalMetrics.FileCacheHits.Inc()
+}
+
+func RecordFileCacheMiss() {
+	GlobalMetrics.FileCacheMisses.Inc()
+}
+
 func RecordPluginError() {
 	GlobalMetrics.PluginErrorsTotal.Inc()
 }
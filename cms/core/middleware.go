@@ -1,34 +1,75 @@
 package core
 
 import (
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter implements a simple rate limiting middleware
+// RateLimiter limits the requests of each client with token buckets: a
+// bucket holds up to "burst" tokens, every request takes one, and tokens are
+// refilled at the configured rate. Each class of requests (pages, assets,
+// search, metrics) has its own buckets.
 type RateLimiter struct {
-	mu       sync.RWMutex
-	clients  map[string]*Client
-	limit    int
-	window   time.Duration
+	mu       sync.Mutex
+	buckets  map[bucketKey]*bucket
+	classes  map[string]rateLimitClass
 	cleanupC chan struct{}
+
+	config         RateLimit
+	trustedProxies []*net.IPNet
+	allowlist      []*net.IPNet
+}
+
+// The limits of a class of requests
+type rateLimitClass struct {
+	rate      float64 // Tokens per second
+	burst     int     // Size of the bucket
+	paths     []string
+	unlimited bool
+}
+
+type bucketKey struct {
+	class    string
+	clientIP string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
 }
 
-type Client struct {
-	requests []time.Time
-	blocked  time.Time
+// The decision of the rate limiter about a request
+type rateDecision struct {
+	allowed    bool
+	limit      int           // Size of the bucket
+	remaining  int           // Tokens left after the request
+	reset      time.Duration // Time until the bucket is full again
+	retryAfter time.Duration // Time until the next request is allowed
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(requestsPerMinute int) *RateLimiter {
+// NewRateLimiter creates a new rate limiter. The configuration is expected
+// to be valid, invalid networks are ignored.
+func NewRateLimiter(config RateLimit) *RateLimiter {
+	trustedProxies, _ := parseNetworks(config.TrustedProxies)
+	allowlist, _ := parseNetworks(config.Allowlist)
+
 	rl := &RateLimiter{
-		clients:  make(map[string]*Client),
-		limit:    requestsPerMinute,
-		window:   time.Minute,
-		cleanupC: make(chan struct{}),
+		buckets:        make(map[bucketKey]*bucket),
+		classes:        make(map[string]rateLimitClass),
+		cleanupC:       make(chan struct{}),
+		config:         config,
+		trustedProxies: trustedProxies,
+		allowlist:      allowlist,
+	}
+	for _, name := range RateLimitClasses {
+		rl.classes[name] = config.class(name)
 	}
 
 	// Start cleanup goroutine
@@ -40,9 +81,36 @@ func NewRateLimiter(requestsPerMinute int) *RateLimiter {
 // Middleware returns a Gin middleware function
 func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
+		if rl.config.RequestsPerMinute < 0 || rl.config.isExempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		ip := rl.clientIP(c)
+		if ip != nil && containsIP(rl.allowlist, ip) {
+			c.Next()
+			return
+		}
 
-		if !rl.Allow(clientIP) {
+		clientIP := ""
+		if ip != nil {
+			clientIP = ip.String()
+		}
+		class := rl.classify(c.Request.URL.Path)
+		if rl.classes[class].unlimited {
+			c.Next()
+			return
+		}
+		decision := rl.take(class, clientIP, time.Now())
+
+		// The headers of the IETF draft "RateLimit header fields for HTTP"
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(seconds(decision.reset)))
+
+		if !decision.allowed {
+			header.Set("Retry-After", strconv.Itoa(seconds(decision.retryAfter)))
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "Too many requests",
 			})
@@ -53,52 +121,100 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	}
 }
 
-// Allow checks if a request should be allowed
+// Rounds a duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Returns the class of a request, by its path
+func (rl *RateLimiter) classify(requestPath string) string {
+	for _, name := range RateLimitClasses {
+		if matchesPath(rl.classes[name].paths, requestPath) {
+			return name
+		}
+	}
+	return RateLimitPages
+}
+
+// Returns the IP of the client. X-Forwarded-For is only used if the request
+// comes from a trusted proxy, otherwise clients could choose their IP. Each
+// proxy appends the address it received the request from, so the client is
+// the last address which is not a trusted proxy; addresses before it can be
+// forged. X-Real-IP is used if there is no X-Forwarded-For header.
+func (rl *RateLimiter) clientIP(c *gin.Context) net.IP {
+	remoteIP, _ := c.RemoteIP()
+	if remoteIP == nil || !containsIP(rl.trustedProxies, remoteIP) {
+		return remoteIP
+	}
+
+	var forwarded []string
+	for _, header := range c.Request.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	if len(forwarded) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-IP"))); ip != nil {
+			return ip
+		}
+		return remoteIP
+	}
+
+	client := remoteIP
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break // Everything before a malformed address is untrustworthy
+		}
+		client = ip
+		if !containsIP(rl.trustedProxies, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// Allow checks if a request for a page should be allowed
 func (rl *RateLimiter) Allow(clientIP string) bool {
+	return rl.take(RateLimitPages, clientIP, time.Now()).allowed
+}
+
+// Takes a token from the bucket of a client, if there is one
+func (rl *RateLimiter) take(class, clientIP string, now time.Time) rateDecision {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	RecordRateLimitHit()
 
-	now := time.Now()
-	client, exists := rl.clients[clientIP]
+	limits := rl.classes[class]
+	key := bucketKey{class: class, clientIP: clientIP}
+	b, exists := rl.buckets[key]
 	if !exists {
-		client = &Client{
-			requests: make([]time.Time, 0),
-		}
-		rl.clients[clientIP] = client
+		b = &bucket{tokens: float64(limits.burst), updated: now}
+		rl.buckets[key] = b
 	}
 
-	// Check if client is temporarily blocked
-	if now.Before(client.blocked) {
-		RecordRateLimitBlock()
-		return false
-	}
-
-	// Remove old requests outside the window
-	cutoff := now.Add(-rl.window)
-	validRequests := make([]time.Time, 0)
-	for _, reqTime := range client.requests {
-		if reqTime.After(cutoff) {
-			validRequests = append(validRequests, reqTime)
-		}
-	}
-	client.requests = validRequests
+	// Refill the tokens since the last request
+	b.tokens = math.Min(float64(limits.burst), b.tokens+now.Sub(b.updated).Seconds()*limits.rate)
+	b.updated = now
 
-	// Check if limit exceeded
-	if len(client.requests) >= rl.limit {
-		// Block for the remaining time window
-		client.blocked = now.Add(rl.window)
+	decision := rateDecision{limit: limits.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = rl.refillTime(1-b.tokens, limits.rate)
 		RecordRateLimitBlock()
-		return false
 	}
+	decision.remaining = int(b.tokens)
+	decision.reset = rl.refillTime(float64(limits.burst)-b.tokens, limits.rate)
+	return decision
+}
 
-	// Add current request
-	client.requests = append(client.requests, now)
-	return true
+// Returns the time until the given number of tokens is refilled
+func (rl *RateLimiter) refillTime(tokens, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
 }
 
-// cleanup removes old client entries
+// cleanup removes the buckets which are full, they are the same as new ones
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
@@ -108,12 +224,10 @@ func (rl *RateLimiter) cleanup() {
 		case <-ticker.C:
 			rl.mu.Lock()
 			now := time.Now()
-			cutoff := now.Add(-rl.window * 2)
-
-			for ip, client := range rl.clients {
-				// Remove clients with no recent requests
-				if len(client.requests) == 0 || (len(client.requests) > 0 && client.requests[len(client.requests)-1].Before(cutoff)) {
-					delete(rl.clients, ip)
+			for key, b := range rl.buckets {
+				limits := rl.classes[key.class]
+				if b.tokens+now.Sub(b.updated).Seconds()*limits.rate >= float64(limits.burst) {
+					delete(rl.buckets, key)
 				}
 			}
 			rl.mu.Unlock()
@@ -128,26 +242,12 @@ func (rl *RateLimiter) Stop() {
 	close(rl.cleanupC)
 }
 
-// SecurityHeadersMiddleware adds security headers to responses
-func SecurityHeadersMiddleware() gin.HandlerFunc {
+// SecurityHeadersMiddleware adds security headers to responses. The
+// settings are read on every request, so that they can change.
+func SecurityHeadersMiddleware(security func() Security) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Prevent content sniffing
-		c.Header("X-Content-Type-Options", "nosniff")
-
-		// Prevent page rendering in frames (clickjacking protection)
-		c.Header("X-Frame-Options", "DENY")
-
-		// Enable XSS protection
-		c.Header("X-XSS-Protection", "1; mode=block")
-
-		// Enforce HTTPS (if serving over HTTPS)
-		// c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-
-		// Prevent referrer leakage
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-
-		// Content Security Policy - basic policy
-		c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'")
+		settings := security()
+		settings.SetHeaders(c.Writer.Header())
 
 		c.Next()
 	}
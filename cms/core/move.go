@@ -0,0 +1,112 @@
+package core
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Moves a file to a new path (thread-safe). Files which depend on it keep
+// the dependency, and are processed again together with the moved file. A
+// file which existed at the new path is replaced; its dependents depend on
+// the moved file afterwards. Returns nil if the file is unknown.
+func (fm *FileManager) MoveFile(oldPath, newPath string) *File {
+	fm.mu.Lock()
+	file := fm.moveFileUnsafe(filepath.Clean(oldPath), filepath.Clean(newPath))
+	fm.mu.Unlock()
+
+	if file != nil {
+		fm.pluginManager.RemoveFile(filepath.Clean(oldPath))
+	}
+	return file
+}
+
+// Moves all files below a directory to a new directory (thread-safe), and
+// returns the moved files
+func (fm *FileManager) MoveDirectory(oldPath, newPath string) []*File {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	prefix := oldPath + string(filepath.Separator)
+
+	fm.mu.Lock()
+	var paths []string
+	for path := range fm.Files {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	moved := make([]*File, 0, len(paths))
+	for _, path := range paths {
+		target := filepath.Join(newPath, strings.TrimPrefix(path, prefix))
+		if file := fm.moveFileUnsafe(path, target); file != nil {
+			moved = append(moved, file)
+		}
+	}
+
+	if dir := fm.findDirectory(oldPath); dir != nil && dir.Parent != nil {
+		delete(dir.Parent.Subdirs, dir.Name)
+	}
+	fm.mu.Unlock()
+
+	for _, path := range paths {
+		fm.pluginManager.RemoveFile(path)
+	}
+	return moved
+}
+
+// Moves a file (assumes lock is held)
+func (fm *FileManager) moveFileUnsafe(oldPath, newPath string) *File {
+	file, exists := fm.Files[oldPath]
+	if !exists || oldPath == newPath {
+		return file
+	}
+
+	if file.Parent != nil {
+		delete(file.Parent.Files, file.Name)
+	}
+	delete(fm.Files, oldPath)
+	delete(fm.data, oldPath)
+	delete(fm.processed, oldPath)
+	fm.markTranslationsForUpdate(file)
+
+	// The moved file takes over the dependents of the file it replaces
+	if replaced, exists := fm.Files[newPath]; exists {
+		for path, dependent := range replaced.Dependents {
+			file.Dependents[path] = dependent
+			dependent.Dependencies[newPath] = file
+		}
+		for _, dependency := range replaced.Dependencies {
+			delete(dependency.Dependents, newPath)
+		}
+	}
+
+	parentDir := fm.root
+	if dirPath := filepath.Dir(newPath); dirPath != "." {
+		parentDir = fm.createDirectory(dirPath)
+	}
+	file.Name = filepath.Base(newPath)
+	file.Path = newPath
+	file.Parent = parentDir
+	parentDir.Files[file.Name] = file
+	fm.Files[newPath] = file
+	fm.assignLanguage(file)
+
+	// Dependencies are stored under the path of the file
+	for _, dependency := range file.Dependencies {
+		delete(dependency.Dependents, oldPath)
+		dependency.Dependents[newPath] = file
+	}
+	for _, dependent := range file.Dependents {
+		delete(dependent.Dependencies, oldPath)
+		dependent.Dependencies[newPath] = file
+	}
+
+	fm.statSource(file)
+	fm.readFrontmatter(file)
+
+	// The routes of the file change, and so may the pages which link to it
+	file.MarkForUpdate()
+	fm.markTranslationsForUpdate(file)
+	return file
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removedFilesPlugin struct {
+	removed []string
+}
+
+func (p *removedFilesPlugin) Name() string                         { return "removed-files" }
+func (p *removedFilesPlugin) Priority() int                        { return 0 }
+func (p *removedFilesPlugin) CanProcess(file *File) bool           { return false }
+func (p *removedFilesPlugin) Process(*PluginContext) *PluginResult { return &PluginResult{} }
+func (p *removedFilesPlugin) RemoveFile(path string)               { p.removed = append(p.removed, path) }
+
+func TestFileManagerMoveFile(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"content/page.md", "content/blog/post.md", "content/blog/draft.md", "layout/header.html"} {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+
+	fm := NewFileManager(tempDir)
+	plugin := &removedFilesPlugin{}
+	fm.GetPluginManager().RegisterPlugin(plugin)
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+
+	// The page depends on the header and on the post
+	page := fm.GetFile("content/page.md")
+	page.AddDependency(fm.GetFile("layout/header.html"))
+	page.AddDependency(fm.GetFile("content/blog/post.md"))
+
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "content/blog/post.md"), filepath.Join(tempDir, "content/post.md")))
+	moved := fm.MoveFile("content/blog/post.md", "content/post.md")
+	require.NotNil(t, moved)
+
+	assert.Nil(t, fm.GetFile("content/blog/post.md"))
+	assert.Same(t, moved, fm.GetFile("content/post.md"))
+	assert.Equal(t, "post.md", moved.Name)
+	assert.Same(t, fm.GetDirectory("content"), moved.Parent)
+	assert.NotContains(t, fm.GetDirectory("content/blog").Files, "post.md")
+
+	// The page still depends on the moved file, and is processed again
+	assert.Same(t, moved, page.Dependencies["content/post.md"])
+	assert.NotContains(t, page.Dependencies, "content/blog/post.md")
+	assert.Same(t, page, moved.Dependents["content/page.md"])
+	assert.True(t, page.NeedsUpdate())
+	assert.Equal(t, []string{"content/blog/post.md"}, plugin.removed)
+
+	// Directories are moved with all their files
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "content/blog"), filepath.Join(tempDir, "content/notes")))
+	files := fm.MoveDirectory("content/blog", "content/notes")
+	require.Len(t, files, 1)
+	assert.Equal(t, "content/notes/draft.md", files[0].Path)
+	assert.NotNil(t, fm.GetFile("content/notes/draft.md"))
+	assert.Nil(t, fm.GetFile("content/blog/draft.md"))
+	assert.Nil(t, fm.GetDirectory("content/blog"))
+	assert.Equal(t, []string{"content/blog/post.md", "content/blog/draft.md"}, plugin.removed)
+
+	assert.Nil(t, fm.MoveFile("content/missing.md", "content/other.md"))
+}
+
+func TestFileMoveFlow(t *testing.T) {
+	suite := setupIntegrationTest(t)
+	defer suite.teardown()
+	suite.fw.SetRedirectMoves(true)
+
+	oldPath := filepath.Join(suite.tempDir, "content/posts/old.md")
+	require.NoError(t, os.WriteFile(oldPath, []byte("# Post"), 0644))
+	require.Eventually(t, func() bool {
+		return suite.rm.RouteExists("/posts/old")
+	}, 2*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, os.Rename(oldPath, filepath.Join(suite.tempDir, "content/posts/new.md")))
+	require.Eventually(t, func() bool {
+		return suite.rm.RouteExists("/posts/new")
+	}, 2*time.Second, 20*time.Millisecond)
+
+	assert.Nil(t, suite.fm.GetFile("content/posts/old.md"))
+	moved := suite.fm.GetFile("content/posts/new.md")
+	require.NotNil(t, moved)
+	assert.Equal(t, []string{"/posts/old"}, moved.MovedFrom)
+
+	// The old route redirects to the new one
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/posts/old", nil)
+	suite.rm.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/posts/new", w.Header().Get("Location"))
+}
@@ -60,3 +60,26 @@ func InitializeNavigation(context *Context) (Navigation, error) {
 	}
 	return navigation, nil
 }
+
+// Reads config/navigation.<lang>.yaml for every configured language. Languages
+// without their own file fall back to the default navigation.
+func InitializeLocalizedNavigation(context *Context) (map[string]Navigation, error) {
+	navigations := make(map[string]Navigation)
+
+	for _, lang := range context.Config.Languages.Available {
+		name := fmt.Sprintf("navigation.%s.yaml", lang.Code)
+		path := filepath.Join(context.Config.SiteDirectory, "config", name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			navigations[lang.Code] = context.Navigation
+			continue
+		}
+
+		navigation, err := readNavigationYaml(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		navigations[lang.Code] = navigation
+	}
+
+	return navigations, nil
+}
@@ -2,6 +2,9 @@ package core
 
 import (
 	"fmt"
+	"log"
+	"mime"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -41,6 +44,12 @@ type Plugin interface {
 	Priority() int
 }
 
+// FileRemover is implemented by plugins which keep state about files, e.g.
+// the search index. RemoveFile is called when a file is deleted or moved.
+type FileRemover interface {
+	RemoveFile(path string)
+}
+
 // PluginManager manages all registered plugins
 type PluginManager struct {
 	mu      sync.RWMutex
@@ -93,6 +102,19 @@ func (pm *PluginManager) GetPluginsForFile(file *File) []Plugin {
 	return matchingPlugins
 }
 
+// GetPlugin returns the plugin with the given name, or nil if it is not registered
+func (pm *PluginManager) GetPlugin(name string) Plugin {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, plugin := range pm.plugins {
+		if plugin.Name() == name {
+			return plugin
+		}
+	}
+	return nil
+}
+
 // ListPlugins returns information about all registered plugins
 func (pm *PluginManager) ListPlugins() []string {
 	pm.mu.RLock()
@@ -117,16 +139,51 @@ func (pm *PluginManager) ListPlugins() []string {
 	return list
 }
 
+// Notifies the plugins which keep state about files that a file was deleted
+// or moved
+func (pm *PluginManager) RemoveFile(path string) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, plugin := range pm.plugins {
+		if remover, ok := plugin.(FileRemover); ok {
+			remover.RemoveFile(path)
+		}
+	}
+}
+
 // Processes a file with all applicable plugins. Returns a copy of the modified file.
 func (pm *PluginManager) Process(copy File, fm *FileManager) *File {
+	// Large files are streamed from disk instead
+	if fm.streamFile(&copy) {
+		return &copy
+	}
+
+	// Files whose inputs did not change are not processed again
+	if copy.SourceHash == "" {
+		copy.SourceHash = fm.sourceHash(&copy)
+	}
+	copy.InputHash = fm.inputHash(&copy)
+	if fm.reuseProcessed(&copy) {
+		RecordFileCacheHit()
+		fm.storeProcessed(&copy) // ... with the current modification time
+		return &copy
+	}
+	RecordFileCacheMiss()
+
 	plugins := pm.GetPluginsForFile(&copy)
 
+	// Output files are always re-generated
+	copy.OutputFiles = nil
+
 	ctx := &PluginContext{
 		File:          &copy,
 		FileManager:   fm,
 		SiteDirectory: fm.SiteDirectory,
 	}
 
+	var dependencies []*File
+	failed := false
 	for _, plugin := range plugins {
 		timer := NewPluginExecutionTimer()
 		result := plugin.Process(ctx)
@@ -136,29 +193,24 @@ func (pm *PluginManager) Process(copy File, fm *FileManager) *File {
 		if !result.Success && result.Error != nil {
 			RecordPluginError()
 		}
+		failed = failed || !result.Success
 
 		// If plugin modified the file content, update it
 		if result.Modified && result.NewContent != nil {
 			copy.Content = result.NewContent
 		}
 
-		// Handle additional output files
-		/*
-			if result.OutputFiles != nil {
-				for outputPath, content := range result.OutputFiles {
-					// Add output files to the file manager
-					file := fm.AddFile(outputPath)
-					file.Content = content
-					// TODO also add dependencies!?
-				}
+		// Collect additional output files
+		for route, content := range result.OutputFiles {
+			if copy.OutputFiles == nil {
+				copy.OutputFiles = make(map[string][]byte)
 			}
-		*/
-
-		// Store dependencies
-		for _, dep := range result.Dependencies {
-			copy.AddDependency(dep)
+			copy.OutputFiles[route] = content
 		}
 
+		// Collect dependencies
+		dependencies = append(dependencies, result.Dependencies...)
+
 		// Merge metadata
 		if result.MimeType != "" {
 			copy.Metadata.MimeType = result.MimeType
@@ -170,5 +222,38 @@ func (pm *PluginManager) Process(copy File, fm *FileManager) *File {
 		}
 	}
 
+	// The Content-Security-Policy from the frontmatter is checked once, not
+	// on every request; invalid directives are ignored
+	if err := validateCspDirectives(copy.Metadata.ContentSecurityPolicy); err != nil {
+		log.Printf("Warning: %s: %v", copy.Path, err)
+		copy.Metadata.ContentSecurityPolicy = nil
+	}
+
+	// Other files are processed at the same time
+	fm.addDependencies(&copy, dependencies)
+
+	// The inputs include the dependencies which were found
+	if len(dependencies) > 0 {
+		copy.InputHash = fm.inputHash(&copy)
+	}
+
+	// Compress the content once, instead of on every request
+	if fm.updateCacheValidators(&copy) {
+		copy.Compressed = Compress(copy.Content, copy.Metadata.MimeType)
+	}
+	copy.CompressedOutputFiles = nil
+	for route, content := range copy.OutputFiles {
+		if encodings := Compress(content, mime.TypeByExtension(path.Ext(route))); encodings != nil {
+			if copy.CompressedOutputFiles == nil {
+				copy.CompressedOutputFiles = make(map[string]Encodings)
+			}
+			copy.CompressedOutputFiles[route] = encodings
+		}
+	}
+
+	// Failed files are processed again, even if nothing changed
+	if !failed {
+		fm.storeProcessed(&copy)
+	}
 	return &copy
 }
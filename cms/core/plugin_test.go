@@ -303,3 +303,60 @@ func TestProcessMultiplePlugins(t *testing.T) {
 		t.Errorf("Expected 'modified content', got '%s'", string(result.Content))
 	}
 }
+
+func TestGetPlugin(t *testing.T) {
+	pm := NewPluginManager()
+	pm.RegisterPlugin(&mockPlugin{name: "plugin1", priority: 10})
+	pm.RegisterPlugin(&mockPlugin{name: "plugin2", priority: 5})
+
+	if plugin := pm.GetPlugin("plugin1"); plugin == nil || plugin.Name() != "plugin1" {
+		t.Errorf("Expected plugin1, got %v", plugin)
+	}
+
+	if plugin := pm.GetPlugin("missing"); plugin != nil {
+		t.Errorf("Expected nil for unknown plugin, got %v", plugin)
+	}
+}
+
+func TestProcessOutputFiles(t *testing.T) {
+	pm := NewPluginManager()
+
+	pm.RegisterPlugin(NewMockPlugin("first", 10).WithProcessFunc(func(ctx *PluginContext) *PluginResult {
+		return &PluginResult{
+			Success:     true,
+			OutputFiles: map[string][]byte{"/image-480w.jpg": []byte("small")},
+		}
+	}))
+	pm.RegisterPlugin(NewMockPlugin("second", 20).WithProcessFunc(func(ctx *PluginContext) *PluginResult {
+		return &PluginResult{
+			Success:     true,
+			OutputFiles: map[string][]byte{"/image-960w.jpg": []byte("large")},
+		}
+	}))
+
+	original := File{
+		Path:         "content/page.md",
+		Dependencies: make(map[string]*File),
+		Dependents:   make(map[string]*File),
+		OutputFiles:  map[string][]byte{"/stale.jpg": []byte("stale")},
+	}
+	fm := &FileManager{SiteDirectory: "/test"}
+
+	result := pm.Process(original, fm)
+
+	if len(result.OutputFiles) != 2 {
+		t.Fatalf("Expected 2 output files, got %d", len(result.OutputFiles))
+	}
+	if string(result.OutputFiles["/image-480w.jpg"]) != "small" {
+		t.Errorf("Unexpected content for /image-480w.jpg: %s", result.OutputFiles["/image-480w.jpg"])
+	}
+	if string(result.OutputFiles["/image-960w.jpg"]) != "large" {
+		t.Errorf("Unexpected content for /image-960w.jpg: %s", result.OutputFiles["/image-960w.jpg"])
+	}
+	if _, exists := result.OutputFiles["/stale.jpg"]; exists {
+		t.Error("Output files of a previous run should be dropped")
+	}
+	if len(original.OutputFiles) != 1 {
+		t.Error("Original file should not be modified")
+	}
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotify receives no events on network filesystems (NFS, SMB), on many
+// Docker bind mounts, and runs out of inotify watches on large sites. The
+// polling backend instead compares the entries of the watched directories
+// with the previous scan, by modification time and size.
+
+// Poll interval, unless configured otherwise
+const DefaultPollInterval = time.Second
+
+// State of a directory entry at the last scan
+type polledEntry struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+}
+
+type pollingBackend struct {
+	mu       sync.Mutex
+	interval time.Duration
+	dirs     map[string]map[string]polledEntry // Entries of the watched directories by name
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Returns a backend which scans the watched directories at an interval
+// (DefaultPollInterval if not positive)
+func NewPollingBackend(interval time.Duration) WatchBackend {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	b := &pollingBackend{
+		interval: interval,
+		dirs:     make(map[string]map[string]polledEntry),
+		events:   make(chan fsnotify.Event, 100),
+		errors:   make(chan error, 10),
+		done:     make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *pollingBackend) Name() string {
+	return fmt.Sprintf("%s every %s", WatchPoll, b.interval)
+}
+
+// Watches a directory. The changes since the last scan of a directory which
+// is watched already are reported with the next scan.
+func (b *pollingBackend) Add(path string) error {
+	entries, err := readPolledEntries(path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("polling backend is closed")
+	}
+	if _, exists := b.dirs[path]; !exists {
+		b.dirs[path] = entries
+	}
+	return nil
+}
+
+// Stops watching a directory. Directories which no longer exist are removed
+// by the scan already, so this never fails.
+func (b *pollingBackend) Remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.dirs, path)
+	return nil
+}
+
+func (b *pollingBackend) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	b.wg.Wait()
+	close(b.events)
+	close(b.errors)
+	return nil
+}
+
+func (b *pollingBackend) Events() <-chan fsnotify.Event { return b.events }
+func (b *pollingBackend) Errors() <-chan error          { return b.errors }
+
+func (b *pollingBackend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.poll()
+		}
+	}
+}
+
+// Scans all watched directories once, and reports their changes
+func (b *pollingBackend) poll() {
+	b.mu.Lock()
+	paths := slices.Sorted(maps.Keys(b.dirs))
+	b.mu.Unlock()
+
+	removed := make(map[string]polledEntry)
+	created := make(map[string]polledEntry)
+	var modified []string
+
+	for _, dir := range paths {
+		entries, err := readPolledEntries(dir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				b.sendError(fmt.Errorf("failed to scan %s: %w", dir, err))
+				continue
+			}
+			// The directory is reported as removed by its parent
+			entries = nil
+		}
+
+		b.mu.Lock()
+		previous, watched := b.dirs[dir]
+		if watched {
+			if entries == nil {
+				delete(b.dirs, dir)
+			} else {
+				b.dirs[dir] = entries
+			}
+		}
+		b.mu.Unlock()
+		if !watched || entries == nil {
+			continue
+		}
+
+		for name, entry := range previous {
+			current, exists := entries[name]
+			path := filepath.Join(dir, name)
+			switch {
+			case !exists:
+				removed[path] = entry
+			case current.isDir != entry.isDir:
+				// Replaced, e.g. a file by a directory
+				removed[path] = entry
+				created[path] = current
+			case !current.isDir && (!current.modTime.Equal(entry.modTime) || current.size != entry.size):
+				modified = append(modified, path)
+			}
+		}
+		for name, entry := range entries {
+			if _, exists := previous[name]; !exists {
+				created[filepath.Join(dir, name)] = entry
+			}
+		}
+	}
+
+	// A rename keeps the modification time and the size. It is reported like
+	// fsnotify does, the FileWatcher pairs both events.
+	var renamed [][2]string
+	for _, oldPath := range slices.Sorted(maps.Keys(removed)) {
+		entry := removed[oldPath]
+		for _, newPath := range slices.Sorted(maps.Keys(created)) {
+			if newPath != oldPath && created[newPath] == entry {
+				renamed = append(renamed, [2]string{oldPath, newPath})
+				delete(removed, oldPath)
+				delete(created, newPath)
+				break
+			}
+		}
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(removed)) {
+		b.send(fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	}
+	for _, paths := range renamed {
+		b.send(fsnotify.Event{Name: paths[0], Op: fsnotify.Rename})
+		b.send(fsnotify.Event{Name: paths[1], Op: fsnotify.Create})
+	}
+	for _, path := range slices.Sorted(maps.Keys(created)) {
+		b.send(fsnotify.Event{Name: path, Op: fsnotify.Create})
+	}
+	slices.Sort(modified)
+	for _, path := range modified {
+		b.send(fsnotify.Event{Name: path, Op: fsnotify.Write})
+	}
+}
+
+func (b *pollingBackend) send(event fsnotify.Event) {
+	select {
+	case b.events <- event:
+	case <-b.done:
+	}
+}
+
+func (b *pollingBackend) sendError(err error) {
+	select {
+	case b.errors <- err:
+	case <-b.done:
+	}
+}
+
+// Returns the entries of a directory. Symlinks are not followed.
+func readPolledEntries(dir string) (map[string]polledEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]polledEntry, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		entries[dirEntry.Name()] = polledEntry{
+			isDir:   info.IsDir(),
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+	}
+	return entries, nil
+}
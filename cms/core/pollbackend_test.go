@@ -0,0 +1,111 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates the backend of the file watchers in the listener and integration
+// tests, see TestPollingBackendListener
+var newTestWatchBackend = NewNotifyBackend
+
+func newTestFileWatcher(fm *FileManager) (*FileWatcher, error) {
+	backend, err := newTestWatchBackend()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileWatcherWithBackend(fm, backend)
+}
+
+func TestPollingBackend(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md", "old/d.md"} {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+
+	backend := NewPollingBackend(10 * time.Millisecond)
+	require.NoError(t, backend.Add(tempDir))
+	require.NoError(t, backend.Add(filepath.Join(tempDir, "old")))
+	assert.Error(t, backend.Add(filepath.Join(tempDir, "missing")))
+
+	// All changes between two scans are reported together
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(tempDir, "a.md"), later, later))
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "b.md"), filepath.Join(tempDir, "renamed.md")))
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "c.md")))
+	require.NoError(t, os.RemoveAll(filepath.Join(tempDir, "old")))
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "new"), 0755))
+
+	var events []fsnotify.Event
+	timeout := time.After(2 * time.Second)
+	for len(events) < 6 {
+		select {
+		case event := <-backend.Events():
+			events = append(events, event)
+		case err := <-backend.Errors():
+			t.Fatalf("Unexpected error: %v", err)
+		case <-timeout:
+			t.Fatalf("Timeout waiting for events, got %v", events)
+		}
+	}
+	assert.Equal(t, []fsnotify.Event{
+		{Name: filepath.Join(tempDir, "c.md"), Op: fsnotify.Remove},
+		{Name: filepath.Join(tempDir, "old"), Op: fsnotify.Remove},
+		{Name: filepath.Join(tempDir, "b.md"), Op: fsnotify.Rename},
+		{Name: filepath.Join(tempDir, "renamed.md"), Op: fsnotify.Create},
+		{Name: filepath.Join(tempDir, "new"), Op: fsnotify.Create},
+		{Name: filepath.Join(tempDir, "a.md"), Op: fsnotify.Write},
+	}, events)
+
+	// Removing a directory which is gone already is not an error
+	assert.NoError(t, backend.Remove(filepath.Join(tempDir, "old")))
+
+	require.NoError(t, backend.Close())
+	_, open := <-backend.Events()
+	assert.False(t, open)
+	assert.NoError(t, backend.Close())
+}
+
+// Runs the tests of the listener with the polling backend, which has to
+// report the same events as fsnotify
+func TestPollingBackendListener(t *testing.T) {
+	newTestWatchBackend = func() (WatchBackend, error) {
+		return NewPollingBackend(10 * time.Millisecond), nil
+	}
+	defer func() { newTestWatchBackend = NewNotifyBackend }()
+
+	tests := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{"HandleFileCreated", TestHandleFileCreated},
+		{"HandleFileModified", TestHandleFileModified},
+		{"HandleFileDeleted", TestHandleFileDeleted},
+		{"HandleDirectoryCreated", TestHandleDirectoryCreated},
+		{"HandleDirectoryDeleted", TestHandleDirectoryDeleted},
+		{"ProcessEventsIntegration", TestProcessEventsIntegration},
+		{"ConcurrentListenerOperations", TestConcurrentListenerOperations},
+		{"RouterRebuildEfficiency", TestRouterRebuildEfficiency},
+		{"ScanChanges", TestScanChanges},
+		{"RenameTracking", TestRenameTracking},
+		{"FileCreationToRouteFlow", TestFileCreationToRouteFlow},
+		{"FileModificationFlow", TestFileModificationFlow},
+		{"FileDeletionFlow", TestFileDeleteionFlow},
+		{"DirectoryOperationsFlow", TestDirectoryOperationsFlow},
+		{"ConcurrentFileOperations", TestConcurrentFileOperations},
+		{"FileMoveFlow", TestFileMoveFlow},
+		{"IgnoreFileLiveReload", TestIgnoreFileLiveReload},
+		{"SymlinkWatching", TestSymlinkWatching},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Files are processed by a pool of workers. The files which pages are built
+// from (layouts, configuration, data and assets) are processed before the
+// pages, and a file after the files it depends on, as far as they are known
+// from the last time it was processed. Plugins must only modify the copy of
+// the file they process; shared files are changed under the lock of the
+// FileManager.
+
+// Sets the number of files which are processed in parallel, GOMAXPROCS if
+// not positive (thread-safe)
+func (fm *FileManager) SetWorkers(workers int) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.workers = workers
+}
+
+// Returns the number of files which are processed in parallel (thread-safe)
+func (fm *FileManager) Workers() int {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	if fm.workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return fm.workers
+}
+
+// Returns the stage in which a file is processed: pages after everything
+// they can be built from
+func processingStage(file *File) int {
+	if strings.HasPrefix(file.Path, "content/") {
+		return 1
+	}
+	return 0
+}
+
+// Processes files with their plugins, and replaces them with the processed
+// files. Returns the processed files.
+func (fm *FileManager) processFiles(files []*File) []*File {
+	var stages [2][]*File
+	for _, file := range files {
+		stage := processingStage(file)
+		stages[stage] = append(stages[stage], file)
+	}
+
+	workers := fm.Workers()
+	processed := make([]*File, 0, len(files))
+	for _, pending := range stages {
+		for len(pending) > 0 {
+			var ready []*File
+			ready, pending = readyFiles(pending)
+			processed = append(processed, fm.processParallel(ready, workers)...)
+		}
+	}
+	return processed
+}
+
+// Splits files into the files which depend on none of the others, and the
+// files which have to wait for them. If all files wait (a cycle), all of
+// them are ready.
+func readyFiles(files []*File) (ready, waiting []*File) {
+	pending := make(map[string]bool, len(files))
+	for _, file := range files {
+		pending[file.Path] = true
+	}
+
+	for _, file := range files {
+		waits := false
+		for path := range file.Dependencies {
+			if path != file.Path && pending[path] {
+				waits = true
+				break
+			}
+		}
+		if waits {
+			waiting = append(waiting, file)
+		} else {
+			ready = append(ready, file)
+		}
+	}
+
+	if len(ready) == 0 {
+		return waiting, nil
+	}
+	return ready, waiting
+}
+
+// Processes independent files with up to the given number of workers
+func (fm *FileManager) processParallel(files []*File, workers int) []*File {
+	processed := make([]*File, len(files))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(workers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// The processed copy replaces the file in the FileManager
+				newFile := fm.pluginManager.Process(*files[i], fm)
+				fm.mu.Lock()
+				fm.Files[files[i].Path] = newFile
+				fm.mu.Unlock()
+				processed[i] = newFile
+			}
+		}()
+	}
+
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return processed
+}
+
+// Adds the dependencies which plugins found while processing a file
+// (thread-safe)
+func (fm *FileManager) addDependencies(file *File, dependencies []*File) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for _, dependency := range dependencies {
+		file.AddDependency(dependency)
+	}
+}
+
+// Returns the content of a file which no plugin processes, e.g. a layout. It
+// is read from disk once, and again after the file changed (thread-safe).
+func (fm *FileManager) ReadContent(file *File) []byte {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if file.Content == nil {
+		file.Content = file.ReadFile(fm.SiteDirectory)
+
+		// ... and kept for the next time its inputs did not change
+		if processed := fm.processed[file.Path]; processed != nil && processed.InputHash == file.InputHash {
+			processed.Content = file.Content
+		}
+	}
+	return file.Content
+}
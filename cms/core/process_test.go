@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a plugin which renders pages with the layout. The files in deps
+// depend on another file (path -> path of the dependency).
+func newLayoutPlugin(deps map[string]string) *MockPlugin {
+	return NewMockPlugin("layout", 0).
+		WithCanProcessFunc(func(file *File) bool {
+			return !strings.HasPrefix(file.Path, "layout/")
+		}).
+		WithProcessFunc(func(ctx *PluginContext) *PluginResult {
+			result := &PluginResult{Success: true, Modified: true, NewContent: ctx.File.ReadFile(ctx.SiteDirectory)}
+			if strings.HasPrefix(ctx.File.Path, "content/") {
+				layout := ctx.FileManager.GetFile("layout/header.html")
+				result.NewContent = slices.Concat(ctx.FileManager.ReadContent(layout), result.NewContent)
+				result.Dependencies = append(result.Dependencies, layout)
+			}
+			if dep, ok := deps[ctx.File.Path]; ok {
+				result.Dependencies = append(result.Dependencies, ctx.FileManager.GetFile(dep))
+			}
+			return result
+		})
+}
+
+func TestProcessFilesParallel(t *testing.T) {
+	tempDir := t.TempDir()
+	site := NewTestDirectoryStructure(tempDir).
+		WithFile(NewTestFileBuilder("layout/header.html").WithContent("<header>")).
+		WithFile(NewTestFileBuilder("assets/a.css").WithContent("a")).
+		WithFile(NewTestFileBuilder("assets/b.css").WithContent("b")).
+		WithFile(NewTestFileBuilder("data/team.yaml").WithContent("team: []"))
+	for i := 0; i < 50; i++ {
+		site.WithFile(NewTestFileBuilder(fmt.Sprintf("content/page%d.md", i)).WithContent(fmt.Sprintf("page %d", i)))
+	}
+	files := site.Create(t)
+
+	fm := NewFileManager(tempDir)
+	fm.SetWorkers(4)
+	assert.Equal(t, 4, fm.Workers())
+	plugin := newLayoutPlugin(map[string]string{"assets/b.css": "assets/a.css"})
+	fm.GetPluginManager().RegisterPlugin(plugin)
+	for _, dir := range []string{"content", "layout", "assets", "data"} {
+		require.NoError(t, fm.WalkDirectory(dir))
+	}
+
+	fm.ProcessAllFiles()
+	order := plugin.GetProcessedFiles()
+	require.Len(t, order, len(files)-1)
+
+	// Pages are rendered after the files they are built from
+	for _, path := range []string{"assets/a.css", "assets/b.css", "data/team.yaml"} {
+		for i := 0; i < 50; i++ {
+			assert.Less(t, slices.Index(order, path), slices.Index(order, fmt.Sprintf("content/page%d.md", i)))
+		}
+	}
+	for i := 0; i < 50; i++ {
+		page := fm.GetFile(fmt.Sprintf("content/page%d.md", i))
+		assert.Equal(t, fmt.Sprintf("<header>page %d", i), string(page.Content))
+		assert.Contains(t, page.Dependencies, "layout/header.html")
+	}
+	assert.Len(t, fm.GetFile("layout/header.html").Dependents, 50)
+
+	// Known dependencies are processed first
+	plugin.Reset()
+	for _, path := range []string{"assets/b.css", "assets/a.css"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, path), []byte("changed"), 0644))
+		fm.AddFile(path)
+	}
+	processed := fm.ProcessUpdatedFiles()
+	assert.Len(t, processed, 2)
+	assert.Equal(t, []string{"assets/a.css", "assets/b.css"}, plugin.GetProcessedFiles())
+
+	fm.SetWorkers(0)
+	assert.Equal(t, runtime.GOMAXPROCS(0), fm.Workers())
+}
+
+func TestReadyFiles(t *testing.T) {
+	a := NewTestFileBuilder("assets/a.css").Build()
+	b := NewTestFileBuilder("assets/b.css").Build()
+	c := NewTestFileBuilder("assets/c.css").Build()
+	b.AddDependency(a)
+	c.AddDependency(b)
+
+	ready, waiting := readyFiles([]*File{c, b, a})
+	assert.Equal(t, []*File{a}, ready)
+	assert.Equal(t, []*File{c, b}, waiting)
+
+	// A cycle does not wait forever
+	a.AddDependency(c)
+	ready, waiting = readyFiles([]*File{c, b, a})
+	assert.Len(t, ready, 3)
+	assert.Empty(t, waiting)
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Validation error of redirects
+var ErrInvalidRedirect = errors.New("invalid redirect")
+
+// Status codes which are allowed for redirects
+var redirectStatusCodes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// Redirect sends the requests for a route to another URL. Redirects are
+// declared in config/redirects.yaml, as "aliases" in the frontmatter of a
+// page, or with "redirect-url" in the frontmatter.
+type Redirect struct {
+	From   string `yaml:"from"`   // e.g. "/old", or "/blog/*" for all routes below /blog
+	To     string `yaml:"to"`     // e.g. "/new"; ":splat" is replaced with the part matched by "*"
+	Status int    `yaml:"status"` // 301 (default), 302, 307 or 308
+	Source string `yaml:"-"`      // File which declared the redirect
+}
+
+// Source of the redirects from config/redirects.yaml
+const redirectsConfigSource = "config/redirects.yaml"
+
+type redirectsFile struct {
+	Redirects []Redirect `yaml:"redirects"`
+}
+
+func (r *Redirect) Validate() error {
+	if !strings.HasPrefix(r.From, "/") {
+		return fmt.Errorf("%w: %s must start with '/'", ErrInvalidRedirect, r.From)
+	}
+	if strings.Contains(strings.TrimSuffix(r.From, "*"), "*") {
+		return fmt.Errorf("%w: %s may only end with a wildcard", ErrInvalidRedirect, r.From)
+	}
+	if r.IsWildcard() && !strings.HasSuffix(r.From, "/*") {
+		return fmt.Errorf("%w: the wildcard of %s must be a complete path segment", ErrInvalidRedirect, r.From)
+	}
+	if r.To == "" || strings.ContainsAny(r.To, "\r\n\x00") {
+		return fmt.Errorf("%w: invalid target %q for %s", ErrInvalidRedirect, r.To, r.From)
+	}
+	if strings.Contains(r.To, ":splat") && !r.IsWildcard() {
+		return fmt.Errorf("%w: %s uses :splat without a wildcard", ErrInvalidRedirect, r.From)
+	}
+	if r.Status != 0 && !slices.Contains(redirectStatusCodes, r.Status) {
+		return fmt.Errorf("%w: unsupported status %d for %s", ErrInvalidRedirect, r.Status, r.From)
+	}
+	return nil
+}
+
+// Returns true if the redirect matches all routes below a path
+func (r *Redirect) IsWildcard() bool {
+	return strings.HasSuffix(r.From, "*")
+}
+
+// Returns the status code of the redirect, 301 if none was specified
+func (r *Redirect) StatusCode() int {
+	if r.Status == 0 {
+		return http.StatusMovedPermanently
+	}
+	return r.Status
+}
+
+// Returns the target URL if the redirect matches the route
+func (r *Redirect) Match(route string) (string, bool) {
+	if !r.IsWildcard() {
+		if route != r.From {
+			return "", false
+		}
+		return r.To, true
+	}
+
+	prefix := strings.TrimSuffix(r.From, "*")
+	if route != strings.TrimSuffix(prefix, "/") && !strings.HasPrefix(route, prefix) {
+		return "", false
+	}
+	splat := strings.TrimPrefix(strings.TrimPrefix(route, strings.TrimSuffix(prefix, "/")), "/")
+	return strings.ReplaceAll(r.To, ":splat", splat), true
+}
+
+// Reads config/redirects.yaml. The file is optional.
+func ReadRedirectsYaml(path string) ([]Redirect, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var file redirectsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for i := range file.Redirects {
+		if err := file.Redirects[i].Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		file.Redirects[i].Source = redirectsConfigSource
+	}
+	return file.Redirects, nil
+}
+
+// Returns true if a redirect takes precedence over another one for the same
+// route: the redirects from config/redirects.yaml before those of the pages,
+// which are ordered by the path of the page
+func (r Redirect) precedes(other Redirect) bool {
+	configured, otherConfigured := r.Source == redirectsConfigSource, other.Source == redirectsConfigSource
+	if configured != otherConfigured {
+		return configured
+	}
+	return r.Source < other.Source
+}
+
+// Returns the redirects which are declared by a page: its aliases point to
+// the page, and a page with "redirect-url" redirects all its routes
+func FileRedirects(file *File) []Redirect {
+	if len(file.Routes) == 0 {
+		return nil
+	}
+
+	var redirects []Redirect
+	if file.Metadata.RedirectUrl != "" {
+		status := file.Metadata.RedirectStatus
+		if status == 0 {
+			status = http.StatusFound
+		}
+		for _, route := range file.Routes {
+			redirects = append(redirects, Redirect{
+				From:   route,
+				To:     file.Metadata.RedirectUrl,
+				Status: status,
+				Source: file.Path,
+			})
+		}
+	}
+
+	// The last route is the canonical URL of a page. Routes from which the
+	// page was moved redirect like aliases, unless it was moved back.
+	for _, alias := range slices.Concat(file.Metadata.Aliases, file.MovedFrom) {
+		if slices.Contains(file.Routes, alias) && !slices.Contains(file.Metadata.Aliases, alias) {
+			continue
+		}
+		redirects = append(redirects, Redirect{
+			From:   alias,
+			To:     file.Routes[len(file.Routes)-1],
+			Status: http.StatusMovedPermanently,
+			Source: file.Path,
+		})
+	}
+	return redirects
+}
+
+// Returns all redirects of the site: the redirects of the pages (sorted by
+// their path), followed by the rules from config/redirects.yaml
+func CollectRedirects(ctx *Context) []Redirect {
+	files := make([]*File, 0)
+	for _, file := range ctx.FileManager.GetAllFiles() {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	var redirects []Redirect
+	for _, file := range files {
+		redirects = append(redirects, FileRedirects(file)...)
+	}
+	return append(redirects, ctx.Redirects...)
+}
+
+// Returns an HTML page which redirects to a URL, for static hosting where
+// the server cannot send redirects
+func RedirectStub(url string) []byte {
+	escaped := template.HTMLEscapeString(url)
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Redirecting to %s</title>
+<link rel="canonical" href="%s">
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+<body>
+<a href="%s">%s</a>
+</body>
+</html>
+`, escaped, escaped, escaped, escaped, escaped))
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedirectValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect Redirect
+		wantErr  bool
+	}{
+		{"exact", Redirect{From: "/old", To: "/new"}, false},
+		{"external target", Redirect{From: "/old", To: "https://example.com/", Status: 308}, false},
+		{"wildcard", Redirect{From: "/blog/*", To: "/posts/:splat"}, false},
+		{"relative source", Redirect{From: "old", To: "/new"}, true},
+		{"wildcard in the middle", Redirect{From: "/blog/*/old", To: "/new"}, true},
+		{"partial wildcard", Redirect{From: "/blog*", To: "/new"}, true},
+		{"splat without wildcard", Redirect{From: "/old", To: "/new/:splat"}, true},
+		{"empty target", Redirect{From: "/old"}, true},
+		{"header injection", Redirect{From: "/old", To: "/new\r\nSet-Cookie: x=y"}, true},
+		{"unsupported status", Redirect{From: "/old", To: "/new", Status: 200}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.redirect.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRedirect) {
+				t.Errorf("Expected ErrInvalidRedirect, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRedirectMatch(t *testing.T) {
+	exact := Redirect{From: "/old", To: "/new"}
+	wildcard := Redirect{From: "/blog/*", To: "/posts/:splat"}
+
+	tests := []struct {
+		name     string
+		redirect Redirect
+		route    string
+		expected string
+		matches  bool
+	}{
+		{"exact", exact, "/old", "/new", true},
+		{"exact mismatch", exact, "/older", "", false},
+		{"splat", wildcard, "/blog/2025/post", "/posts/2025/post", true},
+		{"directory itself", wildcard, "/blog", "/posts/", true},
+		{"directory with slash", wildcard, "/blog/", "/posts/", true},
+		{"prefix of another directory", wildcard, "/blogroll", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, ok := tt.redirect.Match(tt.route)
+			if ok != tt.matches || target != tt.expected {
+				t.Errorf("Match(%s) = (%q, %v), expected (%q, %v)", tt.route, target, ok, tt.expected, tt.matches)
+			}
+		})
+	}
+
+	if status := exact.StatusCode(); status != http.StatusMovedPermanently {
+		t.Errorf("Expected default status 301, got %d", status)
+	}
+}
+
+func TestReadRedirectsYaml(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "redirects.yaml")
+
+	redirects, err := ReadRedirectsYaml(path)
+	if err != nil || redirects != nil {
+		t.Fatalf("Expected no redirects for missing file, got %v, %v", redirects, err)
+	}
+
+	content := "redirects:\n  - from: /old\n    to: /new\n  - from: /blog/*\n    to: /posts/:splat\n    status: 302\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write redirects.yaml: %v", err)
+	}
+	redirects, err = ReadRedirectsYaml(path)
+	if err != nil {
+		t.Fatalf("ReadRedirectsYaml failed: %v", err)
+	}
+	if len(redirects) != 2 || redirects[1].Status != http.StatusFound || redirects[0].Source != "config/redirects.yaml" {
+		t.Errorf("Unexpected redirects %+v", redirects)
+	}
+
+	if err := os.WriteFile(path, []byte("redirects:\n  - from: old\n    to: /new\n"), 0644); err != nil {
+		t.Fatalf("Failed to write redirects.yaml: %v", err)
+	}
+	if _, err := ReadRedirectsYaml(path); !errors.Is(err, ErrInvalidRedirect) {
+		t.Errorf("Expected ErrInvalidRedirect, got %v", err)
+	}
+}
+
+func TestFileRedirects(t *testing.T) {
+	page := &File{
+		Path:   "content/about.md",
+		Routes: []string{"/about.md", "/about"},
+		Metadata: FileMetadata{
+			Aliases: []string{"/about-me", "/team"},
+		},
+	}
+	redirects := FileRedirects(page)
+	if len(redirects) != 2 {
+		t.Fatalf("Expected 2 redirects, got %d", len(redirects))
+	}
+	for _, redirect := range redirects {
+		if redirect.To != "/about" || redirect.StatusCode() != http.StatusMovedPermanently {
+			t.Errorf("Expected permanent redirect to /about, got %+v", redirect)
+		}
+	}
+
+	moved := &File{
+		Path:   "content/old.md",
+		Routes: []string{"/old.md", "/old"},
+		Metadata: FileMetadata{
+			RedirectUrl: "/new",
+		},
+	}
+	redirects = FileRedirects(moved)
+	if len(redirects) != 2 || redirects[0].StatusCode() != http.StatusFound {
+		t.Errorf("Expected temporary redirects for all routes, got %+v", redirects)
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// The files in config/ are read at startup. When they are edited while the
+// server runs, they are read and validated again, and replace the current
+// configuration at once. An invalid edit is rejected, the server keeps the
+// configuration it has.
+
+// ConfigReloader replaces the configuration after a file in config/ changed
+type ConfigReloader interface {
+	ReloadConfig() error
+}
+
+// Reads the configuration files again, and replaces the configuration, the
+// users, the navigation and the redirects (thread-safe). If a file is
+// invalid, nothing is replaced and the error is returned. Settings which
+// only take effect at startup keep their current values.
+func (ctx *Context) ReloadConfig() error {
+	next := Context{Config: ctx.commandLine}
+	next.Config.Plugins = make(Plugins)
+	if err := readConfigFiles(&next); err != nil {
+		return err
+	}
+
+	var ignore *IgnoreRules
+	if ctx.FileManager != nil && !slices.Equal(next.Config.Ignore, ctx.FileManager.IgnoreRules().Patterns()) {
+		rules, err := LoadIgnoreRules(ctx.Config.SiteDirectory, next.Config.Ignore)
+		if err != nil {
+			return err
+		}
+		ignore = rules
+	}
+
+	ctx.mu.Lock()
+	if restart := next.Config.keepStartupSettings(ctx.Config); len(restart) > 0 {
+		log.Printf("Warning: changes of %s in site.yaml take effect after a restart", strings.Join(restart, ", "))
+	}
+	ctx.Config = next.Config
+	ctx.Users = next.Users
+	ctx.Navigation = next.Navigation
+	ctx.Navigations = next.Navigations
+	ctx.Redirects = next.Redirects
+	ctx.mu.Unlock()
+
+	// The files which are ignored or included now are found by a rescan
+	if ignore != nil {
+		ctx.FileManager.ignore.Store(ignore)
+		if ctx.FileWatcher != nil {
+			ctx.FileWatcher.requestRescan()
+		}
+	}
+	return nil
+}
+
+// Replaces the settings which are only applied at startup with the current
+// ones, e.g. the port of the server and the plugins. Returns the names of
+// the settings which were changed.
+func (c *Config) keepStartupSettings(current Config) []string {
+	var changed []string
+	keep := func(name string, value, currentValue any, restore func()) {
+		if !reflect.DeepEqual(value, currentValue) {
+			changed = append(changed, name)
+			restore()
+		}
+	}
+
+	keep("server.port", c.Server.Port, current.Server.Port, func() { c.Server.Port = current.Server.Port })
+	keep("server.rate-limit", c.Server.RateLimit, current.Server.RateLimit, func() { c.Server.RateLimit = current.Server.RateLimit })
+	keep("plugins", c.Plugins, current.Plugins, func() { c.Plugins = current.Plugins })
+	keep("languages", c.Languages, current.Languages, func() { c.Languages = current.Languages })
+	keep("streaming", c.Streaming, current.Streaming, func() { c.Streaming = current.Streaming })
+	keep("watcher", c.Watcher, current.Watcher, func() { c.Watcher = current.Watcher })
+	keep("follow-symlinks", c.FollowSymlinks, current.FollowSymlinks, func() { c.FollowSymlinks = current.FollowSymlinks })
+	keep("symlink-roots", c.SymlinkRoots, current.SymlinkRoots, func() { c.SymlinkRoots = current.SymlinkRoots })
+	return changed
+}
+
+// Returns true if a path is one of the configuration files, which are
+// read by ReloadConfig
+func isConfigFile(path string) bool {
+	return filepath.Dir(path) == "config" && filepath.Ext(path) == ".yaml"
+}
+
+// Sets what reloads the configuration when a file in config/ changes
+// (thread-safe). Without one, configuration files are only reprocessed.
+func (fw *FileWatcher) SetConfigReloader(reloader ConfigReloader) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.configReloader = reloader
+}
+
+// Returns true if the configuration is reloaded when a file in config/
+// changes (thread-safe). Otherwise it is only read at startup.
+func (ctx *Context) ReloadsConfig() bool {
+	if ctx.FileWatcher == nil {
+		return false
+	}
+	ctx.FileWatcher.mu.RLock()
+	defer ctx.FileWatcher.mu.RUnlock()
+	return ctx.FileWatcher.configReloader != nil
+}
+
+// Reloads the configuration if a batch of events changed a configuration
+// file. Returns true if it was replaced.
+func (fwl *FileWatcherListener) reloadConfig(events []FileWatchEvent) (bool, error) {
+	fwl.fw.mu.RLock()
+	reloader := fwl.fw.configReloader
+	fwl.fw.mu.RUnlock()
+	if reloader == nil {
+		return false, nil
+	}
+
+	changed, restructured := false, false
+	for _, event := range events {
+		switch {
+		case event.Path == "config" && event.IsDir:
+			changed, restructured = true, true
+		case isConfigFile(event.Path) || (event.OldPath != "" && isConfigFile(event.OldPath)):
+			changed = true
+			restructured = restructured || event.Type != FileModified
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := reloader.ReloadConfig(); err != nil {
+		return false, fmt.Errorf("invalid configuration, keeping the current one: %w", err)
+	}
+	log.Printf("Reloaded the configuration")
+
+	// The pages depend on the files they were rendered from, which does not
+	// cover a created file (e.g. the navigation of a language). All pages
+	// depend on site.yaml.
+	if restructured {
+		if err := fwl.modifyFile(filepath.Join("config", "site.yaml")); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a site with configuration files, and a context which was
+// initialized from them
+func createReloadTestContext(t *testing.T, siteDir string) *Context {
+	writeTestConfig(t, siteDir, map[string]string{
+		"site.yaml":       "server:\n  port: 8080\n  title: Old title\n",
+		"users.yaml":      "users:\n  - name: john\n",
+		"navigation.yaml": "main:\n  - url: /\n    title: Home\n",
+	})
+
+	ctx := &Context{Config: NewDefaultConfig()}
+	ctx.Config.SiteDirectory = siteDir
+	ctx.commandLine = ctx.Config
+	ctx.commandLine.Plugins = make(Plugins)
+	require.NoError(t, readConfigFiles(ctx))
+	return ctx
+}
+
+func writeTestConfig(t *testing.T, siteDir string, files map[string]string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(siteDir, "config"), 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(siteDir, "config", name), []byte(content), 0644))
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	siteDir := t.TempDir()
+	ctx := createReloadTestContext(t, siteDir)
+	assert.Equal(t, "Old title", ctx.Config.Server.Title)
+
+	writeTestConfig(t, siteDir, map[string]string{
+		"site.yaml":       "server:\n  port: 9090\n  title: New title\n",
+		"navigation.yaml": "main:\n  - url: /\n    title: Start\n",
+		"redirects.yaml":  "redirects:\n  - from: /old\n    to: /new\n",
+	})
+	require.NoError(t, ctx.ReloadConfig())
+
+	assert.Equal(t, "New title", ctx.Config.Server.Title)
+	assert.Equal(t, "Start", ctx.Navigation.Children[0].Title)
+	require.Len(t, ctx.Redirects, 1)
+	assert.Equal(t, "/old", ctx.Redirects[0].From)
+
+	// The server keeps listening on its port
+	assert.Equal(t, 8080, ctx.Config.Server.Port)
+	assert.Equal(t, siteDir, ctx.Config.SiteDirectory)
+
+	// An invalid edit keeps the whole configuration
+	writeTestConfig(t, siteDir, map[string]string{
+		"site.yaml":  "server:\n  title: Newer title\n",
+		"users.yaml": "users: []\n",
+	})
+	assert.Error(t, ctx.ReloadConfig())
+	assert.Equal(t, "New title", ctx.Config.Server.Title)
+	assert.Equal(t, "john", ctx.Users.Users[0].Name)
+
+	writeTestConfig(t, siteDir, map[string]string{
+		"users.yaml": "users:\n  - name: jane\n",
+		"site.yaml":  "server:\n  port: -1\n",
+	})
+	assert.Error(t, ctx.ReloadConfig())
+	assert.Equal(t, "john", ctx.Users.Users[0].Name)
+}
+
+func TestConfigHotReload(t *testing.T) {
+	fm, fw, mockRM, tempDir := createListenerTestEnv(t)
+	ctx := createReloadTestContext(t, tempDir)
+	fw.SetConfigReloader(ctx)
+	fwl := newFileWatcherListener(fw)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/page.md"), []byte("# Page"), 0644))
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("config"))
+
+	// The page was rendered with site.yaml
+	page := fm.GetFile("content/page.md")
+	page.AddDependency(fm.GetFile("config/site.yaml"))
+	page.Content = []byte("<h1>Page</h1>")
+
+	writeTestConfig(t, tempDir, map[string]string{"site.yaml": "server:\n  title: New title\n"})
+	require.NoError(t, fwl.HandleBatch([]FileWatchEvent{{Type: FileModified, Path: "config/site.yaml"}}))
+	assert.Equal(t, "New title", ctx.Config.Server.Title)
+	assert.Equal(t, 1, mockRM.GetRebuildCount())
+
+	// An invalid edit is reported, and the routes stay as they are
+	writeTestConfig(t, tempDir, map[string]string{"site.yaml": "server: [\n"})
+	assert.Error(t, fwl.HandleBatch([]FileWatchEvent{{Type: FileModified, Path: "config/site.yaml"}}))
+	assert.Equal(t, "New title", ctx.Config.Server.Title)
+	assert.Equal(t, 1, mockRM.GetRebuildCount())
+
+	// Other files do not reload the configuration
+	writeTestConfig(t, tempDir, map[string]string{"site.yaml": "server:\n  title: Unused title\n"})
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/page.md"), []byte("# Changed"), 0644))
+	require.NoError(t, fwl.HandleBatch([]FileWatchEvent{{Type: FileModified, Path: "content/page.md"}}))
+	assert.Equal(t, "New title", ctx.Config.Server.Title)
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// fsnotify reports a rename as a Rename event of the old path, followed by a
+// Create event of the new path. Both are paired into one FileRenamed event,
+// so that a moved file keeps its dependents and, optionally, its old route.
+// A Rename without a Create (e.g. a move out of the site) is a deletion.
+
+// Time in which the Create event has to follow the Rename event
+const renameWindow = 100 * time.Millisecond
+
+type pendingRename struct {
+	path   string // Absolute path before the rename
+	isDir  bool
+	time   time.Time
+	paired bool // Kept until it expires, see renameStarted
+}
+
+// Sets whether pages which are moved redirect from their old route (thread-safe)
+func (fw *FileWatcher) SetRedirectMoves(enabled bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.redirectMoves = enabled
+}
+
+// Returns true if moved pages redirect from their old route (thread-safe)
+func (fw *FileWatcher) RedirectMoves() bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.redirectMoves
+}
+
+// Remembers a renamed path until its new path is created. Returns false if
+// the path is ignored, e.g. the temporary file of an editor. A watched
+// directory reports its own rename as well, which may arrive after the
+// rename was paired already; it is ignored as a duplicate.
+func (fw *FileWatcher) renameStarted(path string) bool {
+	fw.mu.RLock()
+	isDir := fw.watchedDirs[path]
+	fw.mu.RUnlock()
+
+	if fw.ignoredPath(path, isDir) {
+		return false
+	}
+	for _, rename := range fw.renames {
+		if rename.path == path && (rename.isDir || !rename.paired) {
+			return false
+		}
+	}
+
+	fw.renames = append(fw.renames, pendingRename{path: path, isDir: isDir, time: time.Now()})
+	return true
+}
+
+// Returns the pending rename which a created path belongs to. A rename
+// keeps either the directory (e.g. "a.md" to "b.md") or the name (a move
+// to another directory) of the path.
+func (fw *FileWatcher) pairRename(path string, isDir bool) (pendingRename, bool) {
+	for i, rename := range fw.renames {
+		if rename.paired || rename.isDir != isDir || time.Since(rename.time) > renameWindow {
+			continue
+		}
+		if filepath.Dir(rename.path) == filepath.Dir(path) || filepath.Base(rename.path) == filepath.Base(path) {
+			fw.renames[i].paired = true
+			return rename, true
+		}
+	}
+	return pendingRename{}, false
+}
+
+// Reports the renames which were not paired in time as deletions. Returns
+// the time until the next pending rename expires, or 0.
+func (fw *FileWatcher) expireRenames() time.Duration {
+	remaining := fw.renames[:0]
+	for _, rename := range fw.renames {
+		if time.Since(rename.time) < renameWindow {
+			remaining = append(remaining, rename)
+		} else if !rename.paired {
+			fw.handleFileDeleted(rename.path)
+		}
+	}
+	fw.renames = remaining
+
+	if len(remaining) == 0 {
+		return 0
+	}
+	return renameWindow - time.Since(remaining[0].time)
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Events get lost if the event channel is full, or if the queue of the
+// kernel overflows (fsnotify.ErrEventOverflow). The site is then rescanned,
+// as it is when the ignore rules change:
+// the files on disk are compared with the FileManager by modification time
+// and size, and only the differences are applied.
+
+// The watcher is reported as degraded for this long after events were lost
+const resyncDegradedFor = 10 * time.Minute
+
+// Records that an event was lost and requests a resync (thread-safe)
+func (fw *FileWatcher) eventLost(reason string) {
+	RecordFileWatcherLostEvent()
+
+	fw.mu.Lock()
+	requested := fw.resyncPending
+	fw.lostEvents++
+	fw.lastLoss = time.Now()
+	fw.resyncPending = true
+	fw.mu.Unlock()
+
+	if requested {
+		return
+	}
+	log.Printf("FileWatcher lost events (%s), the site will be rescanned", reason)
+	fw.requestRescan()
+}
+
+// Requests a rescan of the site, unless one is requested already
+func (fw *FileWatcher) requestRescan() {
+	select {
+	case fw.resyncChan <- struct{}{}:
+	default:
+		// A resync is requested already
+	}
+}
+
+// Reads the ignore rules again after the ignore file changed, and rescans
+// the site for the files which are ignored or included now
+func (fw *FileWatcher) reloadIgnoreRules() {
+	if err := fw.fm.LoadIgnoreRules(fw.fm.IgnoreRules().Patterns()); err != nil {
+		log.Printf("Failed to reload the ignore rules: %v", err)
+		return
+	}
+	log.Printf("The ignore rules changed, the site will be rescanned")
+	fw.requestRescan()
+}
+
+// Returns a channel which receives a value when the site has to be rescanned
+func (fw *FileWatcher) GetResyncChannel() <-chan struct{} {
+	return fw.resyncChan
+}
+
+// Compares the site on disk with the FileManager, and returns the events
+// which lead from the FileManager to the state on disk. Also watches
+// directories which were created while events were lost.
+func (fw *FileWatcher) scanChanges() ([]FileWatchEvent, error) {
+	// Events which arrive while scanning are applied afterwards, and are
+	// harmless if the scan has seen the change already
+	fw.mu.Lock()
+	fw.resyncPending = false
+	rootPath := fw.rootPath
+	fw.mu.Unlock()
+
+	if err := fw.addDirectoryWatch(rootPath); err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %w", rootPath, err)
+	}
+
+	known := fw.fm.GetAllFiles()
+	batch := newEventBatch()
+	now := time.Now()
+
+	err := fw.fm.walkSite(rootPath, func(entry siteEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		path, info := entry.path, entry.info
+		if path == rootPath {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+
+		if fw.fm.Ignored(relPath, info) {
+			if !info.IsDir() {
+				return nil
+			}
+
+			// A directory which is ignored since the last scan is removed
+			// with its files
+			if fw.fm.GetDirectory(relPath) != nil {
+				batch.add(FileWatchEvent{Type: DirDeleted, Path: relPath, IsDir: true, Time: now})
+				prefix := relPath + string(filepath.Separator)
+				for knownPath := range known {
+					if strings.HasPrefix(knownPath, prefix) {
+						delete(known, knownPath)
+					}
+				}
+			}
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
+			// The files of a new directory are added when it is walked
+			if fw.fm.GetDirectory(relPath) == nil {
+				batch.add(FileWatchEvent{Type: DirCreated, Path: relPath, IsDir: true, Time: now})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Only files in directories are part of the site
+		if !strings.ContainsRune(relPath, filepath.Separator) {
+			return nil
+		}
+
+		file, exists := known[relPath]
+		delete(known, relPath)
+		switch {
+		case !exists:
+			batch.add(FileWatchEvent{Type: FileCreated, Path: relPath, Time: now})
+		case !file.SourceModTime.Equal(info.ModTime()) || file.SourceSize != info.Size():
+			batch.add(FileWatchEvent{Type: FileModified, Path: relPath, Time: now})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", rootPath, err)
+	}
+
+	// The remaining files were deleted, possibly with their directory
+	for relPath := range known {
+		if dir := fw.deletedDirectory(relPath); dir != "" {
+			batch.add(FileWatchEvent{Type: DirDeleted, Path: dir, IsDir: true, Time: now})
+		} else {
+			batch.add(FileWatchEvent{Type: FileDeleted, Path: relPath, Time: now})
+		}
+	}
+
+	return batch.flush(), nil
+}
+
+// Returns the topmost directory of a file which no longer exists on disk,
+// or "" if the directory of the file exists
+func (fw *FileWatcher) deletedDirectory(relPath string) string {
+	deleted := ""
+	for dir := filepath.Dir(relPath); dir != "." && dir != ""; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(fw.rootPath, dir)); err == nil {
+			break
+		}
+		deleted = dir
+	}
+	return deleted
+}
+
+// Records the result of a resync (thread-safe)
+func (fw *FileWatcher) resyncDone(err error) {
+	RecordFileWatcherResync()
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.resyncErr = err
+}
+
+// Returns an error wrapping ErrDegraded if events were lost recently, or if
+// the site could not be rescanned (thread-safe)
+func (fw *FileWatcher) checkLostEvents() error {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	switch {
+	case fw.resyncErr != nil:
+		return fmt.Errorf("%w: rescan after lost events failed: %v", ErrDegraded, fw.resyncErr)
+	case fw.resyncPending:
+		return fmt.Errorf("%w: %d events lost, rescan pending", ErrDegraded, fw.lostEvents)
+	case !fw.lastLoss.IsZero() && time.Since(fw.lastLoss) < resyncDegradedFor:
+		return fmt.Errorf("%w: %d events lost, last at %s; the site was rescanned",
+			ErrDegraded, fw.lostEvents, fw.lastLoss.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanChanges(t *testing.T) {
+	fm, fw, _, tempDir := createListenerTestEnv(t)
+
+	files := map[string]string{
+		"content/unchanged.md":    "unchanged",
+		"content/modified.md":     "modified",
+		"content/deleted.md":      "deleted",
+		"content/old/a.md":        "a",
+		"content/old/nested/b.md": "b",
+		"layout/header.html":      "<header>",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+
+	require.NoError(t, fw.Start(tempDir))
+	defer fw.Stop()
+
+	// Changes which the watcher did not report
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(tempDir, "content/modified.md"), later, later))
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "content/deleted.md")))
+	require.NoError(t, os.RemoveAll(filepath.Join(tempDir, "content/old")))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/created.md"), []byte("new"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "content/new"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/new/c.md"), []byte("c"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "site-notes.txt"), []byte("not part of the site"), 0644))
+
+	events, err := fw.scanChanges()
+	require.NoError(t, err)
+
+	changes := make([]string, len(events))
+	for i, event := range events {
+		changes[i] = fmt.Sprintf("%s %s", event.Type, event.Path)
+	}
+	assert.Equal(t, []string{
+		"FileDeleted content/deleted.md",
+		"DirDeleted content/old",
+		"FileCreated content/created.md",
+		"FileModified content/modified.md",
+		"DirCreated content/new",
+	}, changes)
+}
+
+func TestResyncAfterLostEvents(t *testing.T) {
+	fm, fw, mockRM, tempDir := createListenerTestEnv(t)
+	require.NoError(t, fw.Start(tempDir))
+	defer fw.Stop()
+
+	check := FileWatcherHealthCheck(fw)
+	assert.NoError(t, check(context.Background()))
+
+	// Without a listener, the channel fills up and events are dropped
+	for i := 0; i < cap(fw.eventChan)+10; i++ {
+		fw.sendEvent(FileWatchEvent{Type: FileModified, Path: fmt.Sprintf("content/%d.md", i)})
+	}
+	err := check(context.Background())
+	assert.True(t, errors.Is(err, ErrDegraded), "%v", err)
+	assert.Contains(t, err.Error(), "rescan pending")
+
+	// The page was written while events were lost
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/lost.md"), []byte("# Lost"), 0644))
+
+	fwl, err := RegisterFileWatcherListener(fw)
+	require.NoError(t, err)
+	defer fwl.Stop()
+
+	require.Eventually(t, func() bool {
+		for _, file := range mockRM.GetAddedFiles() {
+			if file.Path == "content/lost.md" {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.NotNil(t, fm.GetFile("content/lost.md"))
+
+	// The watcher stays degraded for a while, but the rescan is done
+	require.Eventually(t, func() bool {
+		err := check(context.Background())
+		return errors.Is(err, ErrDegraded) && strings.Contains(err.Error(), "the site was rescanned")
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -1,13 +1,17 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,27 +23,40 @@ type RouteInfo struct {
 	Method   string
 }
 
-// RouterManager manages dynamic route registration and removal
+// RouterManager manages dynamic route registration and removal. The gin
+// engine is created once; it serves the monitoring endpoints, and all other
+// requests with a single handler which looks up the route table. Routes are
+// therefore added and removed without rebuilding the engine.
 type RouterManager struct {
-	mu         sync.RWMutex
-	router     *gin.Engine
-	routes     map[string]string // pattern -> filePath mapping
-	fm         *FileManager
-	ctx        *Context
-	middleware []gin.HandlerFunc
+	mu          sync.RWMutex
+	router      *gin.Engine
+	served      atomic.Pointer[sync.Map] // route -> gin.HandlerFunc, read without locking
+	table       *routeTable              // Decides which file or redirect serves a route
+	fm          *FileManager
+	ctx         *Context
+	middleware  []gin.HandlerFunc
+	rateLimiter *RateLimiter
 }
 
 func NewRouterManager() *RouterManager {
-	return &RouterManager{
-		routes:     make(map[string]string),
+	rm := &RouterManager{
 		middleware: make([]gin.HandlerFunc, 0),
+		table:      newRouteTable(),
 	}
+	rm.served.Store(new(sync.Map))
+	return rm
 }
 
 func (rm *RouterManager) AddMiddleware(middleware ...gin.HandlerFunc) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 	rm.middleware = append(rm.middleware, middleware...)
+
+	// The engine already exists, the middleware applies to all requests
+	// except the monitoring endpoints
+	if rm.router != nil {
+		rm.router.Use(middleware...)
+	}
 }
 
 // creates a handler function for a specific file path
@@ -65,7 +82,23 @@ func (rm *RouterManager) makeFileHandler(filePath string) gin.HandlerFunc {
 
 		// Handle redirects
 		if file.Metadata.RedirectUrl != "" {
-			c.Redirect(http.StatusFound, file.Metadata.RedirectUrl)
+			status := file.Metadata.RedirectStatus
+			if status == 0 {
+				status = http.StatusFound
+			}
+			c.Redirect(status, file.Metadata.RedirectUrl)
+			return
+		}
+
+		// Pages can replace directives of the Content-Security-Policy (which
+		// were validated when the page was processed)
+		if directives := file.Metadata.ContentSecurityPolicy; len(directives) > 0 {
+			security := rm.security()
+			c.Header("Content-Security-Policy", security.ContentSecurityPolicyHeader(directives))
+		}
+
+		if file.Streamed {
+			serveFile(c, fm.SiteDirectory, file, rm.cacheControl(file.Path, false))
 			return
 		}
 
@@ -75,23 +108,164 @@ func (rm *RouterManager) makeFileHandler(filePath string) gin.HandlerFunc {
 			mimeType = "application/octet-stream"
 		}
 
-		c.Data(http.StatusOK, mimeType, file.Content)
+		serveContent(c, mimeType, file.Content, file.Compressed, file.ContentHash, file.ModTime,
+			rm.cacheControl(file.Path, false))
 	}
 }
 
-// ensures the route starts with / and has no double slashes
+// creates a handler function for a file generated by a plugin
+func (rm *RouterManager) makeOutputHandler(filePath, route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rm.mu.RLock()
+		fm := rm.fm
+		rm.mu.RUnlock()
+
+		if fm == nil {
+			log.Printf("FileManager is nil for request to %s", c.Request.URL.Path)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		file := fm.GetFile(filePath)
+		if file == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		content, exists := file.OutputFiles[route]
+		if !exists {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		mimeType := mime.TypeByExtension(path.Ext(route))
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+
+		serveContent(c, mimeType, content, file.CompressedOutputFiles[route], file.OutputHashes[route], file.ModTime,
+			rm.cacheControl(file.Path, IsFingerprinted(route)))
+	}
+}
+
+// returns the Cache-Control header for a file
+func (rm *RouterManager) cacheControl(filePath string, fingerprinted bool) string {
+	rm.mu.RLock()
+	ctx := rm.ctx
+	rm.mu.RUnlock()
+
+	var caching Caching
+	if ctx != nil {
+		ctx.mu.RLock()
+		caching = ctx.Config.Caching
+		ctx.mu.RUnlock()
+	}
+	return caching.CacheControl(filePath, fingerprinted)
+}
+
+// creates a handler function for a redirect
+func (rm *RouterManager) makeRedirectHandler(redirect Redirect) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Redirect(redirect.StatusCode(), redirect.To)
+	}
+}
+
+// serves all requests except the monitoring endpoints: the routes of files
+// and redirects, otherwise the wildcard redirects. If nothing matches, gin
+// responds with 404.
+func (rm *RouterManager) handleRoute(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return
+	}
+
+	route := c.Request.URL.Path
+	if handler, exists := rm.lookup(route); exists {
+		handler(c)
+		return
+	}
+
+	// Other URLs of a page are redirected to its canonical URL, e.g.
+	// "/about.html" and "/about/" to "/about". The routes of permalink
+	// patterns and of "url" in the frontmatter keep their trailing slash (or
+	// its absence), so the route with (or without) one is tried as well.
+	toggled := route + "/"
+	if strings.HasSuffix(route, "/") {
+		toggled = strings.TrimSuffix(route, "/")
+	}
+	for _, target := range []string{rm.urlPolicy().Canonical(route), toggled} {
+		if _, exists := rm.lookup(target); !exists || target == route {
+			continue
+		}
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, target)
+		return
+	}
+
+	rm.mu.RLock()
+	wildcards := rm.table.wildcards
+	rm.mu.RUnlock()
+
+	for _, redirect := range wildcards {
+		if target, ok := redirect.Match(route); ok {
+			c.Redirect(redirect.StatusCode(), target)
+			return
+		}
+	}
+}
+
+// returns the handler of a route
+func (rm *RouterManager) lookup(route string) (gin.HandlerFunc, bool) {
+	handler, exists := rm.served.Load().Load(route)
+	if !exists {
+		return nil, false
+	}
+	return handler.(gin.HandlerFunc), true
+}
+
+// returns the URL policy from site.yaml
+func (rm *RouterManager) urlPolicy() UrlPolicy {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	if rm.ctx == nil {
+		return UrlPolicy{}
+	}
+	rm.ctx.mu.RLock()
+	defer rm.ctx.mu.RUnlock()
+	return rm.ctx.Config.Urls
+}
+
+// returns the security headers from site.yaml
+func (rm *RouterManager) security() Security {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	if rm.ctx == nil {
+		return Security{}
+	}
+	rm.ctx.mu.RLock()
+	defer rm.ctx.mu.RUnlock()
+	return rm.ctx.Config.Server.Security
+}
+
+// ensures the route starts with / and has no double slashes. A trailing
+// slash is kept, "/about/" and "/about" are different routes.
 func normalizeRoute(route string) (string, error) {
 	if route == "" {
 		return "", errors.New("route cannot be empty")
 	}
 
 	// Clean the path
+	trailingSlash := strings.HasSuffix(route, "/")
 	route = filepath.Clean("/" + strings.TrimPrefix(route, "/"))
 
 	// filepath.Clean converts "/" to ".", so fix that
 	if route == "." {
 		route = "/"
 	}
+	if trailingSlash && route != "/" {
+		route += "/"
+	}
 
 	// Validate the route
 	if !strings.HasPrefix(route, "/") {
@@ -109,10 +283,61 @@ func (rm *RouterManager) InitializeRouter(ctx *Context) error {
 	rm.fm = ctx.FileManager
 	rm.ctx = ctx
 
-	// Create new router
+	if rm.router == nil {
+		rm.router = rm.newEngineUnsafe()
+	}
 	return rm.rebuildRouterUnsafe()
 }
 
+// creates the gin engine with the middleware and the monitoring endpoints
+func (rm *RouterManager) newEngineUnsafe() *gin.Engine {
+	engine := gin.New()
+
+	// Add default middleware
+	engine.Use(gin.Logger())
+	engine.Use(gin.Recovery())
+
+	// Add security middleware
+	engine.Use(SecurityHeadersMiddleware(rm.security))
+
+	// Add rate limiting middleware, as configured in site.yaml
+	var rateLimit RateLimit
+	if rm.ctx != nil {
+		rateLimit = rm.ctx.Config.Server.RateLimit
+	}
+	rm.rateLimiter = NewRateLimiter(rateLimit)
+	engine.Use(rm.rateLimiter.Middleware())
+
+	// Add custom middleware
+	for _, middleware := range rm.middleware {
+		engine.Use(middleware)
+	}
+
+	// Add metrics middleware
+	engine.Use(GlobalMetrics.MetricsMiddleware())
+
+	// Add monitoring endpoints
+	engine.GET("/metrics", GlobalMetrics.MetricsHandler())
+	engine.GET("/metrics/prometheus", GlobalMetrics.PrometheusHandler())
+	engine.GET("/health", GlobalHealthChecker.HealthHandler())
+	engine.GET("/health/live", GlobalHealthChecker.LivenessHandler())
+	engine.GET("/health/ready", GlobalHealthChecker.ReadinessHandler())
+
+	// Everything else is served from the route table
+	engine.NoRoute(rm.handleRoute)
+	return engine
+}
+
+// Stop releases the resources of the router, i.e. the rate limiter
+func (rm *RouterManager) Stop() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.rateLimiter != nil {
+		rm.rateLimiter.Stop()
+		rm.rateLimiter = nil
+	}
+}
+
 func (rm *RouterManager) AddRoute(pattern, filePath string) error {
 	normalizedPattern, err := normalizeRoute(pattern)
 	if err != nil {
@@ -123,14 +348,12 @@ func (rm *RouterManager) AddRoute(pattern, filePath string) error {
 	defer rm.mu.Unlock()
 
 	// Check if route already exists
-	if _, exists := rm.routes[normalizedPattern]; exists {
+	if _, exists := rm.table.winner(normalizedPattern); exists {
 		return fmt.Errorf("route %s already exists", normalizedPattern)
 	}
 
-	// Add route to router
-	rm.router.GET(normalizedPattern, rm.makeFileHandler(filePath))
-	rm.routes[normalizedPattern] = filePath
-
+	rm.table.claim(normalizedPattern, routeClaim{owner: filePath})
+	rm.updateRoutesUnsafe([]string{normalizedPattern})
 	return nil
 }
 
@@ -143,20 +366,61 @@ func (rm *RouterManager) AddFile(file *File) {
 
 // addFileUnsafe is the internal implementation that assumes the lock is already held
 func (rm *RouterManager) addFileUnsafe(file *File) {
-	for _, route := range file.Routes {
-		normalizedRoute, err := normalizeRoute(route)
-		if err != nil {
-			continue // Skip invalid routes
-		}
+	rm.updateRoutesUnsafe(rm.table.updateFile(file))
+}
 
-		// Skip duplicates
-		if _, exists := rm.routes[normalizedRoute]; exists {
-			continue
+// updates the handlers of routes whose winner changed in the route table
+func (rm *RouterManager) updateRoutesUnsafe(routes []string) {
+	served := rm.served.Load()
+	for _, route := range routes {
+		claim, exists := rm.table.winner(route)
+		if handler := rm.makeHandler(claim); exists && handler != nil {
+			served.Store(route, handler)
+		} else {
+			served.Delete(route)
 		}
+	}
+
+	// Update metrics
+	SetRoutesCount(int64(rm.table.count()))
+}
+
+// creates the handler for the winner of a route
+func (rm *RouterManager) makeHandler(claim routeClaim) gin.HandlerFunc {
+	switch {
+	case claim.owner == builtinRouteOwner:
+		return nil // registered with the engine
+	case claim.redirect != nil:
+		return rm.makeRedirectHandler(*claim.redirect)
+	case claim.output != "":
+		return rm.makeOutputHandler(claim.owner, claim.output)
+	default:
+		return rm.makeFileHandler(claim.owner)
+	}
+}
+
+// Registers a redirect. Fails if its route is already used by a file or
+// another redirect.
+func (rm *RouterManager) AddRedirect(redirect Redirect) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
 
-		rm.routes[normalizedRoute] = file.Path
-		rm.router.GET(normalizedRoute, rm.makeFileHandler(file.Path))
+	route, err := rm.table.addRedirect(redirect)
+	if err != nil {
+		return err
+	}
+	if route != "" {
+		rm.updateRoutesUnsafe([]string{route})
 	}
+	return nil
+}
+
+// GetConflicts returns the routes which are claimed by more than one file or
+// redirect, sorted by route (thread-safe)
+func (rm *RouterManager) GetConflicts() []RouteConflict {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.table.getConflicts()
 }
 
 func (rm *RouterManager) RemoveRoute(pattern string) error {
@@ -169,115 +433,73 @@ func (rm *RouterManager) RemoveRoute(pattern string) error {
 	defer rm.mu.Unlock()
 
 	// Check if route exists
-	if _, exists := rm.routes[normalizedPattern]; !exists {
+	if !rm.table.removeRoute(normalizedPattern) {
 		return fmt.Errorf("route %s not found", normalizedPattern)
 	}
 
-	// Remove from our routes map
-	delete(rm.routes, normalizedPattern)
-
-	// Note: Gin doesn't support removing routes dynamically.
-	// We need to rebuild the router to actually remove routes.
-	// For now, we'll just remove from our tracking map.
-	// The route will still exist in gin but won't be in our management system.
-
-	return rm.rebuildRouterUnsafe()
+	rm.updateRoutesUnsafe([]string{normalizedPattern})
+	return nil
 }
 
-// RemoveFile removes all routes associated with a file
+// RemoveFile removes all routes associated with a file. Routes which are
+// also claimed by another file are served by that file afterwards.
 func (rm *RouterManager) RemoveFile(filePath string) error {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
-	// Find all routes that map to this file
-	var routesToRemove []string
-	for pattern, fp := range rm.routes {
-		if fp == filePath {
-			routesToRemove = append(routesToRemove, pattern)
-		}
-	}
-
-	if len(routesToRemove) == 0 {
+	routes, exists := rm.table.removeOwner(filePath)
+	if !exists {
 		return fmt.Errorf("no routes found for file %s", filePath)
 	}
 
-	// Remove all found routes
-	for _, pattern := range routesToRemove {
-		delete(rm.routes, pattern)
-	}
+	rm.updateRoutesUnsafe(routes)
+	return nil
+}
 
-	return rm.rebuildRouterUnsafe()
+// UpdateFiles removes the routes of deleted files and updates the routes of
+// added or changed files in one step, so that requests never see a partial
+// update (thread-safe)
+func (rm *RouterManager) UpdateFiles(removed []string, added []*File) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	var routes []string
+	for _, filePath := range removed {
+		removedRoutes, _ := rm.table.removeOwner(filePath)
+		routes = append(routes, removedRoutes...)
+	}
+	for _, file := range added {
+		routes = append(routes, rm.table.updateFile(file)...)
+	}
+	rm.updateRoutesUnsafe(routes)
 }
 
 // GetAllRoutes returns a copy of all current routes (thread-safe)
 func (rm *RouterManager) GetAllRoutes() map[string]string {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
-
-	// Return a copy to prevent external modifications
-	routes := make(map[string]string, len(rm.routes))
-	for pattern, filePath := range rm.routes {
-		routes[pattern] = filePath
-	}
-	return routes
+	return rm.table.routes()
 }
 
-// rebuildRouterUnsafe recreates the router with current routes
+// rebuildRouterUnsafe rebuilds the route table from the FileManager, and
+// replaces the served routes at once.
 // This method assumes the caller already holds the write lock
 func (rm *RouterManager) rebuildRouterUnsafe() error {
-	// Clear existing routes map
-	rm.routes = make(map[string]string)
-
-	// Initialize fresh router
-	newRouter := gin.New()
-
-	// Add default middleware
-	newRouter.Use(gin.Logger())
-	newRouter.Use(gin.Recovery())
-
-	// Add security middleware
-	newRouter.Use(SecurityHeadersMiddleware())
-
-	// Add rate limiting middleware (60 requests per minute)
-	rateLimiter := NewRateLimiter(60)
-	newRouter.Use(rateLimiter.Middleware())
-
-	// Add custom middleware
-	for _, middleware := range rm.middleware {
-		newRouter.Use(middleware)
-	}
-
-	// Add metrics middleware
-	newRouter.Use(GlobalMetrics.MetricsMiddleware())
+	table := buildRouteTable(rm.ctx)
 
-	// Set the router immediately so addFileUnsafe can use it
-	rm.router = newRouter
-
-	// Set up routes for files in content directory
-	for _, file := range rm.ctx.FileManager.GetAllFiles() {
-		if !strings.HasPrefix(file.Path, "content/") {
-			continue
+	served := new(sync.Map)
+	for route := range table.claims {
+		claim, _ := table.winner(route)
+		if handler := rm.makeHandler(claim); handler != nil {
+			served.Store(route, handler)
 		}
-
-		// Call addFileUnsafe since we already hold the lock
-		rm.addFileUnsafe(file)
 	}
 
-	// Add static file serving for assets
-	if rm.ctx != nil {
-		staticDir := filepath.Join(rm.ctx.Config.SiteDirectory, "assets")
-		rm.router.Static("/assets", staticDir)
-	}
-
-	// Add monitoring endpoints
-	rm.router.GET("/metrics", GlobalMetrics.MetricsHandler())
-	rm.router.GET("/metrics/prometheus", GlobalMetrics.PrometheusHandler())
-	rm.router.GET("/health", GlobalHealthChecker.HealthHandler())
-	rm.router.GET("/health/live", GlobalHealthChecker.LivenessHandler())
-	rm.router.GET("/health/ready", GlobalHealthChecker.ReadinessHandler())
+	rm.table = table
+	rm.served.Store(served)
 
 	// Update metrics
-	SetRoutesCount(int64(len(rm.routes)))
+	SetRoutesCount(int64(rm.table.count()))
 
 	return nil
 }
@@ -298,14 +520,14 @@ func (rm *RouterManager) GetRouteInfo(pattern string) (*RouteInfo, error) {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
-	filePath, exists := rm.routes[normalizedPattern]
-	if !exists {
+	claim, exists := rm.table.winner(normalizedPattern)
+	if !exists || claim.owner == builtinRouteOwner {
 		return nil, fmt.Errorf("route %s not found", normalizedPattern)
 	}
 
 	return &RouteInfo{
 		Pattern:  normalizedPattern,
-		FilePath: filePath,
+		FilePath: claim.owner,
 		Method:   "GET",
 	}, nil
 }
@@ -317,6 +539,14 @@ func (rm *RouterManager) GetRouter() *gin.Engine {
 	return rm.router
 }
 
+// ServeHTTP implements http.Handler
+func (rm *RouterManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Streamed files extend the write deadline of the connection, which
+	// cannot be reached through gin's ResponseWriter (see serveFile)
+	r = r.WithContext(context.WithValue(r.Context(), responseControllerKey{}, http.NewResponseController(w)))
+	rm.GetRouter().ServeHTTP(w, r)
+}
+
 // RouteExists checks if a route pattern exists (thread-safe)
 func (rm *RouterManager) RouteExists(pattern string) bool {
 	normalizedPattern, err := normalizeRoute(pattern)
@@ -324,9 +554,7 @@ func (rm *RouterManager) RouteExists(pattern string) bool {
 		return false
 	}
 
-	rm.mu.RLock()
-	defer rm.mu.RUnlock()
-	_, exists := rm.routes[normalizedPattern]
+	_, exists := rm.lookup(normalizedPattern)
 	return exists
 }
 
@@ -334,5 +562,5 @@ func (rm *RouterManager) RouteExists(pattern string) bool {
 func (rm *RouterManager) GetRouteCount() int {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
-	return len(rm.routes)
+	return rm.table.count()
 }
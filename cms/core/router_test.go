@@ -1,11 +1,14 @@
 package core
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -143,6 +146,181 @@ func TestRedirectHandling(t *testing.T) {
 	assert.Equal(t, "/new-page", w.Header().Get("Location"))
 }
 
+func TestRedirectRules(t *testing.T) {
+	ctx := createTestContext(t)
+
+	page := &File{
+		Path:    "content/team.html",
+		Content: []byte("<h1>Team</h1>"),
+		Routes:  []string{"/team.html", "/team"},
+		Metadata: FileMetadata{
+			MimeType: "text/html",
+			Aliases:  []string{"/people", "/about"},
+		},
+	}
+	ctx.context.FileManager.Files[page.Path] = page
+	ctx.context.Redirects = []Redirect{
+		{From: "/blog/*", To: "/posts/:splat", Status: http.StatusTemporaryRedirect},
+		{From: "/home", To: "/elsewhere"},
+	}
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	get := func(route string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", route, nil)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w
+	}
+
+	// Aliases redirect permanently to the page
+	w := get("/people")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/team", w.Header().Get("Location"))
+
+	// Files take precedence over redirects
+	w = get("/about")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = get("/home")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Wildcards apply to routes which do not exist
+	w = get("/blog/2025/post")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/posts/2025/post", w.Header().Get("Location"))
+	w = get("/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Conflicts are reported
+	err = rm.AddRedirect(Redirect{From: "/people", To: "/somewhere", Source: "test"})
+	assert.ErrorIs(t, err, ErrRouteConflict)
+	err = rm.AddRedirect(Redirect{From: "/blog/*", To: "/", Source: "test"})
+	assert.ErrorIs(t, err, ErrRouteConflict)
+	err = rm.AddRedirect(Redirect{From: "/health", To: "/", Source: "test"})
+	assert.ErrorIs(t, err, ErrRouteConflict)
+	err = rm.AddRedirect(Redirect{From: "/new-alias", To: "/team", Source: "test"})
+	assert.NoError(t, err)
+}
+
+func TestRedirectPrecedence(t *testing.T) {
+	ctx := createTestContext(t)
+
+	page := &File{
+		Path:    "content/team.html",
+		Content: []byte("<h1>Team</h1>"),
+		Routes:  []string{"/team.html", "/team"},
+		Metadata: FileMetadata{
+			MimeType: "text/html",
+			Aliases:  []string{"/people", "/staff/*"},
+		},
+	}
+	ctx.context.FileManager.Files[page.Path] = page
+	ctx.context.Redirects = []Redirect{
+		{From: "/people", To: "/crew", Source: redirectsConfigSource},
+		{From: "/staff/*", To: "/crew", Source: redirectsConfigSource},
+	}
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	location := func(route string) string {
+		req, _ := http.NewRequest("GET", route, nil)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w.Header().Get("Location")
+	}
+
+	// config/redirects.yaml takes precedence over the aliases of pages, no
+	// matter if the page is added before or after the redirects
+	assert.Equal(t, "/crew", location("/people"))
+	assert.Equal(t, "/crew", location("/staff/anna"))
+	rm.AddFile(page)
+	assert.Equal(t, "/crew", location("/people"))
+	assert.Equal(t, "/crew", location("/staff/anna"))
+	assert.Contains(t, rm.GetConflicts(), RouteConflict{Route: "/people", Winner: redirectsConfigSource, Shadowed: page.Path})
+
+	// Aliases of different pages are ordered by the path of the page
+	other := &File{
+		Path:     "content/about.html",
+		Content:  []byte("<h1>About</h1>"),
+		Routes:   []string{"/about.html", "/about"},
+		Metadata: FileMetadata{MimeType: "text/html", Aliases: []string{"/team-old"}},
+	}
+	page.Metadata.Aliases = []string{"/team-old"}
+	rm.AddFile(page)
+	rm.AddFile(other)
+	assert.Equal(t, "/about", location("/team-old"))
+}
+
+func TestRouteConflicts(t *testing.T) {
+	ctx := createTestContext(t)
+	fm := ctx.context.FileManager
+
+	page := func(path, body string, routes ...string) *File {
+		file := &File{
+			Path:     path,
+			Content:  []byte(body),
+			Routes:   routes,
+			Metadata: FileMetadata{MimeType: "text/html"},
+		}
+		fm.Files[path] = file
+		return file
+	}
+	page("content/blog/post.md", "markdown", "/blog/post.md", "/blog/post")
+	page("content/blog/post.html", "html", "/blog/post.html", "/blog/post")
+	page("content/blog/index.html", "index", "/blog/index.html", "/blog/index", "/blog")
+	page("content/blog.html", "blog", "/blog.html", "/blog")
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	get := func(route string) string {
+		req, _ := http.NewRequest("GET", route, nil)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// Ties are resolved by the file path, routes named after a file win
+	// over derived routes
+	assert.Equal(t, "html", get("/blog/post"))
+	assert.Equal(t, "markdown", get("/blog/post.md"))
+	assert.Equal(t, "blog", get("/blog"))
+	assert.Equal(t, []RouteConflict{
+		{Route: "/blog", Winner: "content/blog.html", Shadowed: "content/blog/index.html"},
+		{Route: "/blog/post", Winner: "content/blog/post.html", Shadowed: "content/blog/post.md"},
+	}, rm.GetConflicts())
+
+	// The order in which files are added does not matter
+	rm.AddFile(page("content/blog/post.htm", "htm", "/blog/post.htm", "/blog/post"))
+	assert.Equal(t, "htm", get("/blog/post"))
+	assert.Len(t, rm.GetConflicts(), 3)
+
+	// A route named after a file cannot be taken over
+	rm.AddFile(page("content/other.html", "other", "/blog/post.md"))
+	assert.Equal(t, "markdown", get("/blog/post.md"))
+
+	// Monitoring endpoints and redirects
+	rm.AddFile(page("content/health.html", "health", "/health.html", "/health"))
+	assert.NotEqual(t, "health", get("/health"))
+	assert.Contains(t, rm.GetConflicts(), RouteConflict{Route: "/health", Winner: builtinRouteOwner, Shadowed: "content/health.html"})
+
+	// Conflicts are found without a router as well
+	assert.Equal(t, rm.GetConflicts(), FindRouteConflicts(ctx.context))
+
+	err = rm.AddRedirect(Redirect{From: "/blog", To: "/posts", Source: "test"})
+	var routerError *RouterError
+	require.ErrorAs(t, err, &routerError)
+	assert.Equal(t, "/blog", routerError.Route)
+	assert.ErrorIs(t, err, ErrRouteConflict)
+
+	// Conflicts are reported by the health check
+	err = RouterHealthCheck(rm)(context.Background())
+	assert.ErrorIs(t, err, ErrDegraded)
+	assert.Contains(t, err.Error(), "content/blog/post.md is shadowed by content/blog/post.htm")
+}
+
 func TestRouterManager(t *testing.T) {
 	ctx := createTestContext(t)
 
@@ -183,6 +361,208 @@ func TestRouterManager(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestOutputFiles(t *testing.T) {
+	ctx := createTestContext(t)
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+	require.NotNil(t, rm)
+
+	testFile := &File{
+		Path:    "content/gallery.md",
+		Content: []byte("<h1>Gallery</h1>"),
+		Routes:  []string{"/gallery"},
+		Metadata: FileMetadata{
+			MimeType: "text/html",
+		},
+		OutputFiles: map[string][]byte{
+			"/photo-480w.jpg":  []byte("jpeg"),
+			"/photo-480w.webp": []byte("webp"),
+		},
+	}
+
+	ctx.context.FileManager.Files[testFile.Path] = testFile
+	rm.AddFile(testFile)
+
+	assert.True(t, rm.RouteExists("/photo-480w.jpg"))
+	assert.True(t, rm.RouteExists("/photo-480w.webp"))
+
+	req, _ := http.NewRequest("GET", "/photo-480w.webp", nil)
+	w := httptest.NewRecorder()
+	rm.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/webp", w.Header().Get("Content-Type"))
+	assert.Equal(t, "webp", w.Body.String())
+
+	// An output file which is no longer generated is not found
+	testFile.OutputFiles = nil
+	req, _ = http.NewRequest("GET", "/photo-480w.jpg", nil)
+	w = httptest.NewRecorder()
+	rm.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Removing the file removes the routes of its output files
+	delete(ctx.context.FileManager.Files, testFile.Path)
+	err = rm.RemoveFile(testFile.Path)
+	assert.NoError(t, err)
+	assert.False(t, rm.RouteExists("/photo-480w.webp"))
+}
+
+func TestAssetRoutes(t *testing.T) {
+	ctx := createTestContext(t)
+
+	asset := &File{
+		Path:    "assets/test.css",
+		Content: []byte("body{color:red}"),
+		Routes:  []string{"/assets/test.css"},
+		Metadata: FileMetadata{
+			MimeType: "text/css; charset=utf-8",
+		},
+		OutputFiles: map[string][]byte{
+			"/assets/test.0123456789abcdef.css": []byte("body{color:red}"),
+		},
+	}
+	ctx.context.FileManager.Files[asset.Path] = asset
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	// Assets are served from the FileManager
+	for _, route := range []string{"/assets/test.css", "/assets/test.0123456789abcdef.css"} {
+		req, _ := http.NewRequest("GET", route, nil)
+		w := httptest.NewRecorder()
+		rm.GetRouter().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, route)
+		assert.Equal(t, "body{color:red}", w.Body.String(), route)
+	}
+
+	// Files on disk which were not processed are not served
+	req, _ := http.NewRequest("GET", "/assets/missing.css", nil)
+	w := httptest.NewRecorder()
+	rm.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConditionalRequests(t *testing.T) {
+	ctx := createTestContext(t)
+
+	modTime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	page := &File{
+		Path:        "content/about.html",
+		Content:     []byte("<h1>About</h1>"),
+		Routes:      []string{"/about"},
+		ContentHash: ContentHash([]byte("<h1>About</h1>")),
+		ModTime:     modTime,
+		Metadata: FileMetadata{
+			MimeType: "text/html",
+		},
+	}
+	asset := &File{
+		Path:    "assets/test.css",
+		Content: []byte("body{color:red}"),
+		Routes:  []string{"/assets/test.css"},
+		ModTime: modTime,
+		OutputFiles: map[string][]byte{
+			"/assets/test.0123456789abcdef.css": []byte("body{color:red}"),
+		},
+		OutputHashes: map[string]string{
+			"/assets/test.0123456789abcdef.css": ContentHash([]byte("body{color:red}")),
+		},
+	}
+	ctx.context.FileManager.Files[page.Path] = page
+	ctx.context.FileManager.Files[asset.Path] = asset
+	ctx.context.Config.Caching.Content = "no-store"
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	get := func(route string, header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", route, nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/about", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"`+page.ContentHash+`"`, w.Header().Get("ETag"))
+	assert.Equal(t, modTime.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "text/html", w.Header().Get("Content-Type"))
+
+	// The client's copy is still valid
+	w = get("/about", map[string]string{"If-None-Match": `"` + page.ContentHash + `"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = get("/about", map[string]string{"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// ... or outdated
+	w = get("/about", map[string]string{"If-None-Match": `"0000000000000000"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>About</h1>", w.Body.String())
+
+	w = get("/about", map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Assets are cached, fingerprinted assets forever
+	w = get("/assets/test.css", nil)
+	assert.Equal(t, DefaultAssetsCacheControl, w.Header().Get("Cache-Control"))
+
+	w = get("/assets/test.0123456789abcdef.css", nil)
+	assert.Equal(t, DefaultImmutableCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal(t, `"`+ContentHash([]byte("body{color:red}"))+`"`, w.Header().Get("ETag"))
+}
+
+func TestCompressedResponses(t *testing.T) {
+	ctx := createTestContext(t)
+
+	content := []byte(strings.Repeat("<p>Lorem ipsum dolor sit amet</p>\n", 50))
+	page := &File{
+		Path:        "content/lorem.html",
+		Content:     content,
+		Routes:      []string{"/lorem"},
+		ContentHash: ContentHash(content),
+		Compressed:  Compress(content, "text/html"),
+		Metadata: FileMetadata{
+			MimeType: "text/html",
+		},
+	}
+	ctx.context.FileManager.Files[page.Path] = page
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/lorem", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("gzip, deflate, br")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, `"`+page.ContentHash+`-br"`, w.Header().Get("ETag"))
+	assert.Equal(t, page.Compressed[EncodingBrotli], w.Body.Bytes())
+
+	w = get("gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, page.Compressed[EncodingGzip], w.Body.Bytes())
+
+	// Clients without compression get the original content
+	w = get("")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, content, w.Body.Bytes())
+}
+
 func TestRouteUpdates(t *testing.T) {
 	ctx := createTestContext(t)
 
@@ -222,6 +602,148 @@ func TestRouteUpdates(t *testing.T) {
 	assert.Equal(t, "<h1>Updated</h1>", w.Body.String())
 }
 
+func TestIncrementalRouteUpdates(t *testing.T) {
+	ctx := createTestContext(t)
+	fm := ctx.context.FileManager
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	// The engine is created once, the server can keep a reference to it
+	engine := rm.GetRouter()
+	request := func(method, route string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, route, nil)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	html := &File{
+		Path:     "content/news.html",
+		Content:  []byte("html"),
+		Routes:   []string{"/news.html", "/news"},
+		Metadata: FileMetadata{MimeType: "text/html"},
+	}
+	markdown := &File{
+		Path:     "content/news.md",
+		Content:  []byte("markdown"),
+		Routes:   []string{"/news.md", "/news"},
+		Metadata: FileMetadata{MimeType: "text/html"},
+	}
+	fm.Files[html.Path] = html
+	fm.Files[markdown.Path] = markdown
+	rm.AddFile(markdown)
+	rm.AddFile(html)
+	assert.Equal(t, "html", request("GET", "/news").Body.String())
+
+	// Shadowed files take over when the winner is removed
+	require.NoError(t, rm.RemoveFile(html.Path))
+	assert.Equal(t, "markdown", request("GET", "/news").Body.String())
+	assert.False(t, rm.RouteExists("/news.html"))
+	assert.Empty(t, rm.GetConflicts())
+
+	// Routes which a modified file no longer uses are removed
+	markdown.Routes = []string{"/news.md"}
+	rm.AddFile(markdown)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/news").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/news.md").Code)
+
+	// Rebuilding replaces the routes, but not the engine
+	delete(fm.Files, html.Path)
+	require.NoError(t, rm.RebuildRouter())
+	assert.Same(t, engine, rm.GetRouter())
+	assert.Equal(t, http.StatusOK, request("GET", "/about").Code)
+
+	// Trailing slashes are redirected, other methods are not served
+	w := request("GET", "/about/")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/about", w.Header().Get("Location"))
+	assert.Equal(t, http.StatusOK, request("HEAD", "/about").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/about").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/health/live").Code)
+}
+
+func TestCanonicalRedirects(t *testing.T) {
+	ctx := createTestContext(t)
+	ctx.context.Config.Urls = UrlPolicy{TrailingSlash: true, Lowercase: true}
+	ctx.context.FileManager.Files["content/docs/intro.md"] = &File{
+		Path:     "content/docs/intro.md",
+		Content:  []byte("intro"),
+		Routes:   []string{"/docs/intro/"},
+		Metadata: FileMetadata{MimeType: "text/html"},
+	}
+	ctx.context.FileManager.Files["content/notes/a.md"] = &File{
+		Path:     "content/notes/a.md",
+		Content:  []byte("a"),
+		Routes:   []string{"/notes/a"}, // e.g. from "url" in the frontmatter
+		Metadata: FileMetadata{MimeType: "text/html"},
+	}
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	tests := []struct {
+		route    string
+		status   int
+		location string
+	}{
+		{"/docs/intro/", http.StatusOK, ""},
+		{"/docs/intro", http.StatusMovedPermanently, "/docs/intro/"},
+		{"/docs/intro.md", http.StatusMovedPermanently, "/docs/intro/"},
+		{"/Docs/Intro.html?page=2", http.StatusMovedPermanently, "/docs/intro/?page=2"},
+		{"/docs/other", http.StatusNotFound, ""},
+		{"/notes/a", http.StatusOK, ""},
+		{"/notes/a/", http.StatusMovedPermanently, "/notes/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.route, nil)
+			w := httptest.NewRecorder()
+			rm.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestConcurrentRouteUpdates(t *testing.T) {
+	ctx := createTestContext(t)
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			file := &File{
+				Path:     "content/page.html",
+				Content:  []byte("page"),
+				Routes:   []string{"/page"},
+				Metadata: FileMetadata{MimeType: "text/html"},
+			}
+			rm.AddFile(file)
+			_ = rm.RemoveFile(file.Path)
+			if i%50 == 0 {
+				_ = rm.RebuildRouter()
+			}
+		}
+	}()
+
+	// Stay below the rate limit
+	for i := 0; i < 50; i++ {
+		req, _ := http.NewRequest("GET", "/about", nil)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	<-done
+}
+
 func TestInvalidRoutes(t *testing.T) {
 	ctx := createTestContext(t)
 
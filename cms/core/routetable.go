@@ -0,0 +1,391 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A route can be claimed by more than one file, e.g. "/blog/post" by
+// "content/blog/post.html" and "content/blog/post.md", or by a file and a
+// redirect. Exactly one claim wins, independent of the order in which the
+// files are added:
+//
+//  1. the monitoring endpoints (/metrics, /health)
+//  2. files, by the position of the route in File.Routes. The first route is
+//     named after the file; later routes are derived from it, i.e. the route
+//     without extension and the directory of an index page
+//  3. the file whose path sorts first
+//  4. redirects from config/redirects.yaml
+//  5. redirects declared by pages (aliases), by the path of the page
+//
+// All other claims are reported as conflicts. They are kept, so that the
+// next claim takes over when the winner is removed.
+
+// Routes of the monitoring endpoints, which cannot be used by files or redirects
+var monitoringRoutes = []string{"/metrics", "/metrics/prometheus", "/health", "/health/live", "/health/ready"}
+
+// Owner of the monitoring endpoints
+const builtinRouteOwner = "(builtin)"
+
+// Redirects rank after all routes of files
+const redirectRank = 1 << 30
+
+// RouteConflict is a route which is claimed by more than one file or redirect
+type RouteConflict struct {
+	Route    string `json:"route"`
+	Winner   string `json:"winner"`   // File (or source of the redirect) which serves the route
+	Shadowed string `json:"shadowed"` // File (or source of the redirect) which is ignored
+}
+
+// Returns the conflict as a RouterError
+func (c RouteConflict) Err() error {
+	return NewRouterError("add", c.Route,
+		fmt.Errorf("%w: %s is shadowed by %s", ErrRouteConflict, c.Shadowed, c.Winner))
+}
+
+// A claim of a file or a redirect on a route
+type routeClaim struct {
+	owner    string    // Path of the file, or the source of the redirect
+	rank     int       // Position of the route in File.Routes
+	output   string    // Route of a generated file, see File.OutputFiles
+	redirect *Redirect // Set for redirects
+}
+
+// Returns true if the claim takes precedence over another one
+func (c routeClaim) beats(other routeClaim) bool {
+	if c.rank != other.rank {
+		return c.rank < other.rank
+	}
+	if c.redirect != nil && other.redirect != nil {
+		return c.redirect.precedes(*other.redirect)
+	}
+	return c.owner < other.owner
+}
+
+// Returns true if both claims are the same, e.g. when a modified file is
+// added again
+func (c routeClaim) repeats(other routeClaim) bool {
+	if c.owner != other.owner || (c.redirect == nil) != (other.redirect == nil) {
+		return false
+	}
+	return c.redirect == nil || *c.redirect == *other.redirect
+}
+
+// routeTable assigns each route to a single file or redirect. It is not
+// thread-safe; the RouterManager holds its lock while the table is modified.
+type routeTable struct {
+	claims    map[string][]routeClaim    // Sorted by precedence, the first claim wins
+	owners    map[string]map[string]bool // Routes claimed by each file (or source of redirects)
+	wildcards []Redirect                 // Redirects for all routes below a path, e.g. "/blog/*"
+}
+
+func newRouteTable() *routeTable {
+	table := &routeTable{
+		claims: make(map[string][]routeClaim),
+		owners: make(map[string]map[string]bool),
+	}
+	for _, route := range monitoringRoutes {
+		table.claims[route] = []routeClaim{{owner: builtinRouteOwner, rank: -1}}
+	}
+	return table
+}
+
+// Builds the route table of a site from the files in the content and assets
+// directories and the redirects
+func buildRouteTable(ctx *Context) *routeTable {
+	var files []*File
+	for _, file := range ctx.FileManager.GetAllFiles() {
+		if !strings.HasPrefix(file.Path, "content/") && !strings.HasPrefix(file.Path, "assets/") {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	table := newRouteTable()
+	for _, file := range files {
+		table.updateFile(file)
+	}
+	for _, redirect := range ctx.Redirects {
+		if _, err := table.addRedirect(redirect); err != nil && !errors.Is(err, ErrRouteConflict) {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return table
+}
+
+// Returns the conflicting routes of a site
+func FindRouteConflicts(ctx *Context) []RouteConflict {
+	return buildRouteTable(ctx).getConflicts()
+}
+
+// Returns the claim which serves a route
+func (t *routeTable) winner(route string) (routeClaim, bool) {
+	claims := t.claims[route]
+	if len(claims) == 0 {
+		return routeClaim{}, false
+	}
+	return claims[0], true
+}
+
+// Claims a route. Returns true if the claim serves the route.
+func (t *routeTable) claim(route string, claim routeClaim) bool {
+	claims := t.claims[route]
+	var previous routeClaim
+	if len(claims) > 0 {
+		previous = claims[0]
+	}
+
+	if i := slices.IndexFunc(claims, claim.repeats); i >= 0 {
+		// A file without extension claims the same route twice; the first
+		// (and better) claim is kept
+		if claim.rank > claims[i].rank {
+			return i == 0
+		}
+		claims[i] = claim
+	} else {
+		claims = append(claims, claim)
+		if t.owners[claim.owner] == nil {
+			t.owners[claim.owner] = make(map[string]bool)
+		}
+		t.owners[claim.owner][route] = true
+
+		if len(claims) > 1 {
+			conflict := RouteConflict{Route: route, Winner: previous.owner, Shadowed: claim.owner}
+			if claim.beats(previous) {
+				conflict.Winner, conflict.Shadowed = claim.owner, previous.owner
+			}
+			log.Printf("Warning: %v", conflict.Err())
+		}
+	}
+
+	sort.SliceStable(claims, func(i, j int) bool {
+		return claims[i].beats(claims[j])
+	})
+	t.claims[route] = claims
+	return claims[0].repeats(claim)
+}
+
+// Removes the claim of an owner on a route. Returns true if the claim served
+// the route.
+func (t *routeTable) unclaim(route, owner string) bool {
+	claims := t.claims[route]
+	if len(claims) == 0 {
+		return false
+	}
+	served := claims[0].owner == owner
+
+	remaining := make([]routeClaim, 0, len(claims))
+	for _, claim := range claims {
+		if claim.owner != owner {
+			remaining = append(remaining, claim)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(t.claims, route)
+	} else {
+		t.claims[route] = remaining
+	}
+
+	delete(t.owners[owner], route)
+	if len(t.owners[owner]) == 0 {
+		delete(t.owners, owner)
+	}
+	return served
+}
+
+// Claims the routes of a file, of the files generated from it, and of its
+// aliases. Claims which the file no longer makes (e.g. after it was
+// modified) are removed. Returns the routes which are now served differently.
+func (t *routeTable) updateFile(file *File) []string {
+	var changed []string
+	claimed := make(map[string]bool)
+	add := func(route string, claim routeClaim) {
+		normalizedRoute, err := normalizeRoute(route)
+		if err != nil {
+			return // Skip invalid routes
+		}
+		claimed[normalizedRoute] = true
+		if t.claim(normalizedRoute, claim) {
+			changed = append(changed, normalizedRoute)
+		}
+	}
+
+	for rank, route := range file.Routes {
+		add(route, routeClaim{owner: file.Path, rank: rank})
+	}
+
+	// Files generated by plugins are served from their owning file
+	outputRoutes := make([]string, 0, len(file.OutputFiles))
+	for route := range file.OutputFiles {
+		outputRoutes = append(outputRoutes, route)
+	}
+	sort.Strings(outputRoutes)
+	for _, route := range outputRoutes {
+		add(route, routeClaim{owner: file.Path, output: route})
+	}
+
+	// Aliases; routes of the file itself which redirect (because of
+	// "redirect-url") are served by the file's handler
+	t.removeWildcards(file.Path)
+	for _, redirect := range FileRedirects(file) {
+		if slices.Contains(file.Routes, redirect.From) {
+			continue
+		}
+		if err := redirect.Validate(); err != nil {
+			log.Printf("Warning: %v (declared in %s)", err, redirect.Source)
+			continue
+		}
+		if redirect.IsWildcard() {
+			t.addWildcard(redirect)
+			continue
+		}
+		add(redirect.From, routeClaim{owner: file.Path, rank: redirectRank, redirect: &redirect})
+	}
+
+	for route := range t.owners[file.Path] {
+		if !claimed[route] && t.unclaim(route, file.Path) {
+			changed = append(changed, route)
+		}
+	}
+	return changed
+}
+
+// Removes all claims of a file (or a source of redirects). Returns the routes
+// which are now served differently, and false if there were no claims.
+func (t *routeTable) removeOwner(owner string) ([]string, bool) {
+	routes, exists := t.owners[owner]
+	var changed []string
+	for route := range routes {
+		if t.unclaim(route, owner) {
+			changed = append(changed, route)
+		}
+	}
+	removed := t.removeWildcards(owner)
+	return changed, exists || removed
+}
+
+// Removes all claims on a route. Returns false if the route did not exist.
+func (t *routeTable) removeRoute(route string) bool {
+	claims, exists := t.claims[route]
+	for _, claim := range claims {
+		t.unclaim(route, claim.owner)
+	}
+	return exists
+}
+
+// Claims the route of a redirect. Returns the route if the redirect serves
+// it, or an empty string for wildcards, which only apply to routes that do
+// not exist.
+func (t *routeTable) addRedirect(redirect Redirect) (string, error) {
+	if err := redirect.Validate(); err != nil {
+		return "", fmt.Errorf("%w (declared in %s)", err, redirect.Source)
+	}
+	if redirect.IsWildcard() {
+		return "", t.addWildcard(redirect)
+	}
+
+	route, err := normalizeRoute(redirect.From)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRedirect, err)
+	}
+	if !t.claim(route, routeClaim{owner: redirect.Source, rank: redirectRank, redirect: &redirect}) {
+		winner, _ := t.winner(route)
+		return "", RouteConflict{Route: route, Winner: winner.owner, Shadowed: redirect.Source}.Err()
+	}
+	return route, nil
+}
+
+// Adds a wildcard redirect. The wildcard redirects are sorted by the same
+// precedence as other redirects; if another wildcard redirect has the same
+// route, the one which comes first is used.
+func (t *routeTable) addWildcard(redirect Redirect) error {
+	if slices.Contains(t.wildcards, redirect) {
+		return nil
+	}
+
+	// The slice is replaced (and never modified), requests read it without
+	// holding the lock
+	wildcards := append(slices.Clone(t.wildcards), redirect)
+	sort.SliceStable(wildcards, func(i, j int) bool {
+		return wildcards[i].precedes(wildcards[j])
+	})
+	t.wildcards = wildcards
+
+	for _, other := range t.wildcards {
+		if other.From != redirect.From || other == redirect {
+			continue
+		}
+		if redirect.precedes(other) {
+			conflict := RouteConflict{Route: redirect.From, Winner: redirect.Source, Shadowed: other.Source}
+			log.Printf("Warning: %v", conflict.Err())
+			return nil
+		}
+		err := RouteConflict{Route: redirect.From, Winner: other.Source, Shadowed: redirect.Source}.Err()
+		log.Printf("Warning: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Removes the wildcard redirects of a source. Returns true if there were any.
+func (t *routeTable) removeWildcards(source string) bool {
+	remaining := make([]Redirect, 0, len(t.wildcards))
+	for _, redirect := range t.wildcards {
+		if redirect.Source != source {
+			remaining = append(remaining, redirect)
+		}
+	}
+	if len(remaining) == len(t.wildcards) {
+		return false
+	}
+	t.wildcards = remaining
+	return true
+}
+
+// Returns the routes which are served by files or redirects, and their owners
+func (t *routeTable) routes() map[string]string {
+	routes := make(map[string]string, len(t.claims))
+	for route, claims := range t.claims {
+		if claims[0].owner != builtinRouteOwner {
+			routes[route] = claims[0].owner
+		}
+	}
+	return routes
+}
+
+// Returns the number of routes which are served by files or redirects
+func (t *routeTable) count() int {
+	return len(t.claims) - len(monitoringRoutes) // the monitoring endpoints are never removed
+}
+
+// Returns the conflicts, sorted by route
+func (t *routeTable) getConflicts() []RouteConflict {
+	var conflicts []RouteConflict
+	for route, claims := range t.claims {
+		for _, claim := range claims[1:] {
+			conflicts = append(conflicts, RouteConflict{Route: route, Winner: claims[0].owner, Shadowed: claim.owner})
+		}
+	}
+	for i, redirect := range t.wildcards {
+		for _, other := range t.wildcards[:i] {
+			if other.From == redirect.From {
+				conflicts = append(conflicts, RouteConflict{Route: redirect.From, Winner: other.Source, Shadowed: redirect.Source})
+				break
+			}
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Route != conflicts[j].Route {
+			return conflicts[i].Route < conflicts[j].Route
+		}
+		return conflicts[i].Shadowed < conflicts[j].Shadowed
+	})
+	return conflicts
+}
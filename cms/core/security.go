@@ -0,0 +1,277 @@
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Directives of the Content-Security-Policy, unless site.yaml replaces them
+var defaultContentSecurityPolicy = map[string]string{
+	"default-src": "'self'",
+	"script-src":  "'self' 'unsafe-inline'",
+	"style-src":   "'self' 'unsafe-inline'",
+}
+
+var cspDirectiveName = regexp.MustCompile(`^[a-z][a-z-]*$`)
+
+// Security configures the security headers of all responses
+type Security struct {
+	// Directives which replace the default ones, e.g. "style-src": "'self'
+	// https://cdn.example.com". An empty value removes a directive.
+	ContentSecurityPolicy map[string]string `yaml:"content-security-policy"`
+
+	FrameOptions      string `yaml:"frame-options"`      // "DENY" if not specified, "SAMEORIGIN", or "off"
+	Hsts              string `yaml:"hsts"`               // Strict-Transport-Security, e.g. "max-age=31536000; includeSubDomains"
+	PermissionsPolicy string `yaml:"permissions-policy"` // e.g. "camera=(), microphone=()"
+	ReferrerPolicy    string `yaml:"referrer-policy"`    // "strict-origin-when-cross-origin" if not specified
+}
+
+func (s *Security) Validate() error {
+	if err := validateCspDirectives(s.ContentSecurityPolicy); err != nil {
+		return err
+	}
+
+	switch strings.ToUpper(s.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN", "OFF":
+	default:
+		return fmt.Errorf("invalid frame-options %q", s.FrameOptions)
+	}
+
+	for _, value := range []string{s.Hsts, s.PermissionsPolicy, s.ReferrerPolicy} {
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid header value %q", value)
+		}
+	}
+	return nil
+}
+
+// Validates directives of a Content-Security-Policy, from site.yaml or
+// the frontmatter of a page
+func validateCspDirectives(directives map[string]string) error {
+	for name, value := range directives {
+		if !cspDirectiveName.MatchString(name) {
+			return fmt.Errorf("invalid Content-Security-Policy directive %q", name)
+		}
+		if strings.ContainsAny(value, ";,\r\n\x00") {
+			return fmt.Errorf("invalid value of Content-Security-Policy directive %s: %q", name, value)
+		}
+	}
+	return nil
+}
+
+// Returns the Content-Security-Policy header: the default directives,
+// replaced by those from site.yaml, and then by those of a page
+func (s *Security) ContentSecurityPolicyHeader(page map[string]string) string {
+	directives := make(map[string]string)
+	for _, layer := range []map[string]string{defaultContentSecurityPolicy, s.ContentSecurityPolicy, page} {
+		for name, value := range layer {
+			directives[name] = value
+		}
+	}
+
+	names := make([]string, 0, len(directives))
+	for name, value := range directives {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	policy := make([]string, len(names))
+	for i, name := range names {
+		policy[i] = name + " " + directives[name]
+	}
+	return strings.Join(policy, "; ")
+}
+
+// Sets the security headers of a response
+func (s *Security) SetHeaders(header http.Header) {
+	// Prevent content sniffing
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	// Prevent page rendering in frames (clickjacking protection)
+	switch frameOptions := strings.ToUpper(s.FrameOptions); frameOptions {
+	case "":
+		header.Set("X-Frame-Options", "DENY")
+	case "OFF":
+	default:
+		header.Set("X-Frame-Options", frameOptions)
+	}
+
+	// Enable XSS protection
+	header.Set("X-XSS-Protection", "1; mode=block")
+
+	// Enforce HTTPS, which only makes sense if the site is served over HTTPS
+	if s.Hsts != "" {
+		header.Set("Strict-Transport-Security", s.Hsts)
+	}
+
+	// Prevent referrer leakage
+	if s.ReferrerPolicy != "" {
+		header.Set("Referrer-Policy", s.ReferrerPolicy)
+	} else {
+		header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	}
+
+	if s.PermissionsPolicy != "" {
+		header.Set("Permissions-Policy", s.PermissionsPolicy)
+	}
+
+	header.Set("Content-Security-Policy", s.ContentSecurityPolicyHeader(nil))
+}
+
+// Requests per minute and client, unless configured otherwise
+const DefaultRequestsPerMinute = 60
+
+// Classes of requests, which are limited separately
+const (
+	RateLimitPages   = "pages"
+	RateLimitAssets  = "assets"
+	RateLimitSearch  = "search"
+	RateLimitMetrics = "metrics"
+)
+
+// The classes in the order in which their paths are matched; pages are
+// everything else
+var RateLimitClasses = []string{RateLimitAssets, RateLimitSearch, RateLimitMetrics, RateLimitPages}
+
+// Paths of the classes, unless configured otherwise
+var defaultRateLimitPaths = map[string][]string{
+	RateLimitAssets:  {"/assets/*"},
+	RateLimitSearch:  {"/search", "/search/*"},
+	RateLimitMetrics: {"/metrics", "/metrics/*", "/health", "/health/*"},
+}
+
+// RateLimit configures the rate limiter
+type RateLimit struct {
+	RequestsPerMinute int                       `yaml:"requests-per-minute"` // DefaultRequestsPerMinute if not specified, -1 disables the rate limiter
+	Burst             int                       `yaml:"burst"`               // Requests which can be sent at once, requests-per-minute if not specified
+	Classes           map[string]RateLimitClass `yaml:"classes"`             // Limits of "pages", "assets", "search" and "metrics"
+	TrustedProxies    []string                  `yaml:"trusted-proxies"`     // IPs or CIDRs of proxies whose X-Forwarded-For header is used
+	Allowlist         []string                  `yaml:"allowlist"`           // IPs or CIDRs which are not limited
+	ExemptPaths       []string                  `yaml:"exempt-paths"`        // Paths which are not limited, e.g. "/health" or "/assets/*"
+}
+
+// RateLimitClass replaces the limits of the rate limiter for a class of
+// requests. Unspecified values are taken from the rate limiter.
+type RateLimitClass struct {
+	RequestsPerMinute int      `yaml:"requests-per-minute"` // -1 disables the rate limiter for the class
+	Burst             int      `yaml:"burst"`
+	Paths             []string `yaml:"paths"` // e.g. "/api/*"
+}
+
+func (r *RateLimit) Validate() error {
+	if r.RequestsPerMinute < -1 {
+		return fmt.Errorf("invalid requests-per-minute %d", r.RequestsPerMinute)
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("invalid burst %d", r.Burst)
+	}
+	for name, class := range r.Classes {
+		if !slices.Contains(RateLimitClasses, name) {
+			return fmt.Errorf("unknown class %q", name)
+		}
+		if class.RequestsPerMinute < -1 || class.Burst < 0 {
+			return fmt.Errorf("invalid limits of class %s", name)
+		}
+		if err := validatePaths(class.Paths); err != nil {
+			return fmt.Errorf("class %s: %w", name, err)
+		}
+	}
+	if _, err := parseNetworks(r.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted-proxies: %w", err)
+	}
+	if _, err := parseNetworks(r.Allowlist); err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+	return validatePaths(r.ExemptPaths)
+}
+
+// Returns the limits of a class
+func (r *RateLimit) class(name string) rateLimitClass {
+	config := r.Classes[name]
+	perMinute := cmp.Or(config.RequestsPerMinute, r.RequestsPerMinute, DefaultRequestsPerMinute)
+	burst := cmp.Or(config.Burst, r.Burst, perMinute)
+
+	paths := config.Paths
+	if paths == nil {
+		paths = defaultRateLimitPaths[name]
+	}
+	return rateLimitClass{
+		rate:      float64(perMinute) / 60,
+		burst:     burst,
+		paths:     paths,
+		unlimited: perMinute < 0,
+	}
+}
+
+// Returns true if requests to a path are not limited
+func (r *RateLimit) isExempt(requestPath string) bool {
+	return matchesPath(r.ExemptPaths, requestPath)
+}
+
+func validatePaths(paths []string) error {
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path %q must start with '/'", p)
+		}
+	}
+	return nil
+}
+
+// Returns true if one of the paths matches a request path. Paths which end
+// with "*" match all paths with the same prefix.
+func matchesPath(paths []string, requestPath string) bool {
+	for _, p := range paths {
+		if prefix, wildcard := strings.CutSuffix(p, "*"); wildcard {
+			if strings.HasPrefix(requestPath, prefix) {
+				return true
+			}
+		} else if requestPath == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a list of IPs and CIDRs, e.g. "10.0.0.1" and "10.0.0.0/8"
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Returns true if one of the networks contains the IP
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentSecurityPolicyHeader(t *testing.T) {
+	var defaults Security
+	assert.Equal(t, "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'",
+		defaults.ContentSecurityPolicyHeader(nil))
+
+	site := Security{ContentSecurityPolicy: map[string]string{
+		"style-src":  "'self' https://cdn.example.com",
+		"script-src": "",
+		"img-src":    "'self' data:",
+	}}
+	assert.Equal(t, "default-src 'self'; img-src 'self' data:; style-src 'self' https://cdn.example.com",
+		site.ContentSecurityPolicyHeader(nil))
+
+	page := map[string]string{"frame-src": "https://www.youtube.com", "img-src": "*"}
+	assert.Equal(t, "default-src 'self'; frame-src https://www.youtube.com; img-src *; style-src 'self' https://cdn.example.com",
+		site.ContentSecurityPolicyHeader(page))
+}
+
+func TestSecurityValidate(t *testing.T) {
+	valid := Security{
+		ContentSecurityPolicy: map[string]string{"style-src": "'self' https://cdn.example.com"},
+		FrameOptions:          "sameorigin",
+		Hsts:                  "max-age=31536000",
+	}
+	assert.NoError(t, valid.Validate())
+
+	for _, security := range []Security{
+		{ContentSecurityPolicy: map[string]string{"style-src": "'self'; script-src *"}},
+		{ContentSecurityPolicy: map[string]string{"Style Src": "'self'"}},
+		{FrameOptions: "ALLOW-FROM https://example.com"},
+		{Hsts: "max-age=1\r\nX-Injected: 1"},
+	} {
+		assert.Error(t, security.Validate(), "%+v", security)
+	}
+
+	for _, rateLimit := range []RateLimit{
+		{RequestsPerMinute: -2},
+		{Burst: -1},
+		{TrustedProxies: []string{"10.0.0.0/33"}},
+		{Allowlist: []string{"localhost"}},
+		{ExemptPaths: []string{"health"}},
+	} {
+		assert.Error(t, rateLimit.Validate(), "%+v", rateLimit)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	security := Security{FrameOptions: "off", Hsts: "max-age=31536000", PermissionsPolicy: "camera=()"}
+	header := http.Header{}
+	security.SetHeaders(header)
+
+	assert.Empty(t, header.Get("X-Frame-Options"))
+	assert.Equal(t, "max-age=31536000", header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "camera=()", header.Get("Permissions-Policy"))
+	assert.Equal(t, "strict-origin-when-cross-origin", header.Get("Referrer-Policy"))
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+}
+
+func TestPageContentSecurityPolicy(t *testing.T) {
+	ctx := createTestContext(t)
+	ctx.context.Config.Server.Security = Security{ContentSecurityPolicy: map[string]string{"img-src": "'self' data:"}}
+	ctx.context.FileManager.Files["content/video.html"] = &File{
+		Path:    "content/video.html",
+		Content: []byte("<iframe></iframe>"),
+		Routes:  []string{"/video"},
+		Metadata: FileMetadata{
+			MimeType:              "text/html",
+			ContentSecurityPolicy: map[string]string{"frame-src": "https://www.youtube.com"},
+		},
+	}
+
+	rm, err := newRouterManager(ctx.context)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	tests := []struct {
+		route    string
+		expected string
+	}{
+		{"/about", "default-src 'self'; img-src 'self' data:; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'"},
+		{"/video", "default-src 'self'; frame-src https://www.youtube.com; img-src 'self' data:; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.route, nil)
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, tt.route)
+		assert.Equal(t, tt.expected, w.Header().Get("Content-Security-Policy"), tt.route)
+	}
+}
+
+func TestRateLimiterConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(RateLimit{
+		RequestsPerMinute: 2,
+		TrustedProxies:    []string{"10.0.0.1"},
+		Allowlist:         []string{"192.168.0.0/16"},
+		ExemptPaths:       []string{"/health", "/assets/*"},
+	})
+	defer rl.Stop()
+
+	engine := gin.New()
+	engine.Use(rl.Middleware())
+	engine.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(path, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The limit applies to each client
+	assert.Equal(t, http.StatusOK, request("/", "203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusOK, request("/", "203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusTooManyRequests, request("/", "203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusOK, request("/", "203.0.113.2:1234", ""))
+
+	// Exempt paths and allowlisted clients are not limited
+	assert.Equal(t, http.StatusOK, request("/health", "203.0.113.1:1234", ""))
+	assert.Equal(t, http.StatusOK, request("/assets/site.css", "203.0.113.1:1234", ""))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, request("/", "192.168.1.1:1234", ""))
+	}
+
+	// X-Forwarded-For is only used if the request comes from a trusted proxy
+	assert.Equal(t, http.StatusOK, request("/", "10.0.0.1:1234", "203.0.113.3"))
+	assert.Equal(t, http.StatusOK, request("/", "10.0.0.1:1234", "203.0.113.3"))
+	assert.Equal(t, http.StatusTooManyRequests, request("/", "10.0.0.1:1234", "203.0.113.3"))
+	assert.Equal(t, http.StatusTooManyRequests, request("/", "203.0.113.1:1234", "203.0.113.4"))
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerMinute: 100, Burst: 2})
+	defer rl.Stop()
+
+	assert.True(t, rl.Allow("203.0.113.1"))
+	assert.True(t, rl.Allow("203.0.113.1"))
+	assert.False(t, rl.Allow("203.0.113.1"))
+	assert.True(t, rl.Allow("203.0.113.2"))
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerMinute: 60, Burst: 3})
+	defer rl.Stop()
+
+	now := time.Now()
+	for i := 2; i >= 0; i-- {
+		decision := rl.take(RateLimitPages, "203.0.113.1", now)
+		assert.True(t, decision.allowed)
+		assert.Equal(t, i, decision.remaining)
+	}
+
+	decision := rl.take(RateLimitPages, "203.0.113.1", now)
+	assert.False(t, decision.allowed)
+	assert.Equal(t, time.Second, decision.retryAfter)
+	assert.Equal(t, 3*time.Second, decision.reset)
+
+	// One token per second is refilled, up to the burst
+	assert.True(t, rl.take(RateLimitPages, "203.0.113.1", now.Add(time.Second)).allowed)
+	assert.False(t, rl.take(RateLimitPages, "203.0.113.1", now.Add(time.Second)).allowed)
+	assert.Equal(t, 2, rl.take(RateLimitPages, "203.0.113.1", now.Add(time.Hour)).remaining)
+
+	// Each class has its own buckets
+	assert.True(t, rl.take(RateLimitAssets, "203.0.113.1", now).allowed)
+	assert.Len(t, rl.buckets, 2)
+}
+
+func TestRateLimiterClasses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(RateLimit{
+		RequestsPerMinute: 1,
+		Classes: map[string]RateLimitClass{
+			RateLimitAssets:  {RequestsPerMinute: 120, Burst: 2},
+			RateLimitMetrics: {RequestsPerMinute: -1},
+			RateLimitSearch:  {Paths: []string{"/find"}},
+		},
+	})
+	defer rl.Stop()
+
+	engine := gin.New()
+	engine.Use(rl.Middleware())
+	engine.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+
+	w = request("/about")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request("/assets/site.css").Code)
+	assert.Equal(t, http.StatusOK, request("/assets/site.js").Code)
+	w = request("/assets/logo.png")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request("/find").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("/find").Code)
+
+	for i := 0; i < 3; i++ {
+		w = request("/health")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(RateLimit{TrustedProxies: []string{"10.0.0.0/8"}})
+	defer rl.Stop()
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		expected     string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "", "203.0.113.1"},
+		{"untrusted proxy", "203.0.113.1:1234", []string{"198.51.100.1"}, "", "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"forged address", "10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.1"}, "", "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", []string{"198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"multiple headers", "10.0.0.1:1234", []string{"192.0.2.1", "198.51.100.1"}, "", "198.51.100.1"},
+		{"malformed address", "10.0.0.1:1234", []string{"198.51.100.1, bogus, 10.0.0.2"}, "", "10.0.0.2"},
+		{"only proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"real ip", "10.0.0.1:1234", nil, "198.51.100.1", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+			assert.Equal(t, tt.expected, rl.clientIP(c).String())
+		})
+	}
+}
+
+func TestPageContentSecurityPolicyValidation(t *testing.T) {
+	pm := NewPluginManager()
+	pm.RegisterPlugin(NewMockPlugin("frontmatter", 10).WithProcessFunc(func(ctx *PluginContext) *PluginResult {
+		ctx.File.Metadata.ContentSecurityPolicy = map[string]string{
+			strings.TrimSuffix(path.Base(ctx.File.Path), ".html"): "https://www.youtube.com",
+		}
+		return &PluginResult{Success: true}
+	}))
+	fm := &FileManager{SiteDirectory: "/test"}
+
+	// Valid directives are kept, invalid ones are dropped when the page is
+	// processed, so that requests do not check them again
+	valid := pm.Process(File{Path: "content/frame-src.html"}, fm)
+	assert.Equal(t, map[string]string{"frame-src": "https://www.youtube.com"}, valid.Metadata.ContentSecurityPolicy)
+
+	invalid := pm.Process(File{Path: "content/Frame Src.html"}, fm)
+	assert.Nil(t, invalid.Metadata.ContentSecurityPolicy)
+}
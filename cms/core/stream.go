@@ -0,0 +1,187 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Large files (e.g. videos and PDFs) are not processed by plugins and not
+// kept in memory. They are streamed from disk, which also answers range
+// requests, e.g. when seeking in a video.
+
+// Files with at least this size are streamed, unless configured otherwise
+const DefaultStreamThreshold = 8 << 20
+
+type Streaming struct {
+	// Size in bytes from which files are streamed. DefaultStreamThreshold
+	// if not specified, -1 disables streaming.
+	Threshold int64 `yaml:"threshold"`
+}
+
+func (s *Streaming) Validate() error {
+	if s.Threshold < -1 {
+		return fmt.Errorf("invalid threshold %d", s.Threshold)
+	}
+	return nil
+}
+
+// Returns true if a file is streamed. Pages, other text files and images are
+// always processed by plugins, whatever their size.
+func (s *Streaming) streams(size int64, mimeType string) bool {
+	threshold := s.Threshold
+	switch {
+	case threshold < 0:
+		return false
+	case threshold == 0:
+		threshold = DefaultStreamThreshold
+	}
+	if strings.HasPrefix(mimeType, "text/") || strings.HasPrefix(mimeType, "image/") {
+		return false
+	}
+	return size >= threshold
+}
+
+// Returns the MIME type of a file from its extension or, if the extension is
+// unknown, from its first bytes
+func SniffMimeType(filePath string) string {
+	if mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(filePath))); mimeType != "" {
+		return mimeType
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(head[:n])
+}
+
+// Returns true if a file in the content or assets directory is streamed
+// (thread-safe)
+func (fm *FileManager) Streams(file *File) bool {
+	_, _, streamed := fm.streamInfo(file)
+	return streamed
+}
+
+// Returns the file info and MIME type of a file which is streamed
+func (fm *FileManager) streamInfo(file *File) (os.FileInfo, string, bool) {
+	if !strings.HasPrefix(file.Path, "content/") && !strings.HasPrefix(file.Path, "assets/") {
+		return nil, "", false
+	}
+
+	fullPath := file.DiskPath(fm.SiteDirectory)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, "", false
+	}
+
+	fm.mu.RLock()
+	streaming := fm.streaming
+	fm.mu.RUnlock()
+
+	mimeType := SniffMimeType(fullPath)
+	return info, mimeType, streaming.streams(info.Size(), mimeType)
+}
+
+// Marks a file as streamed if it is large enough; its route is the path of
+// the file. Returns false if the file has to be processed by plugins.
+func (fm *FileManager) streamFile(file *File) bool {
+	info, mimeType, streamed := fm.streamInfo(file)
+	file.Streamed = streamed
+	if !streamed {
+		return false
+	}
+
+	fm.mu.RLock()
+	languages := fm.languages
+	fm.mu.RUnlock()
+
+	route := "/" + file.Path
+	if strings.HasPrefix(file.Path, "content/") {
+		key := file.TranslationKey
+		if key == "" {
+			key = file.Path
+		}
+		route = languages.RoutePrefix(file.Language) + "/" + strings.TrimPrefix(key, "content/")
+	}
+
+	file.Content = nil
+	file.OutputFiles = nil
+	file.Compressed = nil
+	file.CompressedOutputFiles = nil
+	file.OutputHashes = nil
+	file.Routes = []string{route}
+	file.Metadata.MimeType = mimeType
+
+	// The ETag changes with the file, like the ETags of nginx
+	file.ModTime = info.ModTime()
+	file.ContentHash = fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	return true
+}
+
+// Streams a file from disk. Range requests (including If-Range) are answered
+// with 206 Partial Content, conditional requests with 304 Not Modified.
+func serveFile(c *gin.Context, siteDirectory string, file *File, cacheControl string) {
+	f, err := os.Open(file.DiskPath(siteDirectory))
+	if err != nil {
+		log.Printf("Failed to open %s: %v", file.Path, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", file.Metadata.MimeType)
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	header.Set("ETag", `"`+file.ContentHash+`"`)
+
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, withWriteDeadlines(c.Request, f))
+}
+
+// Key of the http.ResponseController of a request in its context
+type responseControllerKey struct{}
+
+// Extends the write deadline of the connection before each chunk of a file
+// is sent. The server's WriteTimeout applies to the whole response, and
+// would cut off the download of a large file by a slow client; this way only
+// clients which stop reading time out.
+type deadlineReader struct {
+	io.ReadSeeker
+	controller *http.ResponseController
+	timeout    time.Duration
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if err := r.controller.SetWriteDeadline(time.Now().Add(r.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to extend the write deadline: %v", err)
+	}
+	return r.ReadSeeker.Read(p)
+}
+
+// Returns the file as it is if the server has no WriteTimeout
+func withWriteDeadlines(r *http.Request, f io.ReadSeeker) io.ReadSeeker {
+	server, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+	controller, _ := r.Context().Value(responseControllerKey{}).(*http.ResponseController)
+	if server == nil || server.WriteTimeout <= 0 || controller == nil {
+		return f
+	}
+	return &deadlineReader{ReadSeeker: f, controller: controller, timeout: server.WriteTimeout}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "content"), 0755))
+
+	video := bytes.Repeat([]byte("0123456789"), 10)
+	files := map[string][]byte{
+		"content/video.mp4":  video,
+		"content/manual":     append([]byte("%PDF-1.7\n"), video...),
+		"content/small.mp4":  []byte("small"),
+		"content/large.html": video,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), content, 0644))
+	}
+
+	fm := NewFileManager(tempDir)
+	fm.SetStreaming(Streaming{Threshold: 64})
+	require.NoError(t, fm.WalkDirectory("content"))
+	fm.ProcessAllFiles()
+
+	tests := []struct {
+		path     string
+		streamed bool
+		mimeType string
+	}{
+		{"content/video.mp4", true, "video/mp4"},
+		{"content/manual", true, "application/pdf"},
+		{"content/small.mp4", false, ""},
+		{"content/large.html", false, ""},
+	}
+	for _, tt := range tests {
+		file := fm.GetFile(tt.path)
+		require.NotNil(t, file, tt.path)
+		assert.Equal(t, tt.streamed, file.Streamed, tt.path)
+		if tt.streamed {
+			assert.Nil(t, file.Content, tt.path)
+			assert.Equal(t, tt.mimeType, file.Metadata.MimeType, tt.path)
+			assert.False(t, file.NeedsUpdate(), tt.path)
+		}
+	}
+
+	ctx := &Context{Config: Config{SiteDirectory: tempDir}, FileManager: fm}
+	rm, err := newRouterManager(ctx)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/video.mp4", nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		rm.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "video/mp4", w.Header().Get("Content-Type"))
+	assert.Equal(t, video, w.Body.Bytes())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = get(http.Header{"Range": {"bytes=10-19"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 10-19/100", w.Header().Get("Content-Range"))
+	assert.Equal(t, video[10:20], w.Body.Bytes())
+
+	// The range is ignored if the file has changed
+	w = get(http.Header{"Range": {"bytes=10-19"}, "If-Range": {`"outdated"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, video, w.Body.Bytes())
+
+	w = get(http.Header{"Range": {"bytes=10-19"}, "If-Range": {etag}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+
+	w = get(http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestStreamedFilesWriteTimeout(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "content"), 0755))
+	video := bytes.Repeat([]byte("0123456789abcdef"), 1<<20) // 16 MiB
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "content/video.mp4"), video, 0644))
+
+	fm := NewFileManager(tempDir)
+	fm.SetStreaming(Streaming{Threshold: 1 << 20})
+	require.NoError(t, fm.WalkDirectory("content"))
+	fm.ProcessAllFiles()
+	require.True(t, fm.GetFile("content/video.mp4").Streamed)
+
+	ctx := &Context{Config: Config{SiteDirectory: tempDir}, FileManager: fm}
+	rm, err := newRouterManager(ctx)
+	require.NoError(t, err)
+	defer rm.Stop()
+
+	server := httptest.NewUnstartedServer(rm)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// A slow client takes longer than the WriteTimeout for the whole file
+	resp, err := http.Get(server.URL + "/video.mp4")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	start := time.Now()
+	var received bytes.Buffer
+	chunk := make([]byte, 256<<10)
+	for {
+		n, err := io.ReadFull(resp.Body, chunk)
+		received.Write(chunk[:n])
+		if err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Greater(t, time.Since(start), server.Config.WriteTimeout)
+	assert.Equal(t, len(video), received.Len())
+	assert.True(t, bytes.Equal(video, received.Bytes()))
+}
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Symlinks in the site are skipped, unless the site follows them, e.g. to
+// share layout/partials or a large media directory between several sites.
+// A followed link must point into the site directory or one of the allowed
+// roots. Files behind a link keep the path of the link, which their routes
+// are derived from, and are read from their resolved path.
+
+// ErrSymlinkOutsideRoots is returned for a symlink which points outside of
+// the site directory and the allowed roots
+var ErrSymlinkOutsideRoots = errors.New("symlink points outside of the allowed roots")
+
+// Directories which followed symlinks may point into
+type symlinkRoots []string // Resolved absolute paths, the site directory first
+
+// Returns true if a resolved absolute path is in one of the roots
+func (r symlinkRoots) contain(path string) bool {
+	for _, root := range r {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the resolved absolute path of a path, and the info of the file it
+// points to. Fails if the path points outside of the roots.
+func (r symlinkRoots) resolve(path string) (string, os.FileInfo, error) {
+	resolved, err := realPath(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !r.contain(resolved) {
+		return "", nil, fmt.Errorf("%w: %s", ErrSymlinkOutsideRoots, resolved)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", nil, err
+	}
+	return resolved, info, nil
+}
+
+// Returns the absolute path of a path without symlinks
+func realPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// Follows symlinks which point into the site directory, or into one of the
+// given directories (relative to the site directory, or absolute). Without
+// a call, symlinks are skipped. Must be called before the site is walked.
+func (fm *FileManager) FollowSymlinks(roots []string) error {
+	site, err := realPath(fm.SiteDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the site directory: %w", err)
+	}
+
+	resolvedRoots := symlinkRoots{site}
+	for _, root := range roots {
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(fm.SiteDirectory, root)
+		}
+		resolved, err := realPath(root)
+		if err != nil {
+			return fmt.Errorf("invalid symlink root: %w", err)
+		}
+		resolvedRoots = append(resolvedRoots, resolved)
+	}
+	fm.symlinks.Store(&resolvedRoots)
+	return nil
+}
+
+// Returns true if symlinks are followed (thread-safe)
+func (fm *FileManager) FollowsSymlinks() bool {
+	return fm.symlinks.Load() != nil
+}
+
+// A file or directory of the site, see walkSite
+type siteEntry struct {
+	path     string      // Path in the site, including the site directory
+	resolved string      // Resolved path of an entry behind a symlink, "" otherwise
+	link     bool        // The entry itself is a followed symlink
+	info     os.FileInfo // Of the resolved path; of the symlink if it is not followed
+}
+
+// Returns a path in the site. If symlinks are followed, a path behind a
+// symlink is resolved; otherwise the entry of a symlink is the link itself.
+func (fm *FileManager) statSite(path string) (siteEntry, error) {
+	roots := fm.symlinks.Load()
+	info, err := os.Lstat(path)
+	if err != nil || roots == nil {
+		return siteEntry{path: path, info: info}, err
+	}
+
+	resolved, target, err := roots.resolve(path)
+	if err != nil {
+		return siteEntry{}, err
+	}
+	entry := siteEntry{path: path, link: info.Mode()&os.ModeSymlink != 0, info: target}
+
+	// A path in a linked directory is resolved like the link
+	relPath, err := filepath.Rel(fm.SiteDirectory, path)
+	if err != nil {
+		return siteEntry{}, err
+	}
+	if resolved != filepath.Join((*roots)[0], relPath) {
+		entry.resolved = resolved
+	}
+	return entry, nil
+}
+
+// Called by walkSite for every file and directory. Returning filepath.SkipDir
+// skips a directory, like filepath.WalkFunc.
+type siteWalkFunc func(entry siteEntry, err error) error
+
+// Walks a directory of the site in lexical order like filepath.Walk, and
+// follows symlinks if the site follows them. Links which cannot be resolved,
+// point outside of the allowed roots, or point to one of their parent
+// directories (a cycle) are logged and skipped.
+func (fm *FileManager) walkSite(root string, fn siteWalkFunc) error {
+	entry, err := fm.statSite(root)
+	if err != nil {
+		err = fn(siteEntry{path: root}, err)
+	} else {
+		err = fm.walkSiteEntry(entry, fm.parentDirectories(root), fn)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// Returns the resolved paths of the directories which contain a path in
+// the site, if symlinks are followed
+func (fm *FileManager) parentDirectories(path string) []string {
+	if fm.symlinks.Load() == nil {
+		return nil
+	}
+
+	var parents []string
+	relPath, err := filepath.Rel(fm.SiteDirectory, path)
+	for err == nil && relPath != "." && !strings.HasPrefix(relPath, "..") {
+		relPath = filepath.Dir(relPath)
+		if resolved, err := realPath(filepath.Join(fm.SiteDirectory, relPath)); err == nil {
+			parents = append(parents, resolved)
+		}
+	}
+	return parents
+}
+
+func (fm *FileManager) walkSiteEntry(entry siteEntry, parents []string, fn siteWalkFunc) error {
+	// A directory which is entered again through a symlink is a cycle
+	if entry.info.IsDir() && fm.symlinks.Load() != nil {
+		resolved := entry.resolved
+		if resolved == "" {
+			resolved, _ = realPath(entry.path)
+		}
+		if slices.Contains(parents, resolved) {
+			log.Printf("Skipping symlink %s: it points to one of its parent directories", entry.path)
+			return nil
+		}
+		parents = append(parents, resolved)
+	}
+
+	if err := fn(entry, nil); err != nil || !entry.info.IsDir() {
+		return err
+	}
+
+	dirEntries, err := os.ReadDir(entry.path)
+	if err != nil {
+		return fn(entry, err)
+	}
+
+	for _, dirEntry := range dirEntries {
+		child, err := fm.childEntry(entry, dirEntry)
+		if err != nil {
+			log.Printf("Skipping %s: %v", filepath.Join(entry.path, dirEntry.Name()), err)
+			continue
+		}
+
+		err = fm.walkSiteEntry(child, parents, fn)
+		if errors.Is(err, filepath.SkipDir) {
+			if child.info.IsDir() {
+				continue
+			}
+			return nil // Skips the remaining files of the directory
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns an entry of a directory which is walked
+func (fm *FileManager) childEntry(parent siteEntry, dirEntry os.DirEntry) (siteEntry, error) {
+	path := filepath.Join(parent.path, dirEntry.Name())
+	if dirEntry.Type()&os.ModeSymlink != 0 && fm.symlinks.Load() != nil {
+		resolved, info, err := fm.symlinks.Load().resolve(path)
+		if err != nil {
+			return siteEntry{}, err
+		}
+		return siteEntry{path: path, resolved: resolved, link: true, info: info}, nil
+	}
+
+	info, err := dirEntry.Info()
+	if err != nil {
+		return siteEntry{}, err
+	}
+	child := siteEntry{path: path, info: info}
+	if parent.resolved != "" {
+		child.resolved = filepath.Join(parent.resolved, dirEntry.Name())
+	}
+	return child, nil
+}
+
+// Watches the directory of the target of a symlinked file. The events of the
+// target are reported for the link, see eventPaths.
+func (fw *FileWatcher) watchLinkedFile(path, resolved string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if !slices.Contains(fw.linkedFiles[resolved], path) {
+		fw.linkedFiles[resolved] = append(fw.linkedFiles[resolved], path)
+	}
+
+	// The directories of the site are watched already
+	dir := filepath.Dir(resolved)
+	roots := fw.fm.symlinks.Load()
+	if fw.targetDirs[dir] || roots == nil || (*roots)[:1].contain(dir) {
+		return
+	}
+	if err := fw.backend.Add(dir); err != nil {
+		log.Printf("Failed to watch directory %s: %v", dir, err)
+		return
+	}
+	fw.targetDirs[dir] = true
+	log.Printf("Watching directory: %s (target of %s)", dir, path)
+}
+
+// Forgets the symlinked files at or below a deleted path
+func (fw *FileWatcher) unwatchLinkedFile(path string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for resolved, links := range fw.linkedFiles {
+		links = slices.DeleteFunc(links, func(link string) bool {
+			return link == path || strings.HasPrefix(link, path+string(filepath.Separator))
+		})
+		if len(links) == 0 {
+			delete(fw.linkedFiles, resolved)
+		} else {
+			fw.linkedFiles[resolved] = links
+		}
+	}
+}
+
+// Returns the paths in the site which an event of the backend concerns: the
+// path of the event if it is in the site, and the symlinks to it
+func (fw *FileWatcher) eventPaths(name string) []string {
+	var paths []string
+	resolved := name
+	if relPath, err := fw.getRelativePath(name); err == nil && filepath.IsLocal(relPath) {
+		paths = append(paths, name)
+		if roots := fw.fm.symlinks.Load(); roots != nil {
+			resolved = filepath.Join((*roots)[0], relPath)
+		}
+	}
+
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return append(paths, fw.linkedFiles[resolved]...)
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a site, and a directory outside of it which is shared by links
+func createSymlinkTestSite(t *testing.T) (siteDir, sharedDir string) {
+	tempDir := t.TempDir()
+	siteDir = filepath.Join(tempDir, "site")
+	sharedDir = filepath.Join(tempDir, "shared")
+	for _, name := range []string{"site/content/page.md", "site/layout/header.html", "shared/partials/footer.html", "shared/media/logo.svg", "secret/key.txt"} {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+
+	links := map[string]string{
+		"site/layout/partials":  "../../shared/partials",
+		"site/content/logo.svg": "../../shared/media/logo.svg",
+		"site/content/loop":     "..",
+		"site/content/secret":   "../../secret",
+		"site/content/missing":  "../../shared/missing",
+	}
+	for link, target := range links {
+		require.NoError(t, os.Symlink(target, filepath.Join(tempDir, link)))
+	}
+	return siteDir, sharedDir
+}
+
+func TestWalkDirectorySymlinks(t *testing.T) {
+	siteDir, sharedDir := createSymlinkTestSite(t)
+
+	// Symlinks are skipped by default
+	fm := NewFileManager(siteDir)
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+	assert.NotNil(t, fm.GetFile("content/page.md"))
+	assert.Nil(t, fm.GetFile("content/logo.svg"))
+	assert.Nil(t, fm.GetFile("layout/partials/footer.html"))
+
+	fm = NewFileManager(siteDir)
+	require.NoError(t, fm.FollowSymlinks([]string{"../shared"}))
+	assert.True(t, fm.FollowsSymlinks())
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+
+	// Files keep the path of the link, and are read from their target
+	footer := fm.GetFile("layout/partials/footer.html")
+	require.NotNil(t, footer)
+	resolvedShared, err := filepath.EvalSymlinks(sharedDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(resolvedShared, "partials/footer.html"), footer.ResolvedPath)
+	assert.Equal(t, "shared/partials/footer.html", string(footer.ReadFile(siteDir)))
+
+	logo := fm.GetFile("content/logo.svg")
+	require.NotNil(t, logo)
+	assert.Equal(t, "shared/media/logo.svg", string(logo.ReadFile(siteDir)))
+
+	page := fm.GetFile("content/page.md")
+	assert.Empty(t, page.ResolvedPath)
+	assert.Equal(t, filepath.Join(siteDir, "content/page.md"), page.DiskPath(siteDir))
+
+	// Cycles, links outside of the roots and broken links are skipped
+	assert.Nil(t, fm.GetDirectory("content/loop"))
+	assert.Nil(t, fm.GetFile("content/loop/content/page.md"))
+	assert.Nil(t, fm.GetFile("content/secret/key.txt"))
+	assert.Nil(t, fm.GetFile("content/missing"))
+
+	assert.Error(t, NewFileManager(siteDir).FollowSymlinks([]string{"../nonexistent"}))
+}
+
+func TestSymlinkWatching(t *testing.T) {
+	siteDir, sharedDir := createSymlinkTestSite(t)
+	fm := NewFileManager(siteDir)
+	require.NoError(t, fm.FollowSymlinks([]string{"../shared"}))
+	require.NoError(t, fm.WalkDirectory("content"))
+	require.NoError(t, fm.WalkDirectory("layout"))
+
+	fw, err := newTestFileWatcher(fm)
+	require.NoError(t, err)
+	fw.SetRouter(newMockRouterManager())
+	require.NoError(t, fw.Start(siteDir))
+	defer fw.Stop()
+
+	// The targets of links are watched
+	watched := fw.GetWatchedDirectories()
+	assert.Contains(t, watched, filepath.Join(siteDir, "layout/partials"))
+	assert.NotContains(t, watched, filepath.Join(siteDir, "content/loop"))
+
+	expectEvent := func(eventType FileWatchEventType, path string) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case event := <-fw.GetEventChannel():
+				if event.Type == eventType && event.Path == path {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("Timeout waiting for %s %s", eventType, path)
+			}
+		}
+	}
+
+	// Changes of the targets are reported at the path of the link
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(filepath.Join(sharedDir, "partials/footer.html"), []byte("<footer>"), 0644))
+	expectEvent(FileModified, filepath.Join("layout", "partials", "footer.html"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(sharedDir, "media/logo.svg"), []byte("<svg>"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(sharedDir, "media/logo.svg"), later, later))
+	expectEvent(FileModified, filepath.Join("content", "logo.svg"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(sharedDir, "partials/nav.html"), []byte("<nav>"), 0644))
+	expectEvent(FileCreated, filepath.Join("layout", "partials", "nav.html"))
+
+	// The resolved path is kept when the file is added again
+	file := fm.AddFile(filepath.Join("content", "logo.svg"))
+	assert.Equal(t, "<svg>", string(file.ReadFile(siteDir)))
+	assert.Equal(t, later.Unix(), file.SourceModTime.Unix())
+}
@@ -3,6 +3,8 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 )
@@ -156,6 +158,7 @@ func (tds *TestDirectoryStructure) Create(t *testing.T) []string {
 
 // EventCollector helps collect and verify file watch events during tests
 type EventCollector struct {
+	mu       sync.Mutex // Protects events, which are collected in a goroutine
 	events   []FileWatchEvent
 	eventCh  <-chan FileWatchEvent
 	stopCh   chan bool
@@ -184,7 +187,14 @@ func (ec *EventCollector) Stop() []FileWatchEvent {
 		ec.stopping = true
 		close(ec.stopCh)
 	}
-	return ec.events
+	return ec.getEvents()
+}
+
+// Returns a copy of the events collected so far
+func (ec *EventCollector) getEvents() []FileWatchEvent {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return slices.Clone(ec.events)
 }
 
 // collectEvents runs in a goroutine to collect events
@@ -197,7 +207,9 @@ func (ec *EventCollector) collectEvents() {
 			if !ok {
 				return
 			}
+			ec.mu.Lock()
 			ec.events = append(ec.events, event)
+			ec.mu.Unlock()
 		case <-ec.stopCh:
 			return
 		case <-timeoutTimer:
@@ -211,19 +223,19 @@ func (ec *EventCollector) WaitForEvents(count int) []FileWatchEvent {
 	deadline := time.Now().Add(ec.timeout)
 
 	for time.Now().Before(deadline) {
-		if len(ec.events) >= count {
-			return ec.events[:count]
+		if events := ec.getEvents(); len(events) >= count {
+			return events[:count]
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	return ec.events
+	return ec.getEvents()
 }
 
 // GetEventsOfType returns events of a specific type
 func (ec *EventCollector) GetEventsOfType(eventType FileWatchEventType) []FileWatchEvent {
 	filtered := make([]FileWatchEvent, 0)
-	for _, event := range ec.events {
+	for _, event := range ec.getEvents() {
 		if event.Type == eventType {
 			filtered = append(filtered, event)
 		}
@@ -234,7 +246,7 @@ func (ec *EventCollector) GetEventsOfType(eventType FileWatchEventType) []FileWa
 // GetEventsForPath returns events for a specific path
 func (ec *EventCollector) GetEventsForPath(path string) []FileWatchEvent {
 	filtered := make([]FileWatchEvent, 0)
-	for _, event := range ec.events {
+	for _, event := range ec.getEvents() {
 		if event.Path == path {
 			filtered = append(filtered, event)
 		}
@@ -412,8 +424,10 @@ func (te *TestEnvironment) GetRouteForFile(filePath string) string {
 	return ""
 }
 
-// MockPlugin provides a simple plugin implementation for testing
+// MockPlugin provides a simple plugin implementation for testing. Files are
+// processed in parallel, the calls are recorded under a lock.
 type MockPlugin struct {
+	mu            sync.Mutex
 	name          string
 	priority      int
 	processFunc   func(ctx *PluginContext) *PluginResult
@@ -469,21 +483,29 @@ func (mp *MockPlugin) CanProcess(file *File) bool {
 }
 
 func (mp *MockPlugin) Process(ctx *PluginContext) *PluginResult {
+	mp.mu.Lock()
 	mp.callCount++
 	mp.processedFiles = append(mp.processedFiles, ctx.File.Path)
+	mp.mu.Unlock()
 	return mp.processFunc(ctx)
 }
 
 // Test helper methods
 func (mp *MockPlugin) GetCallCount() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
 	return mp.callCount
 }
 
 func (mp *MockPlugin) GetProcessedFiles() []string {
-	return mp.processedFiles
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return slices.Clone(mp.processedFiles)
 }
 
 func (mp *MockPlugin) Reset() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
 	mp.callCount = 0
 	mp.processedFiles = make([]string, 0)
 }
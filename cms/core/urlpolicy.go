@@ -0,0 +1,156 @@
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// UrlPolicy decides how the URLs of pages look. All other URLs of a page
+// (e.g. "/about.html" or "/About" for "content/about.html") are redirected
+// to the canonical one.
+type UrlPolicy struct {
+	TrailingSlash bool `yaml:"trailing-slash"` // "/about/" instead of "/about"
+	Lowercase     bool `yaml:"lowercase"`      // "/about" for "content/About.md"
+	KeepExtension bool `yaml:"keep-extension"` // "/about.html" instead of "/about"
+
+	// Patterns for the URLs of the pages in a section (a directory in
+	// content/), e.g. "blog": "/blog/:year/:month/:slug/"
+	Permalinks map[string]string `yaml:"permalinks"`
+}
+
+// Placeholders of permalink patterns. The date is taken from "date" in the
+// frontmatter, the slug from "slug" or the file name.
+var permalinkPlaceholders = []string{":year", ":month", ":day", ":slug", ":section"}
+
+var permalinkPlaceholder = regexp.MustCompile(`:[a-z]+`)
+
+func (p *UrlPolicy) Validate() error {
+	for section, pattern := range p.Permalinks {
+		if section == "" || strings.Contains(section, "/") {
+			return fmt.Errorf("invalid permalink section %q", section)
+		}
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("permalink pattern %q of section %s must start with '/'", pattern, section)
+		}
+		for _, placeholder := range permalinkPlaceholder.FindAllString(pattern, -1) {
+			if !slices.Contains(permalinkPlaceholders, placeholder) {
+				return fmt.Errorf("unknown placeholder %s in permalink pattern %q", placeholder, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Extensions of pages, which are rendered to HTML
+var pageExtensions = []string{".html", ".htm", ".md", ".markdown"}
+
+// Returns true if the route has no extension, or the extension of a page
+func isPageRoute(route string) bool {
+	ext := strings.ToLower(path.Ext(route))
+	return ext == "" || slices.Contains(pageExtensions, ext)
+}
+
+// Returns the canonical URL of a page route, e.g. "/about" for "/about.md",
+// "/about/" and "/about.html". Index pages are served from their directory.
+// Routes of other files (e.g. "/photo.jpg") are only cleaned.
+func (p UrlPolicy) Canonical(route string) string {
+	route = path.Clean("/" + route)
+	if route == "/" || !isPageRoute(route) {
+		return route
+	}
+
+	route = strings.TrimSuffix(route, path.Ext(route))
+	if p.Lowercase {
+		route = strings.ToLower(route)
+	}
+
+	// Index pages are served from their directory, which has a trailing
+	// slash if the page would have one, or an extension
+	if path.Base(route) == "index" {
+		route = path.Dir(route)
+		if route == "/" || p.TrailingSlash || p.KeepExtension {
+			return strings.TrimSuffix(route, "/") + "/"
+		}
+		return route
+	}
+
+	switch {
+	case p.KeepExtension:
+		return route + ".html"
+	case p.TrailingSlash:
+		return route + "/"
+	}
+	return route
+}
+
+// Returns the route of a page (e.g. "/blog/2025/01-post1.md", without the
+// language prefix) according to the permalink pattern of its section, e.g.
+// "/blog/2025/01/post1/" for "/blog/:year/:month/:slug/". The route keeps the
+// trailing slash of the pattern. Index pages, and pages in sections without a
+// pattern, get their canonical URL; so do pages without the date which the
+// pattern needs, which is returned as an error.
+func (p UrlPolicy) PageRoute(route string, metadata FileMetadata) (string, error) {
+	route = path.Clean("/" + route)
+	section, _, nested := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	name := strings.TrimSuffix(path.Base(route), path.Ext(route))
+	pattern, exists := p.Permalinks[section]
+	if !exists || !nested || name == "index" || !isPageRoute(route) {
+		return p.Canonical(route), nil
+	}
+
+	date := metadata.Date
+	var err error
+	expanded := permalinkPlaceholder.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		switch placeholder {
+		case ":section":
+			return section
+		case ":slug":
+			return cmp.Or(metadata.Slug, name)
+		}
+		if date.IsZero() {
+			err = fmt.Errorf("%w: permalink pattern %q needs a date in the frontmatter", ErrInvalidRoute, pattern)
+		}
+		switch placeholder {
+		case ":year":
+			return fmt.Sprintf("%04d", date.Year())
+		case ":month":
+			return fmt.Sprintf("%02d", date.Month())
+		}
+		return fmt.Sprintf("%02d", date.Day())
+	})
+	if err != nil {
+		return p.Canonical(route), err
+	}
+
+	if p.Lowercase {
+		expanded = strings.ToLower(expanded)
+	}
+	return cleanRoute(expanded), nil
+}
+
+// Cleans a route, but keeps its trailing slash
+func cleanRoute(route string) string {
+	cleaned := path.Clean("/" + route)
+	if strings.HasSuffix(route, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Returns the path of the file which is served for a route by a static web
+// server: "/about/" is stored as "/about/index.html", "/about" as
+// "/about.html" (which is how e.g. Netlify and Cloudflare Pages serve
+// URLs without extension), and other routes as they are
+func (p UrlPolicy) OutputPath(route string) string {
+	switch {
+	case strings.HasSuffix(route, "/"):
+		return route + "index.html"
+	case path.Ext(route) == "":
+		return route + ".html"
+	}
+	return route
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUrlPolicyCanonical(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   UrlPolicy
+		route    string
+		expected string
+	}{
+		{"page", UrlPolicy{}, "/about.md", "/about"},
+		{"html page", UrlPolicy{}, "/docs/About.html", "/docs/About"},
+		{"trailing slash removed", UrlPolicy{}, "/about/", "/about"},
+		{"root", UrlPolicy{}, "/index.html", "/"},
+		{"index page", UrlPolicy{}, "/blog/index.md", "/blog"},
+		{"other file", UrlPolicy{Lowercase: true}, "/images/Photo.JPG", "/images/Photo.JPG"},
+		{"lowercase", UrlPolicy{Lowercase: true}, "/Docs/About.html", "/docs/about"},
+		{"trailing slash", UrlPolicy{TrailingSlash: true}, "/about.md", "/about/"},
+		{"trailing slash index", UrlPolicy{TrailingSlash: true}, "/blog/index.html", "/blog/"},
+		{"trailing slash root", UrlPolicy{TrailingSlash: true}, "/", "/"},
+		{"extension", UrlPolicy{KeepExtension: true}, "/about.md", "/about.html"},
+		{"extension without", UrlPolicy{KeepExtension: true}, "/about", "/about.html"},
+		{"extension index", UrlPolicy{KeepExtension: true}, "/blog/index.md", "/blog/"},
+		{"extension over trailing slash", UrlPolicy{KeepExtension: true, TrailingSlash: true}, "/about/", "/about.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Canonical(tt.route); got != tt.expected {
+				t.Errorf("Canonical(%s) = %s, expected %s", tt.route, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUrlPolicyOutputPath(t *testing.T) {
+	tests := []struct {
+		route    string
+		expected string
+	}{
+		{"/", "/index.html"},
+		{"/blog/", "/blog/index.html"},
+		{"/about", "/about.html"},
+		{"/about.html", "/about.html"},
+		{"/images/photo.jpg", "/images/photo.jpg"},
+	}
+
+	var policy UrlPolicy
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			if got := policy.OutputPath(tt.route); got != tt.expected {
+				t.Errorf("OutputPath(%s) = %s, expected %s", tt.route, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUrlPolicyPageRoute(t *testing.T) {
+	policy := UrlPolicy{Permalinks: map[string]string{
+		"blog": "/blog/:year/:month/:slug/",
+		"docs": "/:section/:slug",
+	}}
+	date := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		route    string
+		metadata FileMetadata
+		expected string
+		err      bool
+	}{
+		{"pattern", "/blog/2025/01-post1.md", FileMetadata{Date: date}, "/blog/2025/03/01-post1/", false},
+		{"slug", "/blog/2025/01-post1.md", FileMetadata{Date: date, Slug: "hello"}, "/blog/2025/03/hello/", false},
+		{"without date", "/docs/setup.md", FileMetadata{}, "/docs/setup", false},
+		{"missing date", "/blog/post.md", FileMetadata{}, "/blog/post", true},
+		{"section index", "/blog/index.md", FileMetadata{Date: date}, "/blog", false},
+		{"other section", "/about.md", FileMetadata{Date: date}, "/about", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.PageRoute(tt.route, tt.metadata)
+			if tt.err != (err != nil) || (err != nil && !errors.Is(err, ErrInvalidRoute)) {
+				t.Errorf("PageRoute(%s) returned error %v", tt.route, err)
+			}
+			if got != tt.expected {
+				t.Errorf("PageRoute(%s) = %s, expected %s", tt.route, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUrlPolicyValidate(t *testing.T) {
+	valid := UrlPolicy{Permalinks: map[string]string{"blog": "/blog/:year/:slug/"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() returned %v", err)
+	}
+
+	for _, permalinks := range []map[string]string{
+		{"blog": "blog/:slug"},
+		{"blog": "/blog/:title"},
+		{"blog/2025": "/blog/:slug"},
+	} {
+		policy := UrlPolicy{Permalinks: permalinks}
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Validate() accepted %v", permalinks)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch modes of the run command
+const (
+	WatchNotify = "notify" // inotify, FSEvents, etc. (default)
+	WatchPoll   = "poll"   // Scans the site at an interval, see NewPollingBackend
+	WatchOff    = "off"    // Changes are applied after a restart
+)
+
+// WatchBackend reports changes of the entries of watched directories, like
+// fsnotify does: a rename is reported as a Rename event of the old path,
+// followed by a Create event of the new path. Directories are not watched
+// recursively.
+type WatchBackend interface {
+	Name() string
+	Add(path string) error
+	Remove(path string) error
+	Close() error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+}
+
+// Returns the backend for a watch mode
+func NewWatchBackend(mode string, pollInterval time.Duration) (WatchBackend, error) {
+	switch mode {
+	case WatchNotify, "":
+		return NewNotifyBackend()
+	case WatchPoll:
+		return NewPollingBackend(pollInterval), nil
+	default:
+		return nil, fmt.Errorf("no file watcher backend for watch mode %q", mode)
+	}
+}
+
+// Backend using the notifications of the operating system
+type notifyBackend struct {
+	watcher *fsnotify.Watcher
+}
+
+func NewNotifyBackend() (WatchBackend, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fsnotify watcher: %w", err)
+	}
+	return &notifyBackend{watcher: watcher}, nil
+}
+
+func (b *notifyBackend) Name() string                  { return WatchNotify }
+func (b *notifyBackend) Add(path string) error         { return b.watcher.Add(path) }
+func (b *notifyBackend) Remove(path string) error      { return b.watcher.Remove(path) }
+func (b *notifyBackend) Close() error                  { return b.watcher.Close() }
+func (b *notifyBackend) Events() <-chan fsnotify.Event { return b.watcher.Events }
+func (b *notifyBackend) Errors() <-chan error          { return b.watcher.Errors }
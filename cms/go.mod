@@ -7,7 +7,14 @@ toolchain go1.24.3
 require github.com/gin-gonic/gin v1.7.4
 
 require (
-	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/andybalholm/brotli v1.2.6
+	github.com/tdewolff/minify/v2 v2.23.5
+	github.com/tdewolff/parse/v2 v2.8.0 // indirect
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/RoaringBitmap/roaring v0.4.23 // indirect
 	github.com/RoaringBitmap/roaring/v2 v2.4.5 // indirect
 	github.com/adrg/frontmatter v0.2.0 // indirect
@@ -51,6 +58,7 @@ require (
 	github.com/yuin/goldmark v1.7.12 // indirect
 	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc // indirect
 	go.etcd.io/bbolt v1.4.0 // indirect
+	golang.org/x/image v0.24.0
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
@@ -72,6 +80,6 @@ require (
 	github.com/modern-go/reflect2 v0.0.0-20180701023420-4b7aa43c6742 // indirect
 	github.com/ugorji/go/codec v1.1.7 // indirect
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
-	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
@@ -6,17 +6,22 @@ import (
 	"cms/plugins"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 )
 
 func initializeAndRunPlugins(ctx *core.Context) error {
 	fm := ctx.FileManager
 	pm := fm.GetPluginManager()
 	pm.RegisterPlugin(&plugins.BuiltinHtmlPlugin{Context: ctx})
-	pm.RegisterPlugin(&plugins.BuiltinTextPlugin{})
+	pm.RegisterPlugin(&plugins.BuiltinTextPlugin{Context: ctx})
 	pm.RegisterPlugin(plugins.NewMarkdownPlugin(ctx))
+	pm.RegisterPlugin(plugins.NewImagePlugin(ctx, ctx.Config.Plugins["builtin/image"]))
+	pm.RegisterPlugin(plugins.NewAssetsPlugin(ctx, ctx.Config.Plugins["builtin/assets"]))
+	pm.RegisterPlugin(&plugins.BuiltinThemePlugin{Context: ctx})
 
 	if params, exists := ctx.Config.Plugins["builtin/search"]; exists {
-		pm.RegisterPlugin(plugins.NewSearchPlugin(params))
+		pm.RegisterPlugin(plugins.NewSearchPlugin(ctx, params))
 	}
 
 	// Print all plugins including their priority
@@ -33,9 +38,26 @@ func initializeAndRunPlugins(ctx *core.Context) error {
 
 func initializeFileManager(ctx *core.Context) error {
 	fm := core.NewFileManager(ctx.Config.SiteDirectory)
+	fm.SetLanguages(ctx.Config.Languages)
+	fm.SetStreaming(ctx.Config.Streaming)
+	fm.SetWorkers(ctx.Config.Workers)
+
+	// Files which are not part of the site are skipped
+	err := fm.LoadIgnoreRules(ctx.Config.Ignore)
+	if err != nil {
+		return err
+	}
+
+	// Symlinks are skipped, unless the site follows them
+	if ctx.Config.FollowSymlinks {
+		err = fm.FollowSymlinks(ctx.Config.SymlinkRoots)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Load the entire "content" directory structure
-	err := fm.WalkDirectory("content")
+	err = fm.WalkDirectory("content")
 	if err != nil {
 		return err
 	}
@@ -46,6 +68,28 @@ func initializeFileManager(ctx *core.Context) error {
 		return err
 	}
 
+	// ... and the configuration files, which other files can depend on
+	err = fm.WalkDirectory("config")
+	if err != nil {
+		return err
+	}
+
+	// ... and the assets (if there are any)
+	if _, err := os.Stat(filepath.Join(ctx.Config.SiteDirectory, "assets")); err == nil {
+		err = fm.WalkDirectory("assets")
+		if err != nil {
+			return err
+		}
+	}
+
+	// ... and the data files (if there are any)
+	if _, err := os.Stat(filepath.Join(ctx.Config.SiteDirectory, "data")); err == nil {
+		err = fm.WalkDirectory("data")
+		if err != nil {
+			return err
+		}
+	}
+
 	ctx.FileManager = fm
 	return nil
 }
@@ -78,6 +122,12 @@ func main() {
 		log.Fatalf("Failed to initialize lookup index: %v", err)
 	}
 
+	// Static builds only process the files which changed since the last build
+	cache := core.OpenBuildCache(&ctx)
+	if cache != nil {
+		cache.Restore(ctx.FileManager)
+	}
+
 	// Initialize and run all builtin plugins
 	err = initializeAndRunPlugins(&ctx)
 	if err != nil {
@@ -88,7 +138,7 @@ func main() {
 	// This is used for testing (the directory can then be compared to
 	// a "golden" set of files, and any deviation is a bug)
 	if ctx.Config.Mode == "static" || ctx.Config.Mode == "dump" {
-		cmd.Dump(&ctx, ctx.Config.Mode == "dump")
+		cmd.Dump(&ctx, cache, ctx.Config.Mode == "dump")
 		return
 	}
 
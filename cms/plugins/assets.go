@@ -0,0 +1,286 @@
+package plugins
+
+import (
+	"cms/core"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// BuiltinAssetsPlugin serves the files in the assets directory. CSS and
+// JavaScript are minified, bundles from site.yaml are concatenated, and
+// every asset is also available under a fingerprinted name, e.g.
+// "/assets/site.3b5d5c3712955042.css", which changes with its content.
+type BuiltinAssetsPlugin struct {
+	Context  *core.Context
+	minifier *minify.M
+	minify   bool
+}
+
+// Supported parameters (in the "builtin/assets" section of site.yaml):
+//   - minify: "false" serves CSS and JavaScript unmodified
+func NewAssetsPlugin(ctx *core.Context, params map[string]string) *BuiltinAssetsPlugin {
+	minifier := minify.New()
+	minifier.AddFunc("text/css", css.Minify)
+	minifier.AddFunc("text/javascript", js.Minify)
+
+	p := &BuiltinAssetsPlugin{
+		Context:  ctx,
+		minifier: minifier,
+		minify:   true,
+	}
+	if value, err := strconv.ParseBool(params["minify"]); err == nil {
+		p.minify = value
+	}
+	return p
+}
+
+func (p *BuiltinAssetsPlugin) Name() string {
+	return "builtin/assets"
+}
+
+func (p *BuiltinAssetsPlugin) Priority() int {
+	return 100
+}
+
+func (p *BuiltinAssetsPlugin) CanProcess(file *core.File) bool {
+	return strings.HasPrefix(file.Path, "assets/")
+}
+
+func (p *BuiltinAssetsPlugin) Process(ctx *core.PluginContext) *core.PluginResult {
+	// CSS templates are served without the ".tmpl" suffix
+	name := strings.TrimSuffix(strings.TrimPrefix(ctx.File.Path, "assets/"), ".tmpl")
+
+	source, err := p.readSource(ctx.FileManager, ctx.File)
+	if err != nil {
+		return &core.PluginResult{
+			Success: false,
+			Error:   err,
+		}
+	}
+
+	hash := core.ContentHash(source)
+	content := p.minifyAsset(ctx.File.Path, name, source)
+
+	result := &core.PluginResult{
+		Success:     true,
+		Modified:    true,
+		NewContent:  content,
+		MimeType:    assetMimeType(name),
+		Routes:      []string{assetRoute(name)},
+		OutputFiles: map[string][]byte{fingerprintedRoute(name, hash): content},
+	}
+
+	// The first file of a bundle generates the bundle, and depends on
+	// all other files of the bundle
+	for _, bundle := range p.Context.Config.Assets.Bundles {
+		if path.Join("assets", bundle.Files[0]) != ctx.File.Path {
+			continue
+		}
+
+		bundleContent, sources, err := p.buildBundle(ctx.FileManager, bundle)
+		if err != nil {
+			return &core.PluginResult{
+				Success: false,
+				Error:   fmt.Errorf("failed to build bundle %s: %w", bundle.Name, err),
+			}
+		}
+
+		result.OutputFiles[assetRoute(bundle.Name)] = bundleContent
+		result.OutputFiles[fingerprintedRoute(bundle.Name, core.ContentHash(sources))] = bundleContent
+
+		for _, member := range bundle.Files[1:] {
+			if file := ctx.FileManager.GetFile(path.Join("assets", member)); file != nil {
+				result.Dependencies = append(result.Dependencies, file)
+			}
+		}
+	}
+
+	return result
+}
+
+// Returns the fingerprinted URL of an asset or a bundle (the name is relative
+// to the assets directory), and the file which generates it
+func (p *BuiltinAssetsPlugin) Resolve(fm *core.FileManager, name string) (string, *core.File, error) {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "/"), "assets/")
+
+	for _, bundle := range p.Context.Config.Assets.Bundles {
+		if bundle.Name != name {
+			continue
+		}
+
+		owner := fm.GetFile(path.Join("assets", bundle.Files[0]))
+		if owner == nil {
+			return "", nil, fmt.Errorf("file %s of bundle %s not found", bundle.Files[0], name)
+		}
+
+		var sources []byte
+		for _, member := range bundle.Files {
+			source, err := p.readBundleMember(fm, member)
+			if err != nil {
+				return "", nil, err
+			}
+			sources = append(sources, source...)
+		}
+		return fingerprintedRoute(name, core.ContentHash(sources)), owner, nil
+	}
+
+	// The asset is either a file or a CSS template
+	file := fm.GetFile(path.Join("assets", name))
+	if file == nil {
+		file = fm.GetFile(path.Join("assets", name+".tmpl"))
+	}
+	if file == nil || (strings.HasSuffix(file.Path, ".tmpl") && !isCssTemplate(file.Path)) {
+		return "", nil, fmt.Errorf("asset %s not found", name)
+	}
+
+	// Streamed files are too large to be hashed on every change
+	if fm.Streams(file) {
+		return assetRoute(name), file, nil
+	}
+
+	source, err := p.readSource(fm, file)
+	if err != nil {
+		return "", nil, err
+	}
+	return fingerprintedRoute(name, core.ContentHash(source)), file, nil
+}
+
+// Returns the source of an asset. CSS templates are rendered by the theme plugin.
+func (p *BuiltinAssetsPlugin) readSource(fm *core.FileManager, file *core.File) ([]byte, error) {
+	if isCssTemplate(file.Path) {
+		theme := lookupThemePlugin(fm)
+		if theme == nil {
+			return nil, fmt.Errorf("cannot render %s without the theme plugin", file.Path)
+		}
+		return theme.Render(fm, file)
+	}
+
+	source, err := os.ReadFile(file.DiskPath(fm.SiteDirectory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset %s: %w", file.Path, err)
+	}
+	return source, nil
+}
+
+// Returns the source of a file of a bundle
+func (p *BuiltinAssetsPlugin) readBundleMember(fm *core.FileManager, member string) ([]byte, error) {
+	file := fm.GetFile(path.Join("assets", member))
+	if file == nil {
+		return nil, fmt.Errorf("file %s not found", member)
+	}
+	return p.readSource(fm, file)
+}
+
+// Concatenates and minifies the files of a bundle. Also returns the
+// concatenated sources, which are used for the fingerprint.
+func (p *BuiltinAssetsPlugin) buildBundle(fm *core.FileManager, bundle core.AssetBundle) ([]byte, []byte, error) {
+	var content, sources []byte
+	for _, member := range bundle.Files {
+		source, err := p.readBundleMember(fm, member)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source...)
+
+		minified := p.minifyAsset(path.Join("assets", member), strings.TrimSuffix(member, ".tmpl"), source)
+
+		if len(content) > 0 {
+			// Statements in JavaScript files are not always terminated
+			if strings.HasSuffix(bundle.Name, ".js") {
+				content = append(content, ';')
+			}
+			content = append(content, '\n')
+		}
+		content = append(content, minified...)
+	}
+	return content, sources, nil
+}
+
+// Minifies CSS and JavaScript; all other files are returned unmodified, and
+// so are files which cannot be minified (e.g. with syntax errors). The
+// minifier modifies its input, therefore it works on a copy.
+func (p *BuiltinAssetsPlugin) minifyAsset(filePath, name string, source []byte) []byte {
+	if !p.minify {
+		return source
+	}
+
+	var mimeType string
+	switch strings.ToLower(path.Ext(name)) {
+	case ".css":
+		mimeType = "text/css"
+	case ".js", ".mjs":
+		mimeType = "text/javascript"
+	default:
+		return source
+	}
+
+	minified, err := p.minifier.Bytes(mimeType, slices.Clone(source))
+	if err != nil {
+		log.Printf("Failed to minify %s, serving it unmodified: %v", filePath, err)
+		return source
+	}
+	return minified
+}
+
+// Returns the route of an asset, e.g. "/assets/site.css"
+func assetRoute(name string) string {
+	return path.Join("/assets", name)
+}
+
+// Returns the fingerprinted route of an asset, e.g. "/assets/site.3b5d5c3712955042.css"
+func fingerprintedRoute(name, hash string) string {
+	ext := path.Ext(name)
+	return assetRoute(strings.TrimSuffix(name, ext) + "." + hash + ext)
+}
+
+func assetMimeType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	switch ext {
+	case ".js", ".mjs":
+		return "text/javascript; charset=utf-8"
+	case ".webmanifest":
+		return "application/manifest+json"
+	}
+
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// Returns the registered assets plugin, or nil
+func lookupAssetsPlugin(ctx *core.PluginContext) *BuiltinAssetsPlugin {
+	if ctx.FileManager == nil {
+		return nil
+	}
+	plugin, _ := ctx.FileManager.GetPluginManager().GetPlugin("builtin/assets").(*BuiltinAssetsPlugin)
+	return plugin
+}
+
+// Returns the fingerprinted URL of an asset, and adds the asset to the
+// dependencies of the page. URLs outside of /assets are returned unmodified.
+func assetUrl(ctx *core.PluginContext, result *core.PluginResult, url string) string {
+	plugin := lookupAssetsPlugin(ctx)
+	if plugin == nil || !strings.HasPrefix(url, "/assets/") {
+		return url
+	}
+
+	fingerprinted, file, err := plugin.Resolve(ctx.FileManager, url)
+	if err != nil {
+		log.Printf("Failed to resolve asset %s in %s: %v", url, ctx.File.Path, err)
+		return url
+	}
+
+	result.Dependencies = append(result.Dependencies, file)
+	return fingerprinted
+}
@@ -0,0 +1,134 @@
+package plugins
+
+import (
+	"cms/core"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a site with the given assets, and returns its FileManager and
+// assets plugin
+func newAssetsSite(t *testing.T, assets map[string]string, bundles ...core.AssetBundle) (*core.FileManager, *BuiltinAssetsPlugin) {
+	t.Helper()
+	siteDir := t.TempDir()
+	fm := core.NewFileManager(siteDir)
+	for name, content := range assets {
+		diskPath := filepath.Join(siteDir, "assets", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(diskPath), 0755))
+		require.NoError(t, os.WriteFile(diskPath, []byte(content), 0644))
+	}
+	require.NoError(t, fm.WalkDirectory("assets"))
+
+	ctx := &core.Context{}
+	ctx.Config.Assets.Bundles = bundles
+	plugin := NewAssetsPlugin(ctx, nil)
+	fm.GetPluginManager().RegisterPlugin(plugin)
+	return fm, plugin
+}
+
+func processAsset(t *testing.T, fm *core.FileManager, plugin *BuiltinAssetsPlugin, name string) *core.PluginResult {
+	t.Helper()
+	file := fm.GetFile("assets/" + name)
+	require.NotNil(t, file)
+	result := plugin.Process(&core.PluginContext{File: file, FileManager: fm, SiteDirectory: fm.SiteDirectory})
+	require.True(t, result.Success, "%v", result.Error)
+	return result
+}
+
+func TestAssetsMinify(t *testing.T) {
+	fm, plugin := newAssetsSite(t, map[string]string{
+		"site.css":  "body {\n  color : red ;\n}\n",
+		"app.js":    "var answer = 40 + 2;\n",
+		"broken.js": "var = ;\n",
+		"notes.txt": "some  text\n",
+	})
+
+	tests := []struct {
+		name     string
+		expected string
+		mimeType string
+	}{
+		{"site.css", "body{color:red}", "text/css; charset=utf-8"},
+		{"app.js", "var answer=40+2", "text/javascript; charset=utf-8"},
+		{"broken.js", "var = ;\n", "text/javascript; charset=utf-8"}, // served unmodified
+		{"notes.txt", "some  text\n", "text/plain; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := processAsset(t, fm, plugin, test.name)
+			assert.Equal(t, test.expected, string(result.NewContent))
+			assert.Equal(t, test.mimeType, result.MimeType)
+			assert.Equal(t, []string{"/assets/" + test.name}, result.Routes)
+
+			// The fingerprinted file has the same content
+			fingerprinted, _, err := plugin.Resolve(fm, test.name)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(result.OutputFiles[fingerprinted]))
+		})
+	}
+}
+
+func TestAssetsBundle(t *testing.T) {
+	fm, plugin := newAssetsSite(t, map[string]string{
+		"vendor/lib.js": "function lib() { return 1 }",
+		"app/main.js":   "lib()",
+		"a.css":         "a { color: red }",
+		"b.css":         "b { color: blue }",
+	},
+		core.AssetBundle{Name: "app.js", Files: []string{"vendor/lib.js", "app/main.js"}},
+		core.AssetBundle{Name: "site.css", Files: []string{"b.css", "a.css"}},
+	)
+
+	// The bundles are generated by their first file, in the order of the files
+	result := processAsset(t, fm, plugin, "vendor/lib.js")
+	assert.Equal(t, "function lib(){return 1};\nlib()", string(result.OutputFiles["/assets/app.js"]))
+	require.Len(t, result.Dependencies, 1)
+	assert.Equal(t, "assets/app/main.js", result.Dependencies[0].Path)
+
+	fingerprinted, owner, err := plugin.Resolve(fm, "/assets/app.js")
+	require.NoError(t, err)
+	assert.Equal(t, "assets/vendor/lib.js", owner.Path)
+	assert.Equal(t, result.OutputFiles["/assets/app.js"], result.OutputFiles[fingerprinted])
+
+	result = processAsset(t, fm, plugin, "b.css")
+	assert.Equal(t, "b{color:blue}\na{color:red}", string(result.OutputFiles["/assets/site.css"]))
+
+	// Other files of a bundle do not generate it
+	result = processAsset(t, fm, plugin, "a.css")
+	assert.NotContains(t, result.OutputFiles, "/assets/site.css")
+}
+
+func TestAssetsResolve(t *testing.T) {
+	fm, plugin := newAssetsSite(t, map[string]string{
+		"site.css": "body { color: red }",
+		"lib.js":   "var a = 1",
+		"main.js":  "var b = 2",
+	}, core.AssetBundle{Name: "app.js", Files: []string{"lib.js", "main.js"}})
+
+	resolve := func(name string) string {
+		t.Helper()
+		route, _, err := plugin.Resolve(fm, name)
+		require.NoError(t, err)
+		return route
+	}
+
+	css := resolve("site.css")
+	assert.Regexp(t, `^/assets/site\.[0-9a-f]+\.css$`, css)
+	assert.Equal(t, css, resolve("/assets/site.css"))
+	bundle := resolve("app.js")
+	assert.Regexp(t, `^/assets/app\.[0-9a-f]+\.js$`, bundle)
+
+	// The fingerprints change with the content, also of a bundle's other files
+	require.NoError(t, os.WriteFile(filepath.Join(fm.SiteDirectory, "assets/site.css"), []byte("body { color: blue }"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(fm.SiteDirectory, "assets/main.js"), []byte("var b = 3"), 0644))
+	assert.NotEqual(t, css, resolve("site.css"))
+	assert.NotEqual(t, bundle, resolve("app.js"))
+
+	_, _, err := plugin.Resolve(fm, "missing.css")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package plugins
+
+import (
+	"cms/core"
+	"regexp"
+	"strings"
+)
+
+// References to data files in templates, e.g. ".Site.Data.products"
+var dataReferencePattern = regexp.MustCompile(`\.Site\.Data(\.[A-Za-z_][A-Za-z0-9_]*)?`)
+
+// Returns the data files which are referenced in a template, keyed by their
+// names, and adds them to the dependencies of the page. Only referenced
+// files are loaded, so that a modified data file re-renders only the pages
+// which read it. If the template uses .Site.Data without a name (e.g. with
+// "range" or "index") then all data files are loaded.
+func buildSiteData(ctx *core.PluginContext, result *core.PluginResult, source []byte) map[string]any {
+	data := make(map[string]any)
+	if ctx.FileManager == nil {
+		return data
+	}
+
+	var names []string
+	for _, match := range dataReferencePattern.FindAllSubmatch(source, -1) {
+		name := strings.TrimPrefix(string(match[1]), ".")
+		if name == "" {
+			all, files := ctx.FileManager.LoadData("")
+			result.Dependencies = append(result.Dependencies, files...)
+			if all, ok := all.(map[string]any); ok {
+				return all
+			}
+			return data
+		}
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if _, loaded := data[name]; loaded {
+			continue
+		}
+
+		value, files := ctx.FileManager.LoadData(name)
+		result.Dependencies = append(result.Dependencies, files...)
+		if value != nil {
+			data[name] = value
+		}
+	}
+	return data
+}
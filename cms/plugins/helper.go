@@ -2,16 +2,26 @@ package plugins
 
 import (
 	"cms/core"
+	"fmt"
 	"html/template"
 	"log"
 	"os"
-	"path/filepath"
+	"path"
 	"slices"
+	"sort"
 	"strings"
 )
 
-func ApplyTemplate(body []byte, file *core.File, vars *map[string]interface{}) ([]byte, error) {
-	tmpl, err := template.New(file.Path).Parse(string(body))
+// Translation is a link to another language version of the current page
+type Translation struct {
+	Language  string
+	Name      string
+	Url       string
+	IsCurrent bool
+}
+
+func ApplyTemplate(body []byte, file *core.File, vars *map[string]interface{}, funcs template.FuncMap) ([]byte, error) {
+	tmpl, err := template.New(file.Path).Funcs(funcs).Parse(string(body))
 	if err != nil {
 		log.Printf("failed to parse template for %s: %s", file.Path, err)
 		return nil, err
@@ -27,6 +37,177 @@ func ApplyTemplate(body []byte, file *core.File, vars *map[string]interface{}) (
 	return []byte(output.String()), nil
 }
 
+// Returns the functions which are available in templates:
+//   - asset "site.css" returns the fingerprinted URL of an asset or a bundle
+func templateFuncs(ctx *core.PluginContext, result *core.PluginResult) template.FuncMap {
+	return template.FuncMap{
+		"asset": func(name string) string {
+			return assetUrl(ctx, result, path.Join("/assets", name))
+		},
+	}
+}
+
+// Replaces the URLs of assets in the template variables with their
+// fingerprinted URLs
+func fingerprintTemplateVars(ctx *core.PluginContext, result *core.PluginResult, vars map[string]any) {
+	for _, key := range []string{"BrandingFavicon", "BrandingCssFile", "PageCssFile"} {
+		if url, ok := vars[key].(string); ok && url != "" {
+			vars[key] = assetUrl(ctx, result, url)
+		}
+	}
+}
+
+// Returns the configuration files which the template variables of a page
+// are built from, so that the page is rendered again when they change
+func configDependencies(ctx *core.PluginContext) []*core.File {
+	paths := []string{"config/site.yaml", "config/users.yaml", "config/navigation.yaml"}
+	if ctx.File.Language != "" {
+		paths = append(paths, "config/navigation."+ctx.File.Language+".yaml")
+	}
+
+	var files []*core.File
+	for _, path := range paths {
+		if file := ctx.FileManager.GetFile(path); file != nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Returns the route of a content file, including the language prefix,
+// e.g. "content/de/about.md" becomes "/de/about.md"
+func contentRoute(ctx *core.Context, file *core.File) string {
+	return languageRoute(ctx, file, translationRoute(file))
+}
+
+// Returns the route of a content file without the language prefix
+func translationRoute(file *core.File) string {
+	key := file.TranslationKey
+	if key == "" {
+		key = file.Path
+	}
+
+	route := strings.TrimPrefix(key, "content/")
+	return path.Clean("/" + strings.TrimLeft(route, "/"))
+}
+
+// Adds the prefix of the file's language to a route
+func languageRoute(ctx *core.Context, file *core.File, route string) string {
+	if ctx == nil {
+		return route
+	}
+	prefix := ctx.Config.Languages.RoutePrefix(file.Language)
+	if prefix == "" {
+		return route
+	}
+	if route == "/" {
+		// The start page of a language, e.g. "/de"
+		return ctx.Config.Urls.Canonical(prefix)
+	}
+	if strings.HasSuffix(route, "/") {
+		return strings.TrimSuffix(path.Join(prefix, route), "/") + "/"
+	}
+	return path.Join(prefix, route)
+}
+
+// A page has a single route, its canonical URL according to the URL policy
+// in site.yaml, e.g. "/about" for "content/about.md" and "/" for
+// "content/index.html". The router redirects all other URLs of the page.
+func pageRoutes(ctx *core.Context, file *core.File) []string {
+	return []string{pageUrl(ctx, file)}
+}
+
+// Returns the route that is used when linking to a page: the "url" from its
+// frontmatter as it is, or the route from the permalink pattern of its
+// section, with the language prefix
+func pageUrl(ctx *core.Context, file *core.File) string {
+	return metadataUrl(ctx, file, file.Metadata)
+}
+
+// Returns the route of a translation of a page. The translation may not be
+// processed yet, so the route is built from the frontmatter which was read
+// when the file was added.
+func translationUrl(ctx *core.Context, file *core.File) string {
+	return metadataUrl(ctx, file, file.Frontmatter)
+}
+
+// Returns the route of a page with the given metadata, see pageUrl
+func metadataUrl(ctx *core.Context, file *core.File, metadata core.FileMetadata) string {
+	if metadata.Url != "" {
+		return "/" + strings.TrimLeft(metadata.Url, "/")
+	}
+
+	var policy core.UrlPolicy
+	if ctx != nil {
+		policy = ctx.Config.Urls
+	}
+	route, err := policy.PageRoute(translationRoute(file), metadata)
+	if err != nil {
+		log.Printf("Warning: %s: %v", file.Path, err)
+	}
+	return languageRoute(ctx, file, route)
+}
+
+// Returns the absolute URL of a route if the hostname is configured in
+// site.yaml, otherwise the route itself
+func permalink(ctx *core.Context, route string) string {
+	if ctx.Config.Server.Hostname == "" {
+		return route
+	}
+	return "https://" + ctx.Config.Server.Hostname + route
+}
+
+// Returns links to all language versions of a file, in the order of the
+// languages in site.yaml
+func buildTranslations(ctx *core.Context, file *core.File) []Translation {
+	languages := &ctx.Config.Languages
+	if !languages.IsMultilingual() || ctx.FileManager == nil {
+		return nil
+	}
+
+	var translations []Translation
+	for _, other := range ctx.FileManager.GetTranslations(file) {
+		lang := languages.Get(other.Language)
+		if lang == nil {
+			continue
+		}
+		translations = append(translations, Translation{
+			Language:  lang.Code,
+			Name:      lang.Name,
+			Url:       translationUrl(ctx, other),
+			IsCurrent: other.Language == file.Language,
+		})
+	}
+
+	order := func(code string) int {
+		return slices.IndexFunc(languages.Available, func(l core.Language) bool {
+			return l.Code == code
+		})
+	}
+	sort.Slice(translations, func(i, j int) bool {
+		return order(translations[i].Language) < order(translations[j].Language)
+	})
+	return translations
+}
+
+// Returns the <link rel="alternate" hreflang="..."> tags for a page
+func buildHreflangTags(ctx *core.Context, translations []Translation) template.HTML {
+	if len(translations) < 2 {
+		return ""
+	}
+
+	var builder strings.Builder
+	for _, t := range translations {
+		builder.WriteString(fmt.Sprintf("<link rel=\"alternate\" hreflang=\"%s\" href=\"%s\">\n",
+			template.HTMLEscapeString(t.Language), template.HTMLEscapeString(t.Url)))
+		if t.Language == ctx.Config.Languages.DefaultCode() {
+			builder.WriteString(fmt.Sprintf("<link rel=\"alternate\" hreflang=\"x-default\" href=\"%s\">\n",
+				template.HTMLEscapeString(t.Url)))
+		}
+	}
+	return template.HTML(builder.String())
+}
+
 func BuildTemplateVars(ctx *core.Context, file *core.File, routes []string) map[string]any {
 	vars := map[string]any{
 		"SiteTitle":        ctx.Config.Server.Title,
@@ -39,11 +220,18 @@ func BuildTemplateVars(ctx *core.Context, file *core.File, routes []string) map[
 		"PageTags":         file.Metadata.Tags,
 		"PageCssFile":      file.Metadata.CssFile,
 		"PageMimeType":     file.Metadata.MimeType,
+		"Language":         file.Language,
+		"Permalink":        permalink(ctx, pageUrl(ctx, file)),
 	}
 
+	// Links to the other language versions of this page
+	translations := buildTranslations(ctx, file)
+	vars["Translations"] = translations
+	vars["HreflangTags"] = buildHreflangTags(ctx, translations)
+
 	// Date of last modTime is either specified in the metadata or is fetched from the file system
 	if file.Metadata.DateOfLastUpdate.IsZero() {
-		info, err := os.Stat(filepath.Join(ctx.Config.SiteDirectory, file.Path))
+		info, err := os.Stat(file.DiskPath(ctx.Config.SiteDirectory))
 		if err != nil {
 			log.Printf("failed to get file info for %s: %s", file.Path, err)
 		} else {
@@ -61,11 +249,13 @@ func BuildTemplateVars(ctx *core.Context, file *core.File, routes []string) map[
 	}
 
 	// Go through all NavigationItems. If their URL matches the current file's URL,
-	// then set the "active" variable to true.
-	nav := ctx.Navigation
+	// then set the "active" variable to true. The items are copied because the
+	// navigation is shared by all pages.
+	nav := ctx.NavigationFor(file.Language)
+	nav.Children = slices.Clone(nav.Children)
 	for i, item := range nav.Children {
-		lcurl := strings.ToLower(item.Url)
-		item.IsActive = slices.Contains(routes, lcurl)
+		item.IsActive = strings.HasPrefix(item.Url, "/") &&
+			(slices.Contains(routes, item.Url) || slices.Contains(routes, ctx.Config.Urls.Canonical(item.Url)))
 		nav.Children[i] = item
 	}
 	vars["Navigation"] = nav
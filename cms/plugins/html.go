@@ -2,10 +2,8 @@ package plugins
 
 import (
 	"cms/core"
-	"fmt"
 	"log"
-	"path"
-	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/adrg/frontmatter"
@@ -39,15 +37,6 @@ func (p *BuiltinHtmlPlugin) Process(ctx *core.PluginContext) *core.PluginResult
 	log.Printf("START Processing html file: %s\n", ctx.File.Path)
 	defer log.Printf("END   Processing html file: %s\n", ctx.File.Path)
 
-	// Don't attempt to read a file if it is only a redirection
-	if ctx.File.Metadata.RedirectUrl != "" {
-		log.Printf("Error: RedirectUrl should not be set for HTML files: %s", ctx.File.Path)
-		return &core.PluginResult{
-			Success: false,
-			Error:   fmt.Errorf("RedirectUrl should not be set for HTML files"),
-		}
-	}
-
 	// Read file content
 	content = ctx.File.ReadFile(ctx.SiteDirectory)
 	if content == nil {
@@ -56,14 +45,31 @@ func (p *BuiltinHtmlPlugin) Process(ctx *core.PluginContext) *core.PluginResult
 		}
 	}
 
-	// Parse (and skip) frontmatter metadata
+	// Parse (and skip) frontmatter metadata. The metadata of the previous
+	// version is discarded, otherwise removed keys would persist.
+	ctx.File.Metadata = core.FileMetadata{}
 	rest, err := frontmatter.Parse(strings.NewReader(string(content)), &ctx.File.Metadata)
 	if err == nil {
 		content = rest
 	}
 
+	// Pages which only redirect are not rendered. The server redirects, and
+	// static sites get a page which redirects in the browser.
+	if ctx.File.Metadata.RedirectUrl != "" {
+		return &core.PluginResult{
+			Success:    true,
+			Modified:   true,
+			NewContent: core.RedirectStub(ctx.File.Metadata.RedirectUrl),
+			MimeType:   "text/html",
+			Routes:     pageRoutes(p.Context, ctx.File),
+		}
+	}
+
 	var result core.PluginResult
 
+	// Replace the image shortcodes
+	content, shortcodes := replaceImageShortcodes(ctx, content, &result)
+
 	// fetch the dependency files (header, footer) unless the layout is ignored
 	if !ctx.File.Metadata.IgnoreLayout {
 		header := ctx.FileManager.GetFile("layout/header.html")
@@ -74,49 +80,33 @@ func (p *BuiltinHtmlPlugin) Process(ctx *core.PluginContext) *core.PluginResult
 			}
 		}
 
-		if header.Content == nil {
-			header.Content = header.ReadFile(ctx.SiteDirectory)
-		}
-		if footer.Content == nil {
-			footer.Content = footer.ReadFile(ctx.SiteDirectory)
-		}
-		if header.Content == nil || footer.Content == nil {
+		headerContent := ctx.FileManager.ReadContent(header)
+		footerContent := ctx.FileManager.ReadContent(footer)
+		if headerContent == nil || footerContent == nil {
 			return &core.PluginResult{
 				Success: false,
 			}
 		}
 
-		result.Dependencies = []*core.File{header, footer}
+		result.Dependencies = append(result.Dependencies, header, footer)
 
-		body = append(header.Content, content...)
-		body = append(body, footer.Content...)
+		body = slices.Concat(headerContent, content, footerContent)
 	} else {
 		// If the layout is ignored, we still need to read the file content
 		body = content
 	}
 
-	// A html file has two routes: the path itself (without "/content") and the path without
-	// the extension (e.g. "/about.html" becomes "/about")
-	// If this file is an index page then we also add the directory name as a route
-	route := strings.TrimPrefix(ctx.File.Path, "content/")
-	route = "/" + strings.TrimLeft(route, "/")
-	route = path.Clean(route)
-	result.Routes = []string{route,
-		strings.TrimSuffix(route, filepath.Ext(route))}
-	if filepath.Base(route) == "index.html" {
-		// If this is an index page, add the directory name as a route
-		dir := filepath.Dir(route)
-		if dir == "." {
-			dir = "/"
-		}
-		result.Routes = append(result.Routes, dir)
-	}
+	result.Routes = pageRoutes(p.Context, ctx.File)
 
 	// Build the map with the template variables
 	vars := BuildTemplateVars(p.Context, ctx.File, result.Routes)
+	result.Dependencies = append(result.Dependencies, configDependencies(ctx)...)
+	vars["Images"] = buildFrontmatterImages(ctx, &result)
+	vars["Site"] = map[string]any{"Data": buildSiteData(ctx, &result, body)}
+	fingerprintTemplateVars(ctx, &result, vars)
 
 	// Apply the template to the different files
-	body, err = ApplyTemplate(body, ctx.File, &vars)
+	body, err = ApplyTemplate(body, ctx.File, &vars, templateFuncs(ctx, &result))
 	if err != nil {
 		log.Printf("failed to apply template for %s: %s", ctx.File.Path, err)
 		return &core.PluginResult{
@@ -126,7 +116,7 @@ func (p *BuiltinHtmlPlugin) Process(ctx *core.PluginContext) *core.PluginResult
 
 	result.Success = true
 	result.Modified = true
-	result.NewContent = body
+	result.NewContent = shortcodes.restore(body)
 	result.MimeType = "text/html"
 	return &result
 
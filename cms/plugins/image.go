@@ -0,0 +1,699 @@
+package plugins
+
+import (
+	"bytes"
+	"cms/core"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ResponsiveImage describes an image with its resized variants. Html holds the
+// <picture> markup, all other fields can be used to build custom markup.
+type ResponsiveImage struct {
+	Src        string // Route of the original image
+	Alt        string
+	Sizes      string
+	Width      int
+	Height     int
+	Srcset     string // Variants in the format of the original
+	WebpSrcset string // WebP variants
+	Html       template.HTML
+}
+
+type BuiltinImagePlugin struct {
+	Context  *core.Context
+	widths   []int  // default widths of the variants
+	sizes    string // default "sizes" attribute
+	quality  int    // JPEG quality
+	webp     string // generate WebP variants: "auto", "true" or "false"
+	cacheDir string // optional directory for caching variants on disk
+
+	mu      sync.Mutex
+	cache   map[string][]byte // variants, keyed by source hash, width and format
+	sources map[string]string // path of an image -> hash of its current content
+}
+
+// Supported parameters (in the "builtin/image" section of site.yaml):
+//   - widths: default widths of the variants, e.g. "480,960,1440"
+//   - sizes: default "sizes" attribute, e.g. "(max-width: 960px) 100vw, 960px"
+//   - quality: JPEG quality (1-100)
+//   - webp: "true" or "false"; by default WebP variants are only generated for
+//     PNG images, because the WebP encoder is lossless and would produce larger
+//     files than JPEG for photos
+//   - cache-dir: directory for caching the variants across restarts
+func NewImagePlugin(ctx *core.Context, params map[string]string) *BuiltinImagePlugin {
+	p := &BuiltinImagePlugin{
+		Context:  ctx,
+		widths:   []int{480, 960, 1440},
+		sizes:    "100vw",
+		quality:  85,
+		webp:     "auto",
+		cacheDir: params["cache-dir"],
+		cache:    make(map[string][]byte),
+		sources:  make(map[string]string),
+	}
+
+	if widths := parseWidths(params["widths"]); len(widths) > 0 {
+		p.widths = widths
+	}
+	if sizes := params["sizes"]; sizes != "" {
+		p.sizes = sizes
+	}
+	if quality, err := strconv.Atoi(params["quality"]); err == nil && quality > 0 && quality <= 100 {
+		p.quality = quality
+	}
+	if webp, err := strconv.ParseBool(params["webp"]); err == nil {
+		p.webp = strconv.FormatBool(webp)
+	}
+
+	if p.cacheDir != "" {
+		if err := os.MkdirAll(p.cacheDir, 0755); err != nil {
+			log.Printf("Failed to create image cache directory %s: %v", p.cacheDir, err)
+			p.cacheDir = ""
+		}
+	}
+
+	return p
+}
+
+func (p *BuiltinImagePlugin) Name() string {
+	return "builtin/image"
+}
+
+func (p *BuiltinImagePlugin) Priority() int {
+	return 100
+}
+
+func (p *BuiltinImagePlugin) CanProcess(file *core.File) bool {
+	if !strings.HasPrefix(file.Path, "content/") {
+		return false
+	}
+	return imageMimeType(file.Name) != ""
+}
+
+// Serves the original image, without EXIF and other metadata
+func (p *BuiltinImagePlugin) Process(ctx *core.PluginContext) *core.PluginResult {
+	content := ctx.File.ReadFile(ctx.SiteDirectory)
+	if content == nil {
+		return &core.PluginResult{
+			Success: false,
+		}
+	}
+
+	mimeType := imageMimeType(ctx.File.Name)
+	switch mimeType {
+	case "image/jpeg":
+		// Rotated photos are stored with an EXIF orientation, which is lost
+		// when stripping the metadata. Re-encode them with the rotation applied.
+		if orientation := jpegOrientation(content); orientation > 1 {
+			img, _, err := image.Decode(bytes.NewReader(content))
+			if err != nil {
+				return &core.PluginResult{
+					Success: false,
+					Error:   fmt.Errorf("failed to decode image %s: %w", ctx.File.Path, err),
+				}
+			}
+			content, err = p.encode(applyOrientation(img, orientation), ".jpg")
+			if err != nil {
+				return &core.PluginResult{
+					Success: false,
+					Error:   fmt.Errorf("failed to encode image %s: %w", ctx.File.Path, err),
+				}
+			}
+		} else {
+			content = stripJPEGMetadata(content)
+		}
+	case "image/png":
+		content = stripPNGMetadata(content)
+	}
+
+	return &core.PluginResult{
+		Success:    true,
+		Modified:   true,
+		NewContent: content,
+		MimeType:   mimeType,
+		Routes:     []string{contentRoute(p.Context, ctx.File)},
+	}
+}
+
+// Generates the variants of an image which is referenced by a page. The variants
+// are added to the page's output files, and the page depends on the image.
+// Variants are never larger than the original image.
+func (p *BuiltinImagePlugin) Responsive(ctx *core.PluginContext, spec core.ImageMetadata,
+	result *core.PluginResult) (*ResponsiveImage, error) {
+	imageFile := resolveImage(ctx, spec.Src)
+	if imageFile == nil {
+		return nil, fmt.Errorf("image %s not found", spec.Src)
+	}
+	result.Dependencies = append(result.Dependencies, imageFile)
+
+	content := imageFile.ReadFile(ctx.SiteDirectory)
+	if content == nil {
+		return nil, fmt.Errorf("failed to read image %s", imageFile.Path)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", imageFile.Path, err)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(content)
+	}
+	width, height := config.Width, config.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+
+	route := contentRoute(p.Context, imageFile)
+	responsive := &ResponsiveImage{
+		Src:    route,
+		Alt:    spec.Alt,
+		Sizes:  spec.Sizes,
+		Width:  width,
+		Height: height,
+	}
+	if responsive.Sizes == "" {
+		responsive.Sizes = p.sizes
+	}
+
+	widths := slices.Compact(slices.Sorted(slices.Values(spec.Widths)))
+	if len(widths) == 0 {
+		widths = p.widths
+	}
+
+	// Animations would be lost when resizing GIFs
+	if format == "gif" {
+		widths = nil
+	}
+
+	// The variants use the format of the original, except for formats
+	// which cannot be encoded
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+
+	hash := p.sourceHash(imageFile.Path, content)
+	base := strings.TrimSuffix(route, path.Ext(route))
+
+	var img image.Image
+	var srcset, webpSrcset []string
+	for _, w := range widths {
+		if w <= 0 || w >= width {
+			continue
+		}
+
+		formats := []string{ext}
+		if p.webp == "true" || (p.webp == "auto" && format == "png") {
+			formats = append(formats, ".webp")
+		}
+
+		for _, variantExt := range formats {
+			key := fmt.Sprintf("%s-%dw%s", hash, w, variantExt)
+			data := p.lookup(key)
+			if data == nil {
+				// Decode the original only if a variant is not cached
+				if img == nil {
+					img, _, err = image.Decode(bytes.NewReader(content))
+					if err != nil {
+						return nil, fmt.Errorf("failed to decode image %s: %w", imageFile.Path, err)
+					}
+				}
+
+				data, err = p.encode(resize(img, orientation, w, height*w/width), variantExt)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encode variant of %s: %w", imageFile.Path, err)
+				}
+				p.store(key, data)
+			}
+
+			variantRoute := fmt.Sprintf("%s-%dw%s", base, w, variantExt)
+			if result.OutputFiles == nil {
+				result.OutputFiles = make(map[string][]byte)
+			}
+			result.OutputFiles[variantRoute] = data
+
+			candidate := fmt.Sprintf("%s %dw", variantRoute, w)
+			if variantExt == ".webp" {
+				webpSrcset = append(webpSrcset, candidate)
+			} else {
+				srcset = append(srcset, candidate)
+			}
+		}
+	}
+
+	// The original is the largest candidate
+	if len(srcset) > 0 {
+		srcset = append(srcset, fmt.Sprintf("%s %dw", route, width))
+	}
+
+	responsive.Srcset = strings.Join(srcset, ", ")
+	responsive.WebpSrcset = strings.Join(webpSrcset, ", ")
+	responsive.Html = responsive.markup()
+	return responsive, nil
+}
+
+// Builds the <picture> markup of an image
+func (r *ResponsiveImage) markup() template.HTML {
+	escape := template.HTMLEscapeString
+
+	img := fmt.Sprintf("<img src=\"%s\" alt=\"%s\"", escape(r.Src), escape(r.Alt))
+	if r.Width > 0 && r.Height > 0 {
+		img += fmt.Sprintf(" width=\"%d\" height=\"%d\"", r.Width, r.Height)
+	}
+	if r.Srcset == "" {
+		return template.HTML(img + " loading=\"lazy\">")
+	}
+	img += fmt.Sprintf(" srcset=\"%s\" sizes=\"%s\" loading=\"lazy\">", escape(r.Srcset), escape(r.Sizes))
+
+	var builder strings.Builder
+	builder.WriteString("<picture>")
+	if r.WebpSrcset != "" {
+		builder.WriteString(fmt.Sprintf("<source type=\"image/webp\" srcset=\"%s\" sizes=\"%s\">",
+			escape(r.WebpSrcset), escape(r.Sizes)))
+	}
+	builder.WriteString(img)
+	builder.WriteString("</picture>")
+	return template.HTML(builder.String())
+}
+
+// Returns the hash of an image, and drops the cached variants of previous
+// versions of the image
+func (p *BuiltinImagePlugin) sourceHash(filePath string, content []byte) string {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:8])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if previous, exists := p.sources[filePath]; exists && previous != hash {
+		for key := range p.cache {
+			if strings.HasPrefix(key, previous+"-") {
+				delete(p.cache, key)
+			}
+		}
+	}
+	p.sources[filePath] = hash
+	return hash
+}
+
+// Returns a cached variant, or nil
+func (p *BuiltinImagePlugin) lookup(key string) []byte {
+	p.mu.Lock()
+	data, exists := p.cache[key]
+	p.mu.Unlock()
+	if exists {
+		return data
+	}
+
+	if p.cacheDir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.cacheDir, key))
+	if err != nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.cache[key] = data
+	p.mu.Unlock()
+	return data
+}
+
+// Stores a variant in the cache
+func (p *BuiltinImagePlugin) store(key string, data []byte) {
+	p.mu.Lock()
+	p.cache[key] = data
+	p.mu.Unlock()
+
+	if p.cacheDir != "" {
+		if err := os.WriteFile(filepath.Join(p.cacheDir, key), data, 0644); err != nil {
+			log.Printf("Failed to write image cache %s: %v", key, err)
+		}
+	}
+}
+
+// Encodes an image; the format depends on the file extension. The encoders
+// do not write any metadata.
+func (p *BuiltinImagePlugin) encode(img image.Image, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch ext {
+	case ".jpg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.quality})
+	case ".webp":
+		// The pure Go encoder only supports lossless WebP
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Finds the image file referenced by a page. Relative paths are resolved
+// against the page's directory; for translated pages the directory of the
+// untranslated page is also checked.
+func resolveImage(ctx *core.PluginContext, src string) *core.File {
+	if src == "" || strings.Contains(src, "://") {
+		return nil
+	}
+
+	var candidates []string
+	if strings.HasPrefix(src, "/") {
+		candidates = append(candidates, path.Join("content", src))
+	} else {
+		candidates = append(candidates, path.Join(path.Dir(ctx.File.Path), src))
+		if ctx.File.TranslationKey != "" {
+			candidates = append(candidates, path.Join(path.Dir(ctx.File.TranslationKey), src))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if file := ctx.FileManager.GetFile(candidate); file != nil && imageMimeType(file.Name) != "" {
+			return file
+		}
+	}
+	return nil
+}
+
+// Returns the mime type of a supported image, or ""
+func imageMimeType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return ""
+}
+
+// Parses a list of widths, e.g. "480, 960"
+func parseWidths(s string) []int {
+	var widths []int
+	for _, field := range strings.Split(s, ",") {
+		if w, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && w > 0 {
+			widths = append(widths, w)
+		}
+	}
+	slices.Sort(widths)
+	return slices.Compact(widths)
+}
+
+// Scales an image to the given size (after applying the orientation)
+func resize(img image.Image, orientation, width, height int) image.Image {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	// Scale first, then rotate the (smaller) result
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return applyOrientation(dst, orientation)
+}
+
+// Rotates and flips an image according to its EXIF orientation (1-8)
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// Walks the segments of a JPEG file up to the image data. Returns the offset
+// of the image data, or -1 if the file is malformed.
+func walkJPEGSegments(data []byte, fn func(marker byte, segment []byte)) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return -1
+	}
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return -1
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return i
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return -1
+		}
+		fn(marker, data[i:i+2+length])
+		i += 2 + length
+	}
+	return -1
+}
+
+// Removes EXIF, XMP, IPTC and comments from a JPEG file. Color profiles
+// are kept. Returns the original data if the file cannot be parsed.
+func stripJPEGMetadata(data []byte) []byte {
+	stripped := []byte{0xFF, 0xD8}
+	offset := walkJPEGSegments(data, func(marker byte, segment []byte) {
+		// APP1 (EXIF, XMP), APP13 (IPTC), COM
+		if marker == 0xE1 || marker == 0xED || marker == 0xFE {
+			return
+		}
+		stripped = append(stripped, segment...)
+	})
+	if offset < 0 {
+		return data
+	}
+	return append(stripped, data[offset:]...)
+}
+
+// Returns the EXIF orientation of a JPEG file (1 if it has none)
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	walkJPEGSegments(data, func(marker byte, segment []byte) {
+		const header = "Exif\x00\x00"
+		if marker != 0xE1 || len(segment) < 4+len(header) || string(segment[4:4+len(header)]) != header {
+			return
+		}
+
+		tiff := segment[4+len(header):]
+		if len(tiff) < 8 {
+			return
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return
+		}
+		count := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < count; i++ {
+			entry := ifd + 2 + i*12
+			if entry+12 > len(tiff) {
+				return
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+					orientation = value
+				}
+				return
+			}
+		}
+	})
+	return orientation
+}
+
+// Removes EXIF and text chunks from a PNG file. Returns the original data if
+// the file cannot be parsed.
+func stripPNGMetadata(data []byte) []byte {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return data
+	}
+
+	stripped := []byte(signature)
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return data
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length // length, type, data, crc
+		if length < 0 || end > len(data) {
+			return data
+		}
+
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			stripped = append(stripped, data[i:end]...)
+		}
+		i = end
+	}
+	return stripped
+}
+
+var (
+	imageShortcodePattern = regexp.MustCompile(`\{\{<\s*image\s+(.*?)\s*>\}\}`)
+	shortcodeArgPattern   = regexp.MustCompile(`([a-z]+)="([^"]*)"`)
+)
+
+// imageShortcodes replaces {{< image src="..." widths="..." alt="..." sizes="..." >}}
+// with placeholders, which survive the conversion of Markdown and the
+// template engine. Call restore on the final page to insert the markup.
+type imageShortcodes struct {
+	markup map[string]string
+}
+
+func replaceImageShortcodes(ctx *core.PluginContext, content []byte, result *core.PluginResult) ([]byte, *imageShortcodes) {
+	shortcodes := &imageShortcodes{markup: make(map[string]string)}
+	plugin := lookupImagePlugin(ctx)
+
+	content = imageShortcodePattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		var spec core.ImageMetadata
+		args := imageShortcodePattern.FindSubmatch(match)[1]
+		for _, arg := range shortcodeArgPattern.FindAllSubmatch(args, -1) {
+			value := string(arg[2])
+			switch string(arg[1]) {
+			case "src":
+				spec.Src = value
+			case "alt":
+				spec.Alt = value
+			case "sizes":
+				spec.Sizes = value
+			case "widths":
+				spec.Widths = parseWidths(value)
+			}
+		}
+
+		// Without the image plugin (or for external images) a plain <img> is used
+		markup := template.HTML(fmt.Sprintf("<img src=\"%s\" alt=\"%s\">",
+			template.HTMLEscapeString(spec.Src), template.HTMLEscapeString(spec.Alt)))
+		if plugin != nil {
+			responsive, err := plugin.Responsive(ctx, spec, result)
+			if err != nil {
+				log.Printf("Failed to process image %s in %s: %v", spec.Src, ctx.File.Path, err)
+			} else {
+				markup = responsive.Html
+			}
+		}
+
+		placeholder := fmt.Sprintf("minicms-image-%d-placeholder", len(shortcodes.markup))
+		shortcodes.markup[placeholder] = string(markup)
+		return []byte(placeholder)
+	})
+
+	return content, shortcodes
+}
+
+func (s *imageShortcodes) restore(body []byte) []byte {
+	for placeholder, markup := range s.markup {
+		// Markdown wraps a shortcode on its own line in a paragraph
+		body = bytes.ReplaceAll(body, []byte("<p>"+placeholder+"</p>"), []byte(markup))
+		body = bytes.ReplaceAll(body, []byte(placeholder), []byte(markup))
+	}
+	return body
+}
+
+// Generates the variants of all images in the frontmatter. The result is
+// keyed by the "src" attribute, and is available as .Images in templates.
+func buildFrontmatterImages(ctx *core.PluginContext, result *core.PluginResult) map[string]*ResponsiveImage {
+	plugin := lookupImagePlugin(ctx)
+	if plugin == nil || len(ctx.File.Metadata.Images) == 0 {
+		return nil
+	}
+
+	images := make(map[string]*ResponsiveImage)
+	for _, spec := range ctx.File.Metadata.Images {
+		responsive, err := plugin.Responsive(ctx, spec, result)
+		if err != nil {
+			log.Printf("Failed to process image %s in %s: %v", spec.Src, ctx.File.Path, err)
+			continue
+		}
+		images[spec.Src] = responsive
+	}
+	return images
+}
+
+// Returns the registered image plugin, or nil
+func lookupImagePlugin(ctx *core.PluginContext) *BuiltinImagePlugin {
+	if ctx.FileManager == nil {
+		return nil
+	}
+	plugin, _ := ctx.FileManager.GetPluginManager().GetPlugin("builtin/image").(*BuiltinImagePlugin)
+	return plugin
+}
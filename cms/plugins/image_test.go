@@ -0,0 +1,304 @@
+package plugins
+
+import (
+	"bytes"
+	"cms/core"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns an image with a different color in each corner
+func newTestImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{uint8(255 * x / width), uint8(255 * y / height), 0, 255})
+		}
+	}
+	return img
+}
+
+// Returns an APP1 segment with EXIF data which only has an orientation
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // offset of the IFD
+	binary.Write(&tiff, binary.BigEndian, uint16(1)) // number of entries
+	binary.Write(&tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, orientation)
+	binary.Write(&tiff, binary.BigEndian, uint16(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0)) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// Returns a small JPEG file with EXIF data and a comment
+func newTestJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, newTestImage(16, 8), nil))
+	data := buf.Bytes()
+
+	comment := []byte{0xFF, 0xFE, 0, 9}
+	comment = append(comment, "secret!"...)
+
+	var result []byte
+	result = append(result, data[:2]...) // SOI
+	result = append(result, exifSegment(orientation)...)
+	result = append(result, comment...)
+	return append(result, data[2:]...)
+}
+
+func TestParseWidths(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{"", nil},
+		{"480", []int{480}},
+		{"480,960,1440", []int{480, 960, 1440}},
+		{" 960 , 480 ", []int{480, 960}},
+		{"960,480,960", []int{480, 960}},
+		{"abc, 0, -10, 320", []int{320}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseWidths(test.input))
+		})
+	}
+}
+
+func TestResponsiveImageMarkup(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    ResponsiveImage
+		expected string
+	}{
+		{
+			name:     "no variants",
+			image:    ResponsiveImage{Src: "/photo.jpg", Alt: "A photo", Width: 400, Height: 300},
+			expected: `<img src="/photo.jpg" alt="A photo" width="400" height="300" loading="lazy">`,
+		},
+		{
+			name:     "unknown size",
+			image:    ResponsiveImage{Src: "/photo.gif"},
+			expected: `<img src="/photo.gif" alt="" loading="lazy">`,
+		},
+		{
+			name: "srcset",
+			image: ResponsiveImage{Src: "/photo.jpg", Alt: "A photo", Sizes: "100vw", Width: 1000, Height: 500,
+				Srcset: "/photo-480w.jpg 480w, /photo.jpg 1000w"},
+			expected: `<picture><img src="/photo.jpg" alt="A photo" width="1000" height="500" ` +
+				`srcset="/photo-480w.jpg 480w, /photo.jpg 1000w" sizes="100vw" loading="lazy"></picture>`,
+		},
+		{
+			name: "webp srcset",
+			image: ResponsiveImage{Src: "/logo.png", Sizes: "50vw", Width: 1000, Height: 500,
+				Srcset: "/logo-480w.png 480w, /logo.png 1000w", WebpSrcset: "/logo-480w.webp 480w"},
+			expected: `<picture><source type="image/webp" srcset="/logo-480w.webp 480w" sizes="50vw">` +
+				`<img src="/logo.png" alt="" width="1000" height="500" ` +
+				`srcset="/logo-480w.png 480w, /logo.png 1000w" sizes="50vw" loading="lazy"></picture>`,
+		},
+		{
+			name:     "escaping",
+			image:    ResponsiveImage{Src: "/a\"b.jpg", Alt: "<Tom & Jerry>"},
+			expected: `<img src="/a&#34;b.jpg" alt="&lt;Tom &amp; Jerry&gt;" loading="lazy">`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(test.image.markup()))
+		})
+	}
+}
+
+func TestReplaceImageShortcodes(t *testing.T) {
+	siteDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(siteDir, "content"), 0755))
+	var photo bytes.Buffer
+	require.NoError(t, png.Encode(&photo, newTestImage(1000, 500)))
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "content/photo.png"), photo.Bytes(), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "content/page.md"), nil, 0644))
+
+	fm := core.NewFileManager(siteDir)
+	fm.GetPluginManager().RegisterPlugin(NewImagePlugin(&core.Context{}, map[string]string{"widths": "480"}))
+	require.NotNil(t, fm.AddFile("content/photo.png"))
+	page := fm.AddFile("content/page.md")
+	require.NotNil(t, page)
+	ctx := &core.PluginContext{File: page, FileManager: fm, SiteDirectory: siteDir}
+
+	tests := []struct {
+		name        string
+		shortcode   string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:      "default widths",
+			shortcode: `{{< image src="photo.png" alt="A photo" >}}`,
+			contains: []string{
+				`alt="A photo"`,
+				`width="1000" height="500"`,
+				`srcset="/photo-480w.png 480w, /photo.png 1000w"`,
+				`<source type="image/webp" srcset="/photo-480w.webp 480w" sizes="100vw">`,
+			},
+		},
+		{
+			name:      "arguments",
+			shortcode: `{{<image widths="240, 2000,640" sizes="50vw" src="/photo.png">}}`,
+			contains: []string{
+				`srcset="/photo-240w.png 240w, /photo-640w.png 640w, /photo.png 1000w"`,
+				`sizes="50vw"`,
+			},
+			notContains: []string{"2000w"},
+		},
+		{
+			name:      "missing image",
+			shortcode: `{{< image src="missing.png" alt="Missing" >}}`,
+			contains:  []string{`<img src="missing.png" alt="Missing">`},
+		},
+		{
+			name:      "external image",
+			shortcode: `{{< image src="https://example.com/a.png" >}}`,
+			contains:  []string{`<img src="https://example.com/a.png" alt="">`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &core.PluginResult{}
+			content, shortcodes := replaceImageShortcodes(ctx, []byte("Before\n\n"+test.shortcode+"\n\nAfter"), result)
+			assert.NotContains(t, string(content), "{{<")
+			assert.Len(t, shortcodes.markup, 1)
+
+			// Markdown wraps the placeholder in a paragraph
+			body := strings.Replace(string(content), "minicms-image-0-placeholder", "<p>minicms-image-0-placeholder</p>", 1)
+			body = string(shortcodes.restore([]byte(body)))
+			assert.NotContains(t, body, "placeholder")
+			assert.NotContains(t, body, "<p><")
+			assert.True(t, strings.HasPrefix(body, "Before\n\n") && strings.HasSuffix(body, "\n\nAfter"))
+			for _, s := range test.contains {
+				assert.Contains(t, body, s)
+			}
+			for _, s := range test.notContains {
+				assert.NotContains(t, body, s)
+			}
+		})
+	}
+
+	// The variants are output files of the page, which depends on the image
+	result := &core.PluginResult{}
+	replaceImageShortcodes(ctx, []byte(`{{< image src="photo.png" >}}`), result)
+	assert.Contains(t, result.OutputFiles, "/photo-480w.png")
+	assert.Contains(t, result.OutputFiles, "/photo-480w.webp")
+	require.Len(t, result.Dependencies, 1)
+	assert.Equal(t, "content/photo.png", result.Dependencies[0].Path)
+
+	variant, err := png.DecodeConfig(bytes.NewReader(result.OutputFiles["/photo-480w.png"]))
+	require.NoError(t, err)
+	assert.Equal(t, 480, variant.Width)
+	assert.Equal(t, 240, variant.Height)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	data := newTestJPEG(t, 6)
+	assert.Equal(t, 6, jpegOrientation(data))
+	assert.Contains(t, string(data), "secret!")
+
+	stripped := stripJPEGMetadata(data)
+	assert.Less(t, len(stripped), len(data))
+	assert.NotContains(t, string(stripped), "Exif")
+	assert.NotContains(t, string(stripped), "secret!")
+	assert.Equal(t, 1, jpegOrientation(stripped))
+
+	// The image data is unchanged
+	original, err := jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+	assert.Equal(t, original, img)
+
+	// Files which cannot be parsed are not changed
+	for _, data := range [][]byte{nil, []byte("no jpeg"), data[:len(data)/8]} {
+		assert.Equal(t, data, stripJPEGMetadata(data))
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		assert.Equal(t, int(orientation), jpegOrientation(newTestJPEG(t, orientation)))
+	}
+
+	// Invalid orientations and files without EXIF data
+	assert.Equal(t, 1, jpegOrientation(newTestJPEG(t, 9)))
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, newTestImage(4, 4), nil))
+	assert.Equal(t, 1, jpegOrientation(buf.Bytes()))
+	assert.Equal(t, 1, jpegOrientation([]byte("no jpeg")))
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newTestImage(8, 8)))
+	data := buf.Bytes()
+
+	// Inserts a text chunk after the header chunk (the CRC is not checked)
+	text := []byte{0, 0, 0, 15}
+	text = append(text, "tEXtComment\x00secret!"...)
+	text = append(text, 0, 0, 0, 0)
+	headerEnd := 8 + 12 + 13
+	withText := append(append(append([]byte{}, data[:headerEnd]...), text...), data[headerEnd:]...)
+
+	stripped := stripPNGMetadata(withText)
+	assert.Equal(t, data, stripped)
+	_, err := png.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+
+	// Files which cannot be parsed are not changed
+	assert.Equal(t, []byte("no png"), stripPNGMetadata([]byte("no png")))
+	assert.Equal(t, withText[:20], stripPNGMetadata(withText[:20]))
+}
+
+func TestApplyOrientation(t *testing.T) {
+	img := newTestImage(4, 2)
+	topLeft := img.At(0, 0)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		x, y          int // the new position of the top left pixel
+	}{
+		{1, 4, 2, 0, 0},
+		{2, 4, 2, 3, 0},
+		{3, 4, 2, 3, 1},
+		{4, 4, 2, 0, 1},
+		{5, 2, 4, 0, 0},
+		{6, 2, 4, 1, 0},
+		{7, 2, 4, 1, 3},
+		{8, 2, 4, 0, 3},
+	}
+
+	for _, test := range tests {
+		rotated := applyOrientation(img, test.orientation)
+		assert.Equal(t, image.Rect(0, 0, test.width, test.height), rotated.Bounds(), "orientation %d", test.orientation)
+		assert.Equal(t, topLeft, rotated.At(test.x, test.y), "orientation %d", test.orientation)
+	}
+}
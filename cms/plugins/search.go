@@ -9,6 +9,14 @@ import (
 	"sync"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/es"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/it"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/pt"
 )
 
 type SearchResult struct {
@@ -17,21 +25,51 @@ type SearchResult struct {
 }
 
 type BuiltinSearchPlugin struct {
-	index bleve.Index
-	mu    sync.RWMutex
+	indexes map[string]bleve.Index // one index per language code ("" for monolingual sites)
+	mu      sync.RWMutex
 }
 
-func NewSearchPlugin(params map[string]string) *BuiltinSearchPlugin {
+// Creates an in-memory index which uses the given bleve analyzer. Unknown
+// analyzers fall back to the standard analyzer.
+func newSearchIndex(analyzer string) (bleve.Index, error) {
 	mapping := bleve.NewIndexMapping()
-	var err error
+	if analyzer != "" {
+		mapping.DefaultAnalyzer = analyzer
+		if err := mapping.Validate(); err != nil {
+			log.Printf("Unknown search analyzer %q, using %q instead", analyzer, standard.Name)
+			mapping.DefaultAnalyzer = standard.Name
+		}
+	}
+
 	// TODO create a configuration option for a persistent index
 	// and try to open it if it exists (index, err := bleve.Open(indexPath)...)
-	index, err := bleve.NewMemOnly(mapping) // use New("index_name") for persistent storage
-	if err != nil {
-		log.Printf("Failed to create search index: %v", err)
-		return nil
+	return bleve.NewMemOnly(mapping) // use New("index_name") for persistent storage
+}
+
+func NewSearchPlugin(ctx *core.Context, params map[string]string) *BuiltinSearchPlugin {
+	indexes := make(map[string]bleve.Index)
+
+	languages := ctx.Config.Languages.Available
+	if len(languages) == 0 {
+		// A monolingual site has a single index
+		languages = []core.Language{{Analyzer: params["index-language"]}}
 	}
-	return &BuiltinSearchPlugin{index: index}
+
+	for _, lang := range languages {
+		analyzer := lang.Analyzer
+		if analyzer == "" {
+			analyzer = lang.Code
+		}
+
+		index, err := newSearchIndex(analyzer)
+		if err != nil {
+			log.Printf("Failed to create search index: %v", err)
+			return nil
+		}
+		indexes[lang.Code] = index
+	}
+
+	return &BuiltinSearchPlugin{indexes: indexes}
 }
 
 func (p *BuiltinSearchPlugin) Name() string {
@@ -44,7 +82,11 @@ func (p *BuiltinSearchPlugin) Priority() int {
 
 // TODO use contenttype from file's metadata
 func (p *BuiltinSearchPlugin) CanProcess(file *core.File) bool {
-	// Index text-based files
+	// Index text-based pages; files outside of content/ (e.g. layouts) have
+	// no language, and are not part of the site's text
+	if !strings.HasPrefix(file.Path, "content/") {
+		return false
+	}
 	ext := strings.ToLower(filepath.Ext(file.Name))
 	return ext == ".txt" || ext == ".md" || ext == ".markdown" || ext == ".html" || ext == ".htm"
 }
@@ -59,8 +101,16 @@ func (p *BuiltinSearchPlugin) Process(ctx *core.PluginContext) *core.PluginResul
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	index, exists := p.indexes[ctx.File.Language]
+	if !exists {
+		return &core.PluginResult{
+			Success: false,
+			Error:   fmt.Errorf("no search index for language %q", ctx.File.Language),
+		}
+	}
+
 	// TODO remove /content from "Path"
-	err := p.index.Index(ctx.File.Path, ctx.File.Content)
+	err := index.Index(ctx.File.Path, ctx.File.Content)
 	if err != nil {
 		log.Printf("Failed to index file %s: %v", ctx.File.Path, err)
 		return &core.PluginResult{
@@ -74,16 +124,35 @@ func (p *BuiltinSearchPlugin) Process(ctx *core.PluginContext) *core.PluginResul
 	}
 }
 
-// GetSearchResults searches the index for a term
-func (p *BuiltinSearchPlugin) GetSearchResults(query string, limit int) ([]SearchResult, error) {
+// Removes a deleted or moved file from the index of every language; its
+// language may have changed with its path
+func (p *BuiltinSearchPlugin) RemoveFile(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, index := range p.indexes {
+		if err := index.Delete(path); err != nil {
+			log.Printf("Failed to remove %s from the search index: %v", path, err)
+		}
+	}
+}
+
+// GetSearchResults searches the index of a language for a term. Monolingual
+// sites use the empty language code.
+func (p *BuiltinSearchPlugin) GetSearchResults(lang, query string, limit int) ([]SearchResult, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	index, exists := p.indexes[lang]
+	if !exists {
+		return nil, fmt.Errorf("no search index for language %q", lang)
+	}
+
 	searchRequest := bleve.NewSearchRequest(bleve.NewQueryStringQuery(query))
 	searchRequest.Size = limit
 	searchRequest.Highlight = bleve.NewHighlight()
 
-	searchResults, err := p.index.Search(searchRequest)
+	searchResults, err := index.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
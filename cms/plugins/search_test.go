@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"cms/core"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchPluginMultilingual(t *testing.T) {
+	ctx := &core.Context{}
+	ctx.Config.Languages = core.Languages{
+		Default:   "en",
+		Available: []core.Language{{Code: "en"}, {Code: "de"}},
+	}
+	plugin := NewSearchPlugin(ctx, nil)
+	require.NotNil(t, plugin)
+
+	files := []*core.File{
+		{Name: "about.md", Path: "content/about.md", Language: "en", Content: []byte("Hello world")},
+		{Name: "about.md", Path: "content/de/about.md", Language: "de", Content: []byte("Hallo Welt")},
+		{Name: "page.html", Path: "layout/page.html", Content: []byte("<html>world</html>")},
+		{Name: "notes.txt", Path: "assets/notes.txt", Content: []byte("world")},
+	}
+
+	for _, file := range files {
+		if !plugin.CanProcess(file) {
+			continue
+		}
+		result := plugin.Process(&core.PluginContext{File: file})
+		assert.True(t, result.Success, "%s: %v", file.Path, result.Error)
+	}
+
+	// Files outside of content/ have no language, and are not indexed
+	assert.False(t, plugin.CanProcess(files[2]))
+	assert.False(t, plugin.CanProcess(files[3]))
+
+	for lang, expected := range map[string]string{"en": "content/about.md", "de": "content/de/about.md"} {
+		index := plugin.indexes[lang]
+		count, err := index.DocCount()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), count, lang)
+		document, err := index.Document(expected)
+		require.NoError(t, err)
+		assert.NotNil(t, document, lang)
+	}
+
+	_, err := plugin.GetSearchResults("", "world", 10)
+	assert.Error(t, err)
+}
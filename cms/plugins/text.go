@@ -2,11 +2,12 @@ package plugins
 
 import (
 	"cms/core"
-	"path"
 	"strings"
 )
 
-type BuiltinTextPlugin struct{}
+type BuiltinTextPlugin struct {
+	Context *core.Context
+}
 
 func (p *BuiltinTextPlugin) Name() string {
 	return "builtin/text"
@@ -28,14 +29,10 @@ func (p *BuiltinTextPlugin) Process(ctx *core.PluginContext) *core.PluginResult
 		}
 	}
 
-	route := strings.TrimPrefix(ctx.File.Path, "content/")
-	route = "/" + strings.TrimLeft(route, "/")
-	route = path.Clean(route)
-
 	return &core.PluginResult{
 		Success:    true,
 		MimeType:   "text/plain; charset=utf-8",
 		NewContent: content,
-		Routes:     []string{route},
+		Routes:     pageRoutes(p.Context, ctx.File),
 	}
 }
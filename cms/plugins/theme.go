@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"cms/core"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// BuiltinThemePlugin renders CSS templates ("assets/*.css.tmpl") with the
+// theme variables from site.yaml, e.g.
+//
+//	branding:
+//	  theme:
+//	    primary-color: "#336699"
+//
+// In the template the variables are available as {{ theme "primary-color" }},
+// and {{ .CustomProperties }} declares all of them as CSS custom properties
+// (":root { --primary-color: #336699; }").
+type BuiltinThemePlugin struct {
+	Context *core.Context
+}
+
+func (p *BuiltinThemePlugin) Name() string {
+	return "builtin/theme"
+}
+
+func (p *BuiltinThemePlugin) Priority() int {
+	return 50 // Run before the assets plugin
+}
+
+func (p *BuiltinThemePlugin) CanProcess(file *core.File) bool {
+	return isCssTemplate(file.Path)
+}
+
+func (p *BuiltinThemePlugin) Process(ctx *core.PluginContext) *core.PluginResult {
+	content, err := p.Render(ctx.FileManager, ctx.File)
+	if err != nil {
+		return &core.PluginResult{
+			Success: false,
+			Error:   err,
+		}
+	}
+
+	result := &core.PluginResult{
+		Success:    true,
+		Modified:   true,
+		NewContent: content,
+		MimeType:   "text/css; charset=utf-8",
+		Routes:     []string{assetRoute(strings.TrimPrefix(strings.TrimSuffix(ctx.File.Path, ".tmpl"), "assets/"))},
+	}
+
+	// Re-render when the theme variables change
+	if config := ctx.FileManager.GetFile("config/site.yaml"); config != nil {
+		result.Dependencies = []*core.File{config}
+	}
+	return result
+}
+
+// Renders a CSS template with the theme variables from site.yaml. If the
+// configuration is reloaded, it is reloaded before the templates which
+// depend on it; otherwise site.yaml is read again, so that changes of the
+// variables are picked up without a restart.
+func (p *BuiltinThemePlugin) Render(fm *core.FileManager, file *core.File) ([]byte, error) {
+	source := file.ReadFile(fm.SiteDirectory)
+	if source == nil {
+		return nil, fmt.Errorf("failed to read %s", file.Path)
+	}
+
+	theme := p.Context.Config.Branding.Theme
+	if !p.Context.ReloadsConfig() {
+		config := core.NewDefaultConfig()
+		if err := core.ReadConfigYaml(&config, filepath.Join(fm.SiteDirectory, "config", "site.yaml")); err == nil {
+			theme = config.Branding.Theme
+		}
+	}
+
+	funcs := template.FuncMap{
+		"theme": func(name string) (string, error) {
+			value, exists := theme[name]
+			if !exists {
+				return "", fmt.Errorf("unknown theme variable %s", name)
+			}
+			return value, nil
+		},
+	}
+
+	tmpl, err := template.New(file.Path).Funcs(funcs).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", file.Path, err)
+	}
+
+	vars := map[string]any{
+		"Theme":            theme,
+		"CustomProperties": customProperties(theme),
+	}
+
+	var output strings.Builder
+	if err := tmpl.Execute(&output, vars); err != nil {
+		return nil, fmt.Errorf("failed to execute template %s: %w", file.Path, err)
+	}
+	return []byte(output.String()), nil
+}
+
+// Returns the theme variables as CSS custom properties
+func customProperties(theme map[string]string) string {
+	names := make([]string, 0, len(theme))
+	for name := range theme {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteString(":root {\n")
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("  --%s: %s;\n", name, theme[name]))
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// Returns true for CSS templates in the assets directory
+func isCssTemplate(filePath string) bool {
+	return strings.HasPrefix(filePath, "assets/") && strings.HasSuffix(filePath, ".css.tmpl")
+}
+
+// Returns the registered theme plugin, or nil
+func lookupThemePlugin(fm *core.FileManager) *BuiltinThemePlugin {
+	plugin, _ := fm.GetPluginManager().GetPlugin("builtin/theme").(*BuiltinThemePlugin)
+	return plugin
+}
@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"cms/core"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeThemeConfig(t *testing.T, siteDir, color string) {
+	t.Helper()
+	site := "branding:\n  theme:\n    primary-color: \"" + color + "\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "config/site.yaml"), []byte(site), 0644))
+}
+
+func TestThemeVariables(t *testing.T) {
+	for _, reload := range []bool{false, true} {
+		name := "without reloader"
+		if reload {
+			name = "with reloader"
+		}
+		t.Run(name, func(t *testing.T) {
+			siteDir := t.TempDir()
+			for _, dir := range []string{"config", "assets"} {
+				require.NoError(t, os.MkdirAll(filepath.Join(siteDir, dir), 0755))
+			}
+			writeThemeConfig(t, siteDir, "#336699")
+			require.NoError(t, os.WriteFile(filepath.Join(siteDir, "config/users.yaml"), []byte("users:\n  - name: john\n"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(siteDir, "config/navigation.yaml"), []byte("main:\n  - url: /\n    title: Home\n"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(siteDir, "assets/site.css.tmpl"),
+				[]byte(`a { color: {{ theme "primary-color" }} }`+"\n{{ .CustomProperties }}"), 0644))
+
+			ctx := &core.Context{Config: core.NewDefaultConfig()}
+			ctx.Config.SiteDirectory = siteDir
+			require.NoError(t, core.InitializeContext(ctx))
+			fm := core.NewFileManager(siteDir)
+			require.NoError(t, fm.WalkDirectory("assets"))
+			plugin := &BuiltinThemePlugin{Context: ctx}
+			fm.GetPluginManager().RegisterPlugin(plugin)
+
+			if reload {
+				fw, err := core.NewFileWatcherWithBackend(fm, core.NewPollingBackend(time.Second))
+				require.NoError(t, err)
+				fw.SetConfigReloader(ctx)
+				ctx.FileWatcher = fw
+			}
+			assert.Equal(t, reload, ctx.ReloadsConfig())
+
+			render := func() string {
+				t.Helper()
+				content, err := plugin.Render(fm, fm.GetFile("assets/site.css.tmpl"))
+				require.NoError(t, err)
+				return string(content)
+			}
+			assert.Equal(t, "a { color: #336699 }\n:root {\n  --primary-color: #336699;\n}\n", render())
+
+			// The variables are changed while the server runs: either the
+			// reloaded configuration or site.yaml is used
+			writeThemeConfig(t, siteDir, "#993366")
+			if reload {
+				assert.Contains(t, render(), "#336699", "before the configuration is reloaded")
+				require.NoError(t, ctx.ReloadConfig())
+			}
+			assert.Equal(t, "a { color: #993366 }\n:root {\n  --primary-color: #993366;\n}\n", render())
+		})
+	}
+}